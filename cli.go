@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -15,10 +16,15 @@ const apiBase = "http://localhost:8080"
 
 type Session struct {
 	UserID string
+	// Token is sent as the bearer token of every request
+	Token string
 }
 
+// session is shared by all commands; TASK_TOKEN seeds the token
+var session = &Session{Token: os.Getenv("TASK_TOKEN")}
+
 func main() {
-	sess := &Session{}
+	sess := session
 	scanner := bufio.NewScanner(os.Stdin)
 	fmt.Println("Task CLI. Type 'help' for commands.")
 
@@ -46,12 +52,31 @@ func main() {
 			}
 			sess.UserID = args[1]
 			fmt.Println("Session user set to:", sess.UserID)
+		case "set-token":
+			if len(args) < 2 {
+				fmt.Println("Usage: set-token <token>")
+				continue
+			}
+			sess.Token = args[1]
+			fmt.Println("Session token set")
+		case "login":
+			login()
+		case "logout":
+			logout()
+		case "create-token":
+			createToken(sess.UserID, strings.Join(args[1:], " "))
 		case "get-user":
 			getUser(sess.UserID)
 		case "list-users":
-			listUsers()
+			listUsers(queryArg(args))
 		case "delete-user":
-			deleteUser(sess.UserID)
+			deleteUser(sess.UserID, len(args) > 1 && args[1] == "cascade")
+		case "set-role":
+			if len(args) < 3 {
+				fmt.Println("Usage: set-role <user_id> <admin|member|read_only>")
+				continue
+			}
+			setRole(args[1], args[2])
 		case "create-task":
 			if sess.UserID == "" {
 				fmt.Println("Set user first with: set-user <user_id>")
@@ -65,7 +90,52 @@ func main() {
 			}
 			getTask(sess.UserID, args[1])
 		case "list-tasks":
-			listTasks(sess.UserID)
+			listTasks(sess.UserID, queryArg(args))
+		case "subtasks":
+			if len(args) < 2 {
+				fmt.Println("Usage: subtasks <task_id> [query]")
+				continue
+			}
+			listSubtasks(sess.UserID, args[1], queryArg(args[1:]))
+		case "dependencies":
+			if len(args) < 2 {
+				fmt.Println("Usage: dependencies <task_id>")
+				continue
+			}
+			listDependencies(sess.UserID, args[1])
+		case "add-blocker":
+			if len(args) < 3 {
+				fmt.Println("Usage: add-blocker <task_id> <blocker_id>")
+				continue
+			}
+			addBlocker(sess.UserID, args[1], args[2])
+		case "remove-blocker":
+			if len(args) < 3 {
+				fmt.Println("Usage: remove-blocker <task_id> <blocker_id>")
+				continue
+			}
+			removeBlocker(sess.UserID, args[1], args[2])
+		case "update-series":
+			if len(args) < 2 {
+				fmt.Println("Usage: update-series <task_id>")
+				continue
+			}
+			updateSeries(sess.UserID, args[1])
+		case "skip-occurrence":
+			if len(args) < 2 {
+				fmt.Println("Usage: skip-occurrence <task_id>")
+				continue
+			}
+			seriesAction(sess.UserID, args[1], "skip")
+		case "stop-series":
+			if len(args) < 2 {
+				fmt.Println("Usage: stop-series <task_id>")
+				continue
+			}
+			seriesAction(sess.UserID, args[1], "stop")
+		case "workflow":
+			resp, err := send("GET", apiBase+"/workflow", nil)
+			handleResp(resp, err)
 		case "update-task":
 			if len(args) < 2 {
 				fmt.Println("Usage: update-task <task_id>")
@@ -78,6 +148,42 @@ func main() {
 				continue
 			}
 			deleteTask(sess.UserID, args[1])
+		case "list-tags":
+			listTags(sess.UserID)
+		case "create-tag":
+			if len(args) < 2 {
+				fmt.Println("Usage: create-tag <name>")
+				continue
+			}
+			saveTag(sess.UserID, "", strings.Join(args[1:], " "))
+		case "rename-tag":
+			if len(args) < 3 {
+				fmt.Println("Usage: rename-tag <tag_id> <name>")
+				continue
+			}
+			saveTag(sess.UserID, args[1], strings.Join(args[2:], " "))
+		case "delete-tag":
+			if len(args) < 2 {
+				fmt.Println("Usage: delete-tag <tag_id>")
+				continue
+			}
+			deleteTag(sess.UserID, args[1])
+		case "create-webhook":
+			createWebhook(sess.UserID)
+		case "list-webhooks":
+			listWebhooks(sess.UserID)
+		case "delete-webhook":
+			if len(args) < 2 {
+				fmt.Println("Usage: delete-webhook <webhook_id>")
+				continue
+			}
+			deleteWebhook(sess.UserID, args[1])
+		case "deliveries":
+			if len(args) < 2 {
+				fmt.Println("Usage: deliveries <webhook_id> [query]")
+				continue
+			}
+			listDeliveries(sess.UserID, args[1], queryArg(args[1:]))
 		default:
 			fmt.Println("Unknown command:", args[0])
 		}
@@ -87,20 +193,49 @@ func main() {
 func printHelp() {
 	fmt.Println(`
 Commands:
-  create-user           - Create a new user (prompts for name/email)
+  create-user           - Create a new user (prompts for name/email/password) and log in as them
+  login                 - Log in with email and password (prompts for them)
+  logout                - End the current login session
   set-user <user_id>    - Set current session user
+  set-token <token>     - Set the API token sent with every request
+  create-token [name]   - Create another API token for the current user
   get-user              - Get current user info
-  list-users            - List all users
-  delete-user           - Delete current user
-  create-task           - Create a new task (prompts for details)
+  list-users [query]    - List users (e.g. list-users sort=name&limit=10)
+  delete-user [cascade] - Delete current user (cascade also deletes their tasks)
+  set-role <user_id> <role> - Change a user's role: admin, member or read_only (admins only)
+  create-task           - Create a new task (prompts for details; tags are comma-separated, parent_id makes it a subtask, recurrence an RRULE such as FREQ=WEEKLY;BYDAY=MO, reminders minutes before due such as 60,15)
   get-task <task_id>    - Get a task by ID
-  list-tasks            - List tasks for current user
-  update-task <task_id> - Update a task (prompts for details)
+  list-tasks [query]    - List tasks for current user with their tags (e.g. list-tasks tag=work&sort=due_date)
+  subtasks <task_id> [query] - List the subtasks of a task
+  dependencies <task_id> - List the tasks a task waits for and the tasks waiting for it
+  add-blocker <task_id> <blocker_id> - Make a task wait until another is finished
+  remove-blocker <task_id> <blocker_id> - Stop a task from waiting for another
+  update-task <task_id> - Update some fields of a task (prompts for details)
+  update-series <task_id> - Update the open occurrences of a recurring task (prompts for details)
+  skip-occurrence <task_id> - Move a recurring task on to its next occurrence
+  stop-series <task_id> - Stop a recurring task from repeating
+  workflow              - Show the task statuses and allowed status changes
   delete-task <task_id> - Delete a task
+  list-tags             - List the current user's tags
+  create-tag <name>     - Create a tag
+  rename-tag <tag_id> <name> - Rename a tag on every task that has it
+  delete-tag <tag_id>   - Delete a tag and remove it from its tasks
+  create-webhook        - Subscribe a URL to events (prompts for url, comma-separated events and an optional secret)
+  list-webhooks         - List the current user's webhooks
+  delete-webhook <webhook_id> - Delete a webhook and its delivery log
+  deliveries <webhook_id> [query] - List the deliveries of a webhook (e.g. deliveries <id> order=desc)
   help                  - Show this help
   exit/quit             - Exit CLI`)
 }
 
+// queryArg returns the optional query string passed to list commands
+func queryArg(args []string) string {
+	if len(args) < 2 {
+		return ""
+	}
+	return "?" + strings.TrimPrefix(args[1], "?")
+}
+
 func prompt(fields ...string) map[string]string {
 	result := make(map[string]string)
 	reader := bufio.NewReader(os.Stdin)
@@ -113,46 +248,143 @@ func prompt(fields ...string) map[string]string {
 }
 
 func createUser() {
-	input := prompt("name", "email")
+	input := prompt("name", "email", "password")
 	body, _ := json.Marshal(input)
 	resp, err := http.Post(apiBase+"/users", "application/json", bytes.NewBuffer(body))
+	out := handleResp(resp, err)
+	var created struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	if json.Unmarshal(out, &created) == nil && created.Token != "" {
+		session.UserID, session.Token = created.ID, created.Token
+		fmt.Println("Session user and token set; keep the token, it is only shown once")
+	}
+}
+
+func login() {
+	input := prompt("email", "password")
+	body, _ := json.Marshal(input)
+	resp, err := http.Post(apiBase+"/auth/login", "application/json", bytes.NewBuffer(body))
+	out := handleResp(resp, err)
+	var started struct {
+		UserID      string `json:"user_id"`
+		AccessToken string `json:"access_token"`
+	}
+	if json.Unmarshal(out, &started) == nil && started.AccessToken != "" {
+		session.UserID, session.Token = started.UserID, started.AccessToken
+		fmt.Println("Session user and token set")
+	}
+}
+
+func logout() {
+	resp, err := send("POST", apiBase+"/auth/logout", nil)
+	handleResp(resp, err)
+	if err == nil && resp.StatusCode == http.StatusNoContent {
+		session.Token = ""
+	}
+}
+
+func createToken(userID, name string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	if name == "" {
+		name = "cli"
+	}
+	body, _ := json.Marshal(map[string]string{"name": name})
+	url := fmt.Sprintf("%s/users/%s/tokens", apiBase, userID)
+	resp, err := send("POST", url, bytes.NewBuffer(body))
 	handleResp(resp, err)
 }
 
+// send performs an authenticated request against the API
+func send(method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if session.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+session.Token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
 func getUser(userID string) {
 	if userID == "" {
 		fmt.Println("Set user first with: set-user <user_id>")
 		return
 	}
 	url := fmt.Sprintf("%s/users/%s", apiBase, userID)
-	resp, err := http.Get(url)
+	resp, err := send("GET", url, nil)
 	handleResp(resp, err)
 }
 
-func listUsers() {
-	resp, err := http.Get(apiBase + "/users")
+func listUsers(query string) {
+	resp, err := send("GET", apiBase+"/users"+query, nil)
 	handleResp(resp, err)
 }
 
-func deleteUser(userID string) {
+func deleteUser(userID string, cascade bool) {
 	if userID == "" {
 		fmt.Println("Set user first with: set-user <user_id>")
 		return
 	}
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/users/%s", apiBase, userID), nil)
-	if err != nil {
-		fmt.Println("Error:", err)
-		return
+	url := fmt.Sprintf("%s/users/%s", apiBase, userID)
+	if cascade {
+		url += "?cascade=true"
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := send("DELETE", url, nil)
 	handleResp(resp, err)
 }
 
+func setRole(userID, role string) {
+	body, _ := json.Marshal(map[string]string{"role": role})
+	url := fmt.Sprintf("%s/users/%s/role", apiBase, userID)
+	resp, err := send("PUT", url, bytes.NewBuffer(body))
+	handleResp(resp, err)
+}
+
+// splitTags turns comma-separated tag names into a list
+func splitTags(value string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// splitMinutes turns comma-separated reminders into a list of minutes;
+// entries that are not numbers are passed on for the server to reject
+func splitMinutes(value string) []any {
+	minutes := []any{}
+	for _, field := range splitTags(value) {
+		if m, err := strconv.Atoi(field); err == nil {
+			minutes = append(minutes, m)
+		} else {
+			minutes = append(minutes, field)
+		}
+	}
+	return minutes
+}
+
 func createTask(userID string) {
-	input := prompt("title", "description", "due_date", "status")
-	body, _ := json.Marshal(input)
+	input := prompt("title", "description", "due_date", "status", "priority", "tags", "parent_id", "recurrence", "reminders")
+	task := map[string]any{}
+	for field, value := range input {
+		task[field] = value
+	}
+	task["tags"] = splitTags(input["tags"])
+	task["reminders"] = splitMinutes(input["reminders"])
+	body, _ := json.Marshal(task)
 	url := fmt.Sprintf("%s/users/%s/tasks", apiBase, userID)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
+	resp, err := send("POST", url, bytes.NewBuffer(body))
 	handleResp(resp, err)
 }
 
@@ -162,57 +394,204 @@ func getTask(userID, taskID string) {
 		return
 	}
 	url := fmt.Sprintf("%s/users/%s/tasks/%s", apiBase, userID, taskID)
-	resp, err := http.Get(url)
+	resp, err := send("GET", url, nil)
 	handleResp(resp, err)
 }
 
-func listTasks(userID string) {
+func listTasks(userID, query string) {
 	if userID == "" {
 		fmt.Println("Set user first with: set-user <user_id>")
 		return
 	}
-	url := fmt.Sprintf("%s/users/%s/tasks", apiBase, userID)
-	resp, err := http.Get(url)
+	url := fmt.Sprintf("%s/users/%s/tasks%s", apiBase, userID, query)
+	resp, err := send("GET", url, nil)
 	handleResp(resp, err)
 }
 
-func updateTask(userID, taskID string) {
+func listSubtasks(userID, taskID, query string) {
 	if userID == "" {
 		fmt.Println("Set user first with: set-user <user_id>")
 		return
 	}
-	input := prompt("title", "description", "due_date", "status")
-	body, _ := json.Marshal(input)
-	url := fmt.Sprintf("%s/users/%s/tasks/%s", apiBase, userID, taskID)
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(body))
-	if err != nil {
-		fmt.Println("Error:", err)
+	url := fmt.Sprintf("%s/users/%s/tasks/%s/subtasks%s", apiBase, userID, taskID, query)
+	resp, err := send("GET", url, nil)
+	handleResp(resp, err)
+}
+
+func updateTask(userID, taskID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	body := promptPatch("title", "description", "due_date", "status", "priority", "tags", "parent_id", "recurrence", "reminders")
+	url := fmt.Sprintf("%s/users/%s/tasks/%s", apiBase, userID, taskID)
+	resp, err := send("PATCH", url, bytes.NewBuffer(body))
 	handleResp(resp, err)
 }
 
+// promptPatch prompts for fields and returns a merge patch so only the fields
+// that were entered change
+func promptPatch(fields ...string) []byte {
+	fmt.Println("Leave a field blank to keep it, or enter - to clear it")
+	input := prompt(fields...)
+	patch := map[string]any{}
+	for field, value := range input {
+		switch {
+		case value == "":
+		case value == "-":
+			patch[field] = nil
+		case field == "tags":
+			patch[field] = splitTags(value)
+		case field == "reminders":
+			patch[field] = splitMinutes(value)
+		default:
+			patch[field] = value
+		}
+	}
+	body, _ := json.Marshal(patch)
+	return body
+}
+
 func deleteTask(userID, taskID string) {
 	if userID == "" {
 		fmt.Println("Set user first with: set-user <user_id>")
 		return
 	}
 	url := fmt.Sprintf("%s/users/%s/tasks/%s", apiBase, userID, taskID)
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		fmt.Println("Error:", err)
+	resp, err := send("DELETE", url, nil)
+	handleResp(resp, err)
+}
+
+func listTags(userID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	resp, err := send("GET", fmt.Sprintf("%s/users/%s/tags", apiBase, userID), nil)
+	handleResp(resp, err)
+}
+
+// saveTag creates a tag, or renames the tag tagID if it is set
+func saveTag(userID, tagID, name string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	body, _ := json.Marshal(map[string]string{"name": name})
+	method, url := "POST", fmt.Sprintf("%s/users/%s/tags", apiBase, userID)
+	if tagID != "" {
+		method, url = "PUT", url+"/"+tagID
+	}
+	resp, err := send(method, url, bytes.NewBuffer(body))
+	handleResp(resp, err)
+}
+
+func deleteTag(userID, tagID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	resp, err := send("DELETE", fmt.Sprintf("%s/users/%s/tags/%s", apiBase, userID, tagID), nil)
+	handleResp(resp, err)
+}
+
+func listDependencies(userID, taskID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	url := fmt.Sprintf("%s/users/%s/tasks/%s/dependencies", apiBase, userID, taskID)
+	resp, err := send("GET", url, nil)
+	handleResp(resp, err)
+}
+
+func addBlocker(userID, taskID, blockerID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	body, _ := json.Marshal(map[string]string{"blocker_id": blockerID})
+	url := fmt.Sprintf("%s/users/%s/tasks/%s/dependencies", apiBase, userID, taskID)
+	resp, err := send("POST", url, bytes.NewBuffer(body))
+	handleResp(resp, err)
+}
+
+func removeBlocker(userID, taskID, blockerID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	url := fmt.Sprintf("%s/users/%s/tasks/%s/dependencies/%s", apiBase, userID, taskID, blockerID)
+	resp, err := send("DELETE", url, nil)
+	handleResp(resp, err)
+}
+
+func updateSeries(userID, taskID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	body := promptPatch("title", "description", "priority", "tags", "recurrence", "reminders")
+	url := fmt.Sprintf("%s/users/%s/tasks/%s/series", apiBase, userID, taskID)
+	resp, err := send("PATCH", url, bytes.NewBuffer(body))
+	handleResp(resp, err)
+}
+
+// seriesAction skips an occurrence or stops the series of a recurring task
+func seriesAction(userID, taskID, action string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	url := fmt.Sprintf("%s/users/%s/tasks/%s/series/%s", apiBase, userID, taskID, action)
+	resp, err := send("POST", url, nil)
+	handleResp(resp, err)
+}
+
+func createWebhook(userID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
 		return
 	}
-	resp, err := http.DefaultClient.Do(req)
+	input := prompt("url", "events", "secret")
+	body, _ := json.Marshal(map[string]any{"url": input["url"], "events": splitTags(input["events"]), "secret": input["secret"]})
+	resp, err := send("POST", fmt.Sprintf("%s/users/%s/webhooks", apiBase, userID), bytes.NewBuffer(body))
 	handleResp(resp, err)
 }
 
-func handleResp(resp *http.Response, err error) {
+func listWebhooks(userID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	resp, err := send("GET", fmt.Sprintf("%s/users/%s/webhooks", apiBase, userID), nil)
+	handleResp(resp, err)
+}
+
+func deleteWebhook(userID, webhookID string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	resp, err := send("DELETE", fmt.Sprintf("%s/users/%s/webhooks/%s", apiBase, userID, webhookID), nil)
+	handleResp(resp, err)
+}
+
+func listDeliveries(userID, webhookID, query string) {
+	if userID == "" {
+		fmt.Println("Set user first with: set-user <user_id>")
+		return
+	}
+	url := fmt.Sprintf("%s/users/%s/webhooks/%s/deliveries%s", apiBase, userID, webhookID, query)
+	resp, err := send("GET", url, nil)
+	handleResp(resp, err)
+}
+
+// handleResp prints a response and returns its body
+func handleResp(resp *http.Response, err error) []byte {
 	if err != nil {
 		fmt.Println("Error:", err)
-		return
+		return nil
 	}
 	defer resp.Body.Close()
 	out, _ := io.ReadAll(resp.Body)
@@ -221,8 +600,9 @@ func handleResp(resp *http.Response, err error) {
 	if json.Valid(out) {
 		if err := json.Indent(&pretty, out, "", "  "); err == nil {
 			fmt.Println(pretty.String())
-			return
+			return out
 		}
 	}
 	fmt.Println(string(out))
+	return out
 }
@@ -1,25 +1,83 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"os"
 
 	"task-manager/internal/api"
 	"task-manager/internal/db"
+	"task-manager/internal/scheduler"
+	"task-manager/internal/webhook"
+	"task-manager/internal/workflow"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	defaultDSN := os.Getenv("DATABASE_URL")
+	if defaultDSN == "" {
+		defaultDSN = "tasks.db"
+	}
+	dsn := flag.String("db", defaultDSN, "SQLite file, postgres:// URL or memory:// (defaults to $DATABASE_URL)")
+	queryTimeout := flag.Duration("query-timeout", api.DefaultQueryTimeout, "per-request database deadline (0 disables it)")
+	jwtSecret := flag.String("jwt-secret", os.Getenv("JWT_SECRET"), "key signing login sessions (defaults to $JWT_SECRET; required with GIN_MODE=release, random otherwise)")
+	workflowFile := flag.String("workflow", os.Getenv("TASK_WORKFLOW"), "JSON file defining task statuses and transitions (defaults to $TASK_WORKFLOW)")
+	scanInterval := flag.Duration("scan-interval", scheduler.DefaultInterval, "how often to look for overdue tasks and due reminders (0 disables it)")
+	webhookInterval := flag.Duration("webhook-interval", webhook.DefaultInterval, "how often to send queued webhook deliveries (0 disables it)")
+	webhookAllowPrivate := flag.Bool("webhook-allow-private", false, "let webhooks reach loopback and private addresses (for local development only)")
+	flag.Parse()
+
+	wf := workflow.Default
+	if *workflowFile != "" {
+		var err error
+		if wf, err = workflow.Load(*workflowFile); err != nil {
+			log.Fatalf("Could not load the workflow: %v", err)
+		}
+	}
+
 	// Initialize the database connection
-	database, err := db.NewSQLiteDB("tasks.db")
+	database, err := db.Open(*dsn)
 	if err != nil {
 		log.Fatalf("Could not connect to the database: %v", err)
 	}
 	defer database.Close()
 
+	guard := &webhook.Guard{AllowPrivate: *webhookAllowPrivate}
+
+	// Flag overdue tasks and send reminders in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *scanInterval > 0 {
+		go scheduler.New(database,
+			scheduler.WithInterval(*scanInterval),
+			scheduler.WithWorkflow(wf),
+			scheduler.WithNotifier(notifyWebhooks),
+		).Run(ctx)
+	}
+	if *webhookInterval > 0 {
+		go webhook.NewDispatcher(database,
+			webhook.WithInterval(*webhookInterval),
+			webhook.WithGuard(guard),
+		).Run(ctx)
+	}
+
 	// Set up Gin router and register routes
 	router := gin.Default()
-	api.RegisterRoutes(router, database)
+	if *jwtSecret == "" {
+		if gin.Mode() == gin.ReleaseMode {
+			log.Fatal("No JWT secret configured; set -jwt-secret or $JWT_SECRET")
+		}
+		log.Println("WARNING: No JWT secret configured, so a random one is used and login sessions " +
+			"will not survive a restart. This is only allowed in development; set -jwt-secret or $JWT_SECRET.")
+	}
+	api.RegisterRoutes(router, database,
+		api.WithQueryTimeout(*queryTimeout),
+		api.WithJWTSecret([]byte(*jwtSecret)),
+		api.WithWorkflow(wf),
+		api.WithWebhookGuard(guard),
+	)
 
 	// Start the server
 	log.Println("Starting server on :8080")
@@ -27,3 +85,14 @@ func main() {
 		log.Fatalf("Could not start server: %v", err)
 	}
 }
+
+// notifyWebhooks logs the events of the scheduler and queues them for the
+// webhooks of the task's owner, in the transaction that stores the change
+func notifyWebhooks(ctx context.Context, tx db.DB, e scheduler.Event) error {
+	scheduler.LogNotifier(ctx, tx, e)
+	data := map[string]any{"task": e.Task}
+	if e.Type == scheduler.EventReminder {
+		data["minutes"] = e.Minutes
+	}
+	return webhook.Enqueue(ctx, tx, e.Task.UserID, e.Type, data)
+}
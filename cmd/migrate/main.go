@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"task-manager/internal/db"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: migrate [-db tasks.db] <command>
+
+Commands:
+  up          Apply all pending migrations
+  down [n]    Revert the last n applied migrations (default 1)
+  status      Show applied and pending migrations`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	defaultDSN := os.Getenv("DATABASE_URL")
+	if defaultDSN == "" {
+		defaultDSN = "tasks.db"
+	}
+	dsn := flag.String("db", defaultDSN, "SQLite file or postgres:// URL (defaults to $DATABASE_URL)")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	migrator, err := db.OpenMigrator(*dsn)
+	if err != nil {
+		log.Fatalf("Could not connect to the database: %v", err)
+	}
+	defer migrator.Close()
+
+	switch flag.Arg(0) {
+	case "up":
+		n, err := migrator.Up()
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", n)
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid step count: %s", flag.Arg(1))
+			}
+		}
+		n, err := migrator.Down(steps)
+		if err != nil {
+			log.Fatalf("Rollback failed after reverting %d migration(s): %v", n, err)
+		}
+		fmt.Printf("Reverted %d migration(s)\n", n)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatalf("Could not read migration status: %v", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt
+			}
+			if s.Modified {
+				state += " (modified since applied)"
+			}
+			fmt.Printf("%4d  %-32s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+	"task-manager/internal/service"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: token [-db tasks.db] [-admin] <user_id> [name]
+
+Issues an API token for an existing user and prints its secret, e.g. for
+accounts created before tokens existed. With -admin the user is made an
+admin first, which is how the first admin is set up: registration through
+the API only ever creates members.`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	defaultDSN := os.Getenv("DATABASE_URL")
+	if defaultDSN == "" {
+		defaultDSN = "tasks.db"
+	}
+	dsn := flag.String("db", defaultDSN, "SQLite file or postgres:// URL (defaults to $DATABASE_URL)")
+	admin := flag.Bool("admin", false, "make the user an admin")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	name := "cli"
+	if flag.NArg() > 1 {
+		name = flag.Arg(1)
+	}
+
+	database, err := db.Open(*dsn)
+	if err != nil {
+		log.Fatalf("Could not connect to the database: %v", err)
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	if *admin {
+		if _, err := service.NewUserService(database).SetRole(ctx, flag.Arg(0), model.RoleAdmin); err != nil {
+			log.Fatalf("Could not make the user an admin: %v", err)
+		}
+	}
+	_, secret, err := service.NewAuthService(database, nil).CreateToken(ctx, flag.Arg(0), name)
+	if err != nil {
+		log.Fatalf("Could not create token: %v", err)
+	}
+	fmt.Println(secret)
+}
@@ -2,15 +2,26 @@ package api_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"task-manager/internal/api"
 	"task-manager/internal/db"
 	"task-manager/internal/model"
+	"task-manager/internal/webhook"
+	"task-manager/internal/workflow"
 
 	"github.com/gin-gonic/gin"
 	. "github.com/onsi/ginkgo/v2"
@@ -22,322 +33,2115 @@ func TestAPI(t *testing.T) {
 	RunSpecs(t, "API Suite")
 }
 
-var _ = Describe("Task Management API", func() {
-	var router *gin.Engine
-	var userID string
-	var testDB db.DB
-
-	BeforeEach(func() {
-		testDB, _ = db.NewSQLiteDB(":memory:")
-		router = gin.Default()
-		api.RegisterRoutes(router, testDB)
-
-		// Create a user for task tests
-		user := model.User{Name: "Test User", Email: "test@example.com"}
-		userJson, _ := json.Marshal(user)
-		req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(userJson))
-		req.Header.Set("Content-Type", "application/json")
-		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
-		var createdUser model.User
-		json.Unmarshal(w.Body.Bytes(), &createdUser)
-		userID = createdUser.ID
-	})
+// staticResolver resolves every host to the same addresses without asking DNS
+type staticResolver []string
+
+func (r staticResolver) LookupNetIP(context.Context, string, string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	for _, addr := range r {
+		addrs = append(addrs, netip.MustParseAddr(addr))
+	}
+	return addrs, nil
+}
+
+// authorized sends requests with the given token unless they carry their own
+// Authorization header
+type authorized struct {
+	handler http.Handler
+	token   *string
+}
+
+func (a authorized) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") == "" && *a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+*a.token)
+	}
+	a.handler.ServeHTTP(w, req)
+}
 
-	Describe("User API", func() {
-		It("should create a user", func() {
-			user := model.User{Name: "Alice", Email: "alice@example.com"}
-			userJson, _ := json.Marshal(user)
-			req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(userJson))
+// testPassword is the password every test user registers with
+const testPassword = "correct horse"
+
+// registration is the body of POST /users
+func registration(name, email string) []byte {
+	body, _ := json.Marshal(map[string]string{"name": name, "email": email, "password": testPassword})
+	return body
+}
+
+// registerUser creates a user through the API and returns their ID and token
+func registerUser(router http.Handler, name, email string) (string, string) {
+	body := registration(name, email)
+	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	Expect(w.Code).To(Equal(http.StatusCreated))
+	var created struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	return created.ID, created.Token
+}
+
+var _ = describeAPI("MemoryDB", func() db.DB {
+	return db.NewMemoryDB()
+})
+
+var _ = describeAPI("SQLiteDB", func() db.DB {
+	testDB, err := db.NewSQLiteDB(":memory:")
+	Expect(err).NotTo(HaveOccurred())
+	return testDB
+})
+
+// describeAPI runs the API specs against the store returned by open, which
+// must start out empty. Running them on SQLite as well as in memory catches
+// where the stores disagree, such as in case folding outside of ASCII.
+func describeAPI(name string, open func() db.DB) bool {
+	return Describe("Task Management API on "+name, func() {
+		var router http.Handler
+		var userID, token string
+		var testDB db.DB
+
+		BeforeEach(func() {
+			testDB = open()
+			DeferCleanup(testDB.Close)
+			engine := gin.Default()
+			// Webhook receivers listen on the loopback interface, and no DNS is
+			// needed for the hosts of the other webhooks
+			api.RegisterRoutes(engine, testDB, api.WithWebhookGuard(&webhook.Guard{AllowPrivate: true}))
+			token = ""
+			router = authorized{engine, &token}
+
+			// Create a user for task tests
+			req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(registration("Test User", "test@example.com")))
 			req.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusCreated))
-			Expect(w.Body.String()).To(ContainSubstring("Alice"))
+			var createdUser struct {
+				model.User
+				Token string `json:"token"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &createdUser)
+			userID = createdUser.ID
+			token = createdUser.Token
+			// Made an admin out of band, as the token command does
+			Expect(testDB.UpdateUserRole(context.Background(), userID, model.RoleAdmin)).To(Succeed())
+		})
+
+		Describe("User API", func() {
+			It("should create a user", func() {
+				req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(registration("Alice", "alice@example.com")))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				Expect(w.Body.String()).To(ContainSubstring("Alice"))
+				Expect(w.Body.String()).NotTo(ContainSubstring("password"))
+			})
+
+			It("should not create a user without a long enough password", func() {
+				req, _ := http.NewRequest("POST", "/users", bytes.NewBufferString(`{"name": "Alice", "email": "alice@example.com", "password": "short"}`))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("should not create a user with an email that is already taken", func() {
+				registerUser(router, "Bob", "bob@example.com")
+				req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(registration("Robert", "bob@example.com")))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusConflict))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"email_taken"`))
+				Expect(w.Body.String()).NotTo(ContainSubstring("UNIQUE"))
+			})
+
+			It("should store emails lower-cased, so case does not make a new account", func() {
+				req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(registration("Bob", " Bob@Example.com ")))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				Expect(w.Body.String()).To(ContainSubstring(`"email":"bob@example.com"`))
+
+				req, _ = http.NewRequest("POST", "/users", bytes.NewBuffer(registration("Robert", "bob@example.com")))
+				req.Header.Set("Content-Type", "application/json")
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusConflict))
+			})
+
+			It("should not create a user with an invalid email", func() {
+				for _, email := range []string{"alice", "alice@", "@example.com", "Alice <alice@example.com>", "alice@localhost", "alice@example.com, bob@example.com"} {
+					req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(registration("Alice", email)))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusBadRequest), email)
+					Expect(w.Body.String()).To(ContainSubstring("email must be a valid email address"), email)
+				}
+			})
+
+			It("should normalize the name and email of a new user", func() {
+				req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(registration("  Alice   Smith ", " alice@example.com ")))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var created model.User
+				json.Unmarshal(w.Body.Bytes(), &created)
+				Expect(created.Name).To(Equal("Alice Smith"))
+				Expect(created.Email).To(Equal("alice@example.com"))
+			})
+
+			It("should not create a user with missing fields", func() {
+				user := model.User{Name: "", Email: ""}
+				userJson, _ := json.Marshal(user)
+				req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(userJson))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"name"`))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"email"`))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"password"`))
+			})
+
+			It("should not create a user with too short name", func() {
+				user := model.User{Name: "A", Email: "short@example.com"}
+				userJson, _ := json.Marshal(user)
+				req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(userJson))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("name must be between 2 and 50 characters"))
+			})
+
+			It("should not create a user with too long name", func() {
+				longName := ""
+				for i := 0; i < 51; i++ {
+					longName += "a"
+				}
+				user := model.User{Name: longName, Email: "long@example.com"}
+				userJson, _ := json.Marshal(user)
+				req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(userJson))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("name must be between 2 and 50 characters"))
+			})
+
+			It("should get a user by ID", func() {
+				req, _ := http.NewRequest("GET", "/users/"+userID, nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring("Test User"))
+			})
+
+			It("should return 404 for non-existent user", func() {
+				req, _ := http.NewRequest("GET", "/users/non-existent-id", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("should list users", func() {
+				req, _ := http.NewRequest("GET", "/users", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring("Test User"))
+			})
+
+			It("should delete a user", func() {
+				memberID, _ := registerUser(router, "Bob", "bob@example.com")
+				req, _ := http.NewRequest("DELETE", "/users/"+memberID, nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+			})
+
+			It("should not delete the last admin", func() {
+				req, _ := http.NewRequest("DELETE", "/users/"+userID, nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusConflict))
+			})
+
+			It("should return 504 when the query deadline is exceeded", func() {
+				timeoutRouter := gin.New()
+				api.RegisterRoutes(timeoutRouter, testDB, api.WithQueryTimeout(time.Nanosecond))
+				req, _ := http.NewRequest("GET", "/users/"+userID, nil)
+				w := httptest.NewRecorder()
+				authorized{timeoutRouter, &token}.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusGatewayTimeout))
+			})
+
+			It("should return 499 when the client cancels the request", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				req, _ := http.NewRequestWithContext(ctx, "GET", "/users", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(499))
+			})
+
+			It("should return 404 when deleting non-existent user", func() {
+				req, _ := http.NewRequest("DELETE", "/users/non-existent-id", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"user_not_found"`))
+			})
+		})
+
+		Describe("Workflow", func() {
+			var wfRouter http.Handler
+			var taskID string
+
+			send := func(method, path, body string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				wfRouter.ServeHTTP(w, req)
+				return w
+			}
+			setStatus := func(status string) *httptest.ResponseRecorder {
+				return send("PATCH", "/users/"+userID+"/tasks/"+taskID, `{"status": "`+status+`"}`)
+			}
+
+			BeforeEach(func() {
+				wf, err := workflow.New(workflow.Config{Statuses: []workflow.Status{
+					{Name: "todo", Next: []string{"doing", "cancelled"}},
+					{Name: "doing", Next: []string{"review", "blocked"}},
+					{Name: "blocked", Next: []string{"doing"}},
+					{Name: "review", Next: []string{"doing", "done"}},
+					{Name: "done", Terminal: true},
+					{Name: "cancelled", Terminal: true},
+				}})
+				Expect(err).NotTo(HaveOccurred())
+				engine := gin.New()
+				api.RegisterRoutes(engine, testDB, api.WithWorkflow(wf))
+				wfRouter = authorized{engine, &token}
+
+				w := send("POST", "/users/"+userID+"/tasks", `{"title": "Ship it", "due_date": "2025-08-09T15:04:05Z", "status": "todo"}`)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var created model.Task
+				json.Unmarshal(w.Body.Bytes(), &created)
+				taskID = created.ID
+			})
+
+			It("should describe the configured workflow", func() {
+				w := send("GET", "/workflow", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				var cfg workflow.Config
+				json.Unmarshal(w.Body.Bytes(), &cfg)
+				Expect(cfg.Statuses).To(HaveLen(6))
+				Expect(cfg.Statuses[0].Name).To(Equal("todo"))
+				Expect(cfg.Statuses[0].Next).To(Equal([]string{"doing", "cancelled"}))
+			})
+
+			It("should start tasks that name no status in the initial one", func() {
+				w := send("POST", "/users/"+userID+"/tasks", `{"title": "Plan it", "due_date": "2025-08-09T15:04:05Z"}`)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				Expect(w.Body.String()).To(ContainSubstring(`"status":"todo"`))
+			})
+
+			It("should refuse a terminal initial status", func() {
+				_, err := workflow.New(workflow.Config{Statuses: []workflow.Status{
+					{Name: "done", Terminal: true},
+					{Name: "todo", Next: []string{"done"}},
+				}})
+				Expect(err).To(MatchError(workflow.ErrInvalidWorkflow))
+
+				wf, err := workflow.New(workflow.Config{Initial: "todo", Statuses: []workflow.Status{
+					{Name: "done", Terminal: true},
+					{Name: "todo", Next: []string{"done"}},
+				}})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(wf.Initial()).To(Equal("todo"))
+
+				_, err = workflow.New(workflow.Config{Initial: "missing", Statuses: wf.Config().Statuses})
+				Expect(err).To(MatchError(workflow.ErrInvalidWorkflow))
+			})
+
+			It("should only accept the configured statuses", func() {
+				w := send("POST", "/users/"+userID+"/tasks", `{"title": "Old style", "due_date": "2025-08-09T15:04:05Z", "status": "pending"}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("must be one of todo, doing, blocked, review, done, cancelled"))
+			})
+
+			It("should follow allowed transitions", func() {
+				for _, status := range []string{"doing", "blocked", "doing", "review", "done"} {
+					w := setStatus(status)
+					Expect(w.Code).To(Equal(http.StatusOK), status)
+					Expect(w.Body.String()).To(ContainSubstring(`"status":"`+status+`"`), status)
+				}
+			})
+
+			It("should refuse other transitions with the legal next statuses", func() {
+				w := setStatus("done")
+				Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+				var p struct {
+					Code            string   `json:"code"`
+					From            string   `json:"from"`
+					To              string   `json:"to"`
+					AllowedStatuses []string `json:"allowed_statuses"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &p)
+				Expect(p.Code).To(Equal("invalid_transition"))
+				Expect(p.From).To(Equal("todo"))
+				Expect(p.To).To(Equal("done"))
+				Expect(p.AllowedStatuses).To(Equal([]string{"doing", "cancelled"}))
+
+				w = send("PUT", "/users/"+userID+"/tasks/"+taskID, `{"title": "Ship it", "due_date": "2025-08-09T15:04:05Z", "status": "review"}`)
+				Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+
+				w = send("POST", "/users/"+userID+"/tasks/bulk-status", `{"task_ids": ["`+taskID+`"], "status": "done"}`)
+				Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+			})
+
+			It("should not move tasks out of terminal statuses", func() {
+				Expect(setStatus("cancelled").Code).To(Equal(http.StatusOK))
+				w := setStatus("todo")
+				Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(w.Body.String()).To(ContainSubstring("cancelled is final"))
+				Expect(w.Body.String()).To(ContainSubstring(`"allowed_statuses":[]`))
+			})
+
+			It("should leave tasks in terminal statuses out of the overdue list", func() {
+				Expect(setStatus("cancelled").Code).To(Equal(http.StatusOK))
+				w := send("GET", "/users/"+userID+"/tasks?overdue=true", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).NotTo(ContainSubstring("Ship it"))
+
+				send("POST", "/users/"+userID+"/tasks", `{"title": "Stuck", "due_date": "2025-08-09T15:04:05Z", "status": "blocked"}`)
+				w = send("GET", "/users/"+userID+"/tasks?overdue=true", "")
+				Expect(w.Body.String()).To(ContainSubstring("Stuck"))
+			})
+		})
+
+		Describe("Tags", func() {
+			send := func(method, path, body string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+			createTask := func(title string, tags ...string) model.Task {
+				body, _ := json.Marshal(model.Task{Title: title, DueDate: "2025-08-09T15:04:05Z", Status: "pending", Tags: tags})
+				w := send("POST", "/users/"+userID+"/tasks", string(body))
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var task model.Task
+				json.Unmarshal(w.Body.Bytes(), &task)
+				return task
+			}
+			listTitles := func(query string) []string {
+				w := send("GET", "/users/"+userID+"/tasks?"+query, "")
+				Expect(w.Code).To(Equal(http.StatusOK), query)
+				var page struct {
+					Items []model.Task `json:"items"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &page)
+				titles := []string{}
+				for _, t := range page.Items {
+					titles = append(titles, t.Title)
+				}
+				return titles
+			}
+
+			It("should assign tags when creating and patching tasks", func() {
+				task := createTask("Write report", " work ", "q4", "work")
+				Expect(task.Tags).To(Equal([]string{"q4", "work"}))
+
+				w := send("PATCH", "/users/"+userID+"/tasks/"+task.ID, `{"tags": ["home"]}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"tags":["home"]`))
+
+				w = send("PATCH", "/users/"+userID+"/tasks/"+task.ID, `{"tags": null}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"tags":[]`))
+
+				w = send("GET", "/users/"+userID+"/tags", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				for _, name := range []string{"home", "q4", "work"} {
+					Expect(w.Body.String()).To(ContainSubstring(`"name":"` + name + `"`))
+				}
+			})
+
+			It("should filter tasks by any or all tags", func() {
+				createTask("Write report", "work", "q4")
+				createTask("Tidy desk", "work")
+				createTask("Water plants", "home")
+
+				Expect(listTitles("tag=q4&tag=home")).To(ConsistOf("Write report", "Water plants"))
+				Expect(listTitles("tag=work,q4&tag_match=all")).To(ConsistOf("Write report"))
+				Expect(listTitles("tag=work&sort=title")).To(Equal([]string{"Tidy desk", "Write report"}))
+				Expect(listTitles("tag=unknown")).To(BeEmpty())
+
+				w := send("GET", "/users/"+userID+"/tasks?tag=work&tag_match=some", "")
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("invalid tag_match"))
+			})
+
+			It("should create, rename and delete tags", func() {
+				task := createTask("Write report", "work")
+
+				w := send("POST", "/users/"+userID+"/tags", `{"name": "  side   project "}`)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var tag model.Tag
+				json.Unmarshal(w.Body.Bytes(), &tag)
+				Expect(tag.Name).To(Equal("side project"))
+				Expect(tag.ID).NotTo(BeEmpty())
+
+				w = send("POST", "/users/"+userID+"/tags", `{"name": "work"}`)
+				Expect(w.Code).To(Equal(http.StatusConflict))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"tag_exists"`))
+
+				w = send("GET", "/users/"+userID+"/tags", "")
+				var tags struct {
+					Items []model.Tag `json:"items"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &tags)
+				Expect(tags.Items).To(HaveLen(2))
+				Expect(tags.Items[1].Name).To(Equal("work"))
+				workID := tags.Items[1].ID
+
+				w = send("PUT", "/users/"+userID+"/tags/"+workID, `{"name": "office"}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				w = send("GET", "/users/"+userID+"/tasks/"+task.ID, "")
+				Expect(w.Body.String()).To(ContainSubstring(`"tags":["office"]`))
+				Expect(w.Header().Get("ETag")).NotTo(Equal(`"1"`))
+
+				w = send("DELETE", "/users/"+userID+"/tags/"+workID, "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				w = send("GET", "/users/"+userID+"/tasks/"+task.ID, "")
+				Expect(w.Body.String()).To(ContainSubstring(`"tags":[]`))
+
+				w = send("DELETE", "/users/"+userID+"/tags/"+workID, "")
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"tag_not_found"`))
+			})
+
+			It("should reject invalid tag names", func() {
+				for body, message := range map[string]string{
+					`{"name": "  "}`:  "name must be between 1 and 30 characters",
+					`{"name": "a,b"}`: "name must not contain commas",
+					`{"name": "` + strings.Repeat("x", 31) + `"}`: "name must be between 1 and 30 characters",
+				} {
+					w := send("POST", "/users/"+userID+"/tags", body)
+					Expect(w.Code).To(Equal(http.StatusBadRequest), body)
+					Expect(w.Body.String()).To(ContainSubstring(message), body)
+				}
+
+				body, _ := json.Marshal(model.Task{Title: "Write report", DueDate: "2025-08-09T15:04:05Z", Status: "pending", Tags: []string{"ok", "a,b"}})
+				w := send("POST", "/users/"+userID+"/tasks", string(body))
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"tags"`))
+				Expect(w.Body.String()).To(ContainSubstring("tag must not contain commas"))
+			})
+
+			It("should not let other users see or change a user's tags", func() {
+				createTask("Write report", "work")
+				_, otherToken := registerUser(router, "Alice", "alice@example.com")
+				token = otherToken
+
+				Expect(send("GET", "/users/"+userID+"/tags", "").Code).To(Equal(http.StatusForbidden))
+				Expect(send("POST", "/users/"+userID+"/tags", `{"name": "mine"}`).Code).To(Equal(http.StatusForbidden))
+			})
+		})
+
+		Describe("Subtasks", func() {
+			send := func(method, path, body string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+			createTask := func(title, parentID string) model.Task {
+				body, _ := json.Marshal(model.Task{Title: title, DueDate: "2025-08-09T15:04:05Z", Status: "pending", ParentID: parentID})
+				w := send("POST", "/users/"+userID+"/tasks", string(body))
+				Expect(w.Code).To(Equal(http.StatusCreated), w.Body.String())
+				var task model.Task
+				json.Unmarshal(w.Body.Bytes(), &task)
+				return task
+			}
+			getTask := func(id string) model.Task {
+				w := send("GET", "/users/"+userID+"/tasks/"+id, "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				var task model.Task
+				json.Unmarshal(w.Body.Bytes(), &task)
+				return task
+			}
+
+			var parent model.Task
+
+			BeforeEach(func() {
+				parent = createTask("Move house", "")
+			})
+
+			It("should roll up the progress of subtasks", func() {
+				Expect(parent.Progress).To(BeNil())
+				first := createTask("Pack boxes", parent.ID)
+				createTask("Book van", parent.ID)
+				Expect(first.ParentID).To(Equal(parent.ID))
+
+				got := getTask(parent.ID)
+				Expect(got.Progress).To(Equal(&model.Progress{Total: 2, Done: 0, Percent: 0}))
+				Expect(got.Version).To(BeNumerically(">", parent.Version))
+
+				w := send("PATCH", "/users/"+userID+"/tasks/"+first.ID, `{"status": "done"}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(getTask(parent.ID).Progress).To(Equal(&model.Progress{Total: 2, Done: 1, Percent: 50}))
+
+				w = send("GET", "/users/"+userID+"/tasks/"+parent.ID+"/subtasks?sort=title", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				var page struct {
+					Items []model.Task `json:"items"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &page)
+				Expect(page.Items).To(HaveLen(2))
+				Expect(page.Items[0].Title).To(Equal("Book van"))
+
+				w = send("GET", "/users/"+userID+"/tasks/"+parent.ID+"/subtasks?status=done", "")
+				Expect(w.Body.String()).To(ContainSubstring("Pack boxes"))
+				Expect(w.Body.String()).NotTo(ContainSubstring("Book van"))
+
+				w = send("GET", "/users/"+userID+"/tasks/missing/subtasks", "")
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("should reject unknown parents and cycles", func() {
+				body, _ := json.Marshal(model.Task{Title: "Orphan", DueDate: "2025-08-09T15:04:05Z", Status: "pending", ParentID: "missing"})
+				w := send("POST", "/users/"+userID+"/tasks", string(body))
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"parent_id"`))
+				Expect(w.Body.String()).To(ContainSubstring("parent task not found"))
+
+				child := createTask("Pack boxes", parent.ID)
+				grandchild := createTask("Buy tape", child.ID)
+				for id, parentID := range map[string]string{parent.ID: grandchild.ID, child.ID: child.ID} {
+					w = send("PATCH", "/users/"+userID+"/tasks/"+id, `{"parent_id": "`+parentID+`"}`)
+					Expect(w.Code).To(Equal(http.StatusBadRequest))
+					Expect(w.Body.String()).To(ContainSubstring("cannot be a subtask of itself"))
+				}
+
+				w = send("PATCH", "/users/"+userID+"/tasks/"+grandchild.ID, `{"parent_id": ""}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(getTask(child.ID).Progress).To(BeNil())
+			})
+
+			It("should refuse a parent whose chain of parents already loops", func() {
+				child := createTask("Pack boxes", parent.ID)
+				// Only a store written to outside the API can hold such a loop
+				ctx := context.Background()
+				looped, err := testDB.GetTask(ctx, parent.ID)
+				Expect(err).NotTo(HaveOccurred())
+				looped.ParentID = child.ID
+				Expect(testDB.UpdateTask(ctx, looped)).To(Succeed())
+
+				other := createTask("Buy tape", "")
+				w := send("PATCH", "/users/"+userID+"/tasks/"+other.ID, `{"parent_id": "`+child.ID+`"}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("cannot be a subtask of itself"))
+			})
+
+			It("should not nest tasks under another user's task", func() {
+				otherID, otherToken := registerUser(router, "Alice", "alice@example.com")
+				token = otherToken
+				body, _ := json.Marshal(model.Task{Title: "Sneaky", DueDate: "2025-08-09T15:04:05Z", Status: "pending", ParentID: parent.ID})
+				w := send("POST", "/users/"+otherID+"/tasks", string(body))
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("parent task not found"))
+			})
+
+			It("should not finish a task while subtasks are open", func() {
+				child := createTask("Pack boxes", parent.ID)
+
+				w := send("PATCH", "/users/"+userID+"/tasks/"+parent.ID, `{"status": "done"}`)
+				Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"open_subtasks"`))
+				Expect(w.Body.String()).To(ContainSubstring(`"open_subtasks":1`))
+
+				Expect(send("PATCH", "/users/"+userID+"/tasks/"+child.ID, `{"status": "done"}`).Code).To(Equal(http.StatusOK))
+				w = send("PATCH", "/users/"+userID+"/tasks/"+parent.ID, `{"status": "done"}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"percent":100`))
+			})
+
+			It("should finish tasks with open subtasks if the workflow allows it", func() {
+				cfg := workflow.Default.Config()
+				cfg.AllowOpenSubtasks = true
+				wf, err := workflow.New(cfg)
+				Expect(err).NotTo(HaveOccurred())
+				engine := gin.New()
+				api.RegisterRoutes(engine, testDB, api.WithWorkflow(wf))
+				router = authorized{engine, &token}
+
+				createTask("Pack boxes", parent.ID)
+				w := send("PATCH", "/users/"+userID+"/tasks/"+parent.ID, `{"status": "done"}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Describe("Dependencies", func() {
+			send := func(method, path, body string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+			createTask := func(title string) model.Task {
+				body, _ := json.Marshal(model.Task{Title: title, DueDate: "2025-08-09T15:04:05Z", Status: "pending"})
+				w := send("POST", "/users/"+userID+"/tasks", string(body))
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var task model.Task
+				json.Unmarshal(w.Body.Bytes(), &task)
+				return task
+			}
+			getTask := func(id string) model.Task {
+				w := send("GET", "/users/"+userID+"/tasks/"+id, "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				var task model.Task
+				json.Unmarshal(w.Body.Bytes(), &task)
+				return task
+			}
+			addBlocker := func(taskID, blockerID string) *httptest.ResponseRecorder {
+				return send("POST", "/users/"+userID+"/tasks/"+taskID+"/dependencies", `{"blocker_id": "`+blockerID+`"}`)
+			}
+
+			var design, build model.Task
+
+			BeforeEach(func() {
+				design = createTask("Design")
+				build = createTask("Build")
+				Expect(build.Blocked).To(BeFalse())
+				w := addBlocker(build.ID, design.ID)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				Expect(w.Body.String()).To(ContainSubstring(`"blocker_id":"` + design.ID + `"`))
+			})
+
+			It("should flag tasks waiting for unfinished tasks as blocked", func() {
+				got := getTask(build.ID)
+				Expect(got.Blocked).To(BeTrue())
+				Expect(got.Version).To(BeNumerically(">", build.Version))
+				Expect(getTask(design.ID).Blocked).To(BeFalse())
+
+				w := send("GET", "/users/"+userID+"/tasks/"+build.ID+"/dependencies", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				var deps struct {
+					BlockedBy []model.Task `json:"blocked_by"`
+					Blocks    []model.Task `json:"blocks"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &deps)
+				Expect(deps.BlockedBy).To(HaveLen(1))
+				Expect(deps.BlockedBy[0].Title).To(Equal("Design"))
+				Expect(deps.Blocks).To(BeEmpty())
+
+				Expect(send("PATCH", "/users/"+userID+"/tasks/"+design.ID, `{"status": "done"}`).Code).To(Equal(http.StatusOK))
+				got = getTask(build.ID)
+				Expect(got.Blocked).To(BeFalse())
+			})
+
+			It("should not start or finish a blocked task", func() {
+				for _, status := range []string{"in_progress", "done"} {
+					w := send("PATCH", "/users/"+userID+"/tasks/"+build.ID, `{"status": "`+status+`"}`)
+					Expect(w.Code).To(Equal(http.StatusUnprocessableEntity), status)
+					Expect(w.Body.String()).To(ContainSubstring(`"code":"task_blocked"`))
+					Expect(w.Body.String()).To(ContainSubstring(`"open_blockers":1`))
+				}
+				w := send("POST", "/users/"+userID+"/tasks/bulk-status", `{"task_ids": ["`+design.ID+`", "`+build.ID+`"], "status": "in_progress"}`)
+				Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(getTask(design.ID).Status).To(Equal("pending"))
+
+				w = send("DELETE", "/users/"+userID+"/tasks/"+build.ID+"/dependencies/"+design.ID, "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(send("PATCH", "/users/"+userID+"/tasks/"+build.ID, `{"status": "in_progress"}`).Code).To(Equal(http.StatusOK))
+
+				w = send("DELETE", "/users/"+userID+"/tasks/"+build.ID+"/dependencies/"+design.ID, "")
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"dependency_not_found"`))
+			})
+
+			It("should reject cycles, duplicates and unknown blockers", func() {
+				test := createTask("Test")
+				Expect(addBlocker(test.ID, build.ID).Code).To(Equal(http.StatusCreated))
+
+				for taskID, blockerID := range map[string]string{design.ID: test.ID, build.ID: build.ID} {
+					w := addBlocker(taskID, blockerID)
+					Expect(w.Code).To(Equal(http.StatusBadRequest))
+					Expect(w.Body.String()).To(ContainSubstring(`"field":"blocker_id"`))
+					Expect(w.Body.String()).To(ContainSubstring("cannot depend on itself"))
+				}
+
+				w := addBlocker(build.ID, design.ID)
+				Expect(w.Code).To(Equal(http.StatusConflict))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"dependency_exists"`))
+
+				w = addBlocker(build.ID, "missing")
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("blocking task not found"))
+
+				w = send("POST", "/users/"+userID+"/tasks/"+build.ID+"/dependencies", `{}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("blocker_id is required"))
+			})
+
+			It("should unblock tasks when their blocker is deleted", func() {
+				Expect(send("DELETE", "/users/"+userID+"/tasks/"+design.ID, "").Code).To(Equal(http.StatusOK))
+				Expect(getTask(build.ID).Blocked).To(BeFalse())
+			})
+
+			It("should not let tasks wait for another user's tasks", func() {
+				otherID, otherToken := registerUser(router, "Alice", "alice@example.com")
+				token = otherToken
+				body, _ := json.Marshal(model.Task{Title: "Mine", DueDate: "2025-08-09T15:04:05Z", Status: "pending"})
+				w := send("POST", "/users/"+otherID+"/tasks", string(body))
+				var mine model.Task
+				json.Unmarshal(w.Body.Bytes(), &mine)
+
+				w = send("POST", "/users/"+otherID+"/tasks/"+mine.ID+"/dependencies", `{"blocker_id": "`+design.ID+`"}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("blocking task not found"))
+			})
+		})
+
+		Describe("Recurring tasks", func() {
+			send := func(method, path, body string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+			tasksPath := func() string { return "/users/" + userID + "/tasks" }
+			series := func(seriesID string) []model.Task {
+				w := send("GET", tasksPath()+"?series_id="+seriesID+"&sort=due_date", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				var page struct {
+					Items []model.Task `json:"items"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &page)
+				return page.Items
+			}
+
+			var chore model.Task
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(model.Task{Title: "Take out bins", DueDate: "2025-01-06T19:00:00Z", Status: "pending", Priority: "high",
+					Tags: []string{"home"}, Recurrence: "rrule:freq=weekly;byday=mo,th;count=3"})
+				w := send("POST", tasksPath(), string(body))
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				json.Unmarshal(w.Body.Bytes(), &chore)
+				Expect(chore.Recurrence).To(Equal("FREQ=WEEKLY;BYDAY=MO,TH;COUNT=3"))
+				Expect(chore.SeriesID).NotTo(BeEmpty())
+				Expect(chore.Occurrence).To(Equal(1))
+			})
+
+			It("should create the next occurrence when one is done", func() {
+				w := send("PATCH", tasksPath()+"/"+chore.ID, `{"status": "done"}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+
+				occurrences := series(chore.SeriesID)
+				Expect(occurrences).To(HaveLen(2))
+				next := occurrences[1]
+				Expect(next.DueDate).To(Equal("2025-01-09T19:00:00Z"))
+				Expect(next.Status).To(Equal("pending"))
+				Expect(next.Occurrence).To(Equal(2))
+				Expect(next.Priority).To(Equal("high"))
+				Expect(next.Tags).To(Equal([]string{"home"}))
+
+				// Reopening and finishing an occurrence again does not duplicate the next one
+				Expect(send("PATCH", tasksPath()+"/"+chore.ID, `{"status": "pending"}`).Code).To(Equal(http.StatusOK))
+				Expect(send("PATCH", tasksPath()+"/"+chore.ID, `{"status": "done"}`).Code).To(Equal(http.StatusOK))
+				Expect(series(chore.SeriesID)).To(HaveLen(2))
+
+				// The series ends after COUNT occurrences
+				Expect(send("PATCH", tasksPath()+"/"+next.ID, `{"status": "done"}`).Code).To(Equal(http.StatusOK))
+				last := series(chore.SeriesID)[2]
+				Expect(last.DueDate).To(Equal("2025-01-13T19:00:00Z"))
+				Expect(send("PATCH", tasksPath()+"/"+last.ID, `{"status": "done"}`).Code).To(Equal(http.StatusOK))
+				Expect(series(chore.SeriesID)).To(HaveLen(3))
+			})
+
+			It("should skip an occurrence", func() {
+				w := send("POST", tasksPath()+"/"+chore.ID+"/series/skip", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				var skipped model.Task
+				json.Unmarshal(w.Body.Bytes(), &skipped)
+				Expect(skipped.DueDate).To(Equal("2025-01-09T19:00:00Z"))
+				Expect(skipped.Occurrence).To(Equal(2))
+				Expect(series(chore.SeriesID)).To(HaveLen(1))
+
+				Expect(send("POST", tasksPath()+"/"+chore.ID+"/series/skip", "").Code).To(Equal(http.StatusOK))
+				w = send("POST", tasksPath()+"/"+chore.ID+"/series/skip", "")
+				Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"series_ended"`))
+			})
+
+			It("should edit and stop a series", func() {
+				w := send("PATCH", tasksPath()+"/"+chore.ID+"/series", `{"title": "Take out recycling", "recurrence": "FREQ=DAILY"}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"title":"Take out recycling"`))
+
+				w = send("PATCH", tasksPath()+"/"+chore.ID+"/series", `{"due_date": "2025-02-01T00:00:00Z"}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("due_date cannot be changed"))
+
+				Expect(send("PATCH", tasksPath()+"/"+chore.ID, `{"status": "done"}`).Code).To(Equal(http.StatusOK))
+				occurrences := series(chore.SeriesID)
+				Expect(occurrences).To(HaveLen(2))
+				Expect(occurrences[1].Title).To(Equal("Take out recycling"))
+				Expect(occurrences[1].DueDate).To(Equal("2025-01-07T19:00:00Z"))
+
+				w = send("POST", tasksPath()+"/"+chore.ID+"/series/stop", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"recurrence":""`))
+				Expect(send("PATCH", tasksPath()+"/"+occurrences[1].ID, `{"status": "done"}`).Code).To(Equal(http.StatusOK))
+				Expect(series(chore.SeriesID)).To(HaveLen(2))
+			})
+
+			It("should reject invalid rules and series operations on one-off tasks", func() {
+				body, _ := json.Marshal(model.Task{Title: "Hourly", DueDate: "2025-01-06T19:00:00Z", Status: "pending", Recurrence: "FREQ=HOURLY"})
+				w := send("POST", tasksPath(), string(body))
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"recurrence"`))
+				Expect(w.Body.String()).To(ContainSubstring("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY"))
+
+				body, _ = json.Marshal(model.Task{Title: "One-off", DueDate: "2025-01-06T19:00:00Z", Status: "pending"})
+				w = send("POST", tasksPath(), string(body))
+				var oneOff model.Task
+				json.Unmarshal(w.Body.Bytes(), &oneOff)
+				Expect(oneOff.SeriesID).To(BeEmpty())
+				w = send("POST", tasksPath()+"/"+oneOff.ID+"/series/skip", "")
+				Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"not_recurring"`))
+
+				w = send("PATCH", tasksPath()+"/"+chore.ID, `{"series_id": "mine"}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("series_id cannot be changed"))
+			})
+		})
+
+		Describe("Reminders", func() {
+			send := func(method, path, body string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest(method, "/users/"+userID+"/tasks"+path, bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			It("should schedule the first reminder before the due date", func() {
+				w := send("POST", "", `{"title": "Standup", "due_date": "2025-03-10T10:00:00+01:00", "status": "pending", "reminders": [15, 60]}`)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var task model.Task
+				json.Unmarshal(w.Body.Bytes(), &task)
+				Expect(task.Reminders).To(Equal([]int{60, 15}))
+				Expect(task.NextReminderAt).To(Equal("2025-03-10T08:00:00Z"))
+				Expect(task.OverdueAt).To(BeEmpty())
+
+				w = send("PATCH", "/"+task.ID, `{"due_date": "2025-03-11T09:00:00Z", "reminders": [1440]}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"next_reminder_at":"2025-03-10T09:00:00Z"`))
+
+				w = send("PATCH", "/"+task.ID, `{"reminders": null}`)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"reminders":[]`))
+				Expect(w.Body.String()).To(ContainSubstring(`"next_reminder_at":""`))
+			})
+
+			It("should reject invalid reminders and scheduler fields", func() {
+				w := send("POST", "", `{"title": "Standup", "due_date": "2025-03-10T10:00:00Z", "status": "pending", "reminders": [0]}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"reminders"`))
+
+				w = send("POST", "", `{"title": "Standup", "due_date": "2025-03-10T10:00:00Z", "status": "pending", "reminders": [1, 2, 3, 4, 5, 6]}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("at most 5 reminders"))
+
+				w = send("POST", "", `{"title": "Standup", "due_date": "2025-03-10T10:00:00Z", "status": "pending", "overdue_at": "2025-03-10T11:00:00Z"}`)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var task model.Task
+				json.Unmarshal(w.Body.Bytes(), &task)
+				Expect(task.OverdueAt).To(BeEmpty())
+
+				w = send("PATCH", "/"+task.ID, `{"next_reminder_at": "2025-03-10T09:00:00Z"}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("next_reminder_at cannot be changed"))
+			})
+		})
+
+		Describe("Webhooks", func() {
+			var receiver *httptest.Server
+			var received chan *http.Request
+			var bodies chan []byte
+
+			send := func(method, path, body string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest(method, "/users/"+userID+path, bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			BeforeEach(func() {
+				received, bodies = make(chan *http.Request, 10), make(chan []byte, 10)
+				receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, _ := io.ReadAll(r.Body)
+					received <- r
+					bodies <- body
+				}))
+				DeferCleanup(receiver.Close)
+			})
+
+			It("should manage webhooks and sign their deliveries", func() {
+				w := send("POST", "/webhooks", `{"url": "`+receiver.URL+`", "events": ["task.updated", "task.created", "task.created"], "secret": "0123456789abcdef"}`)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var hook struct {
+					model.Webhook
+					Secret string `json:"secret"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &hook)
+				Expect(hook.Events).To(Equal([]string{"task.created", "task.updated"}))
+				Expect(hook.Secret).To(Equal("0123456789abcdef"))
+
+				// The secret is only shown once
+				w = send("GET", "/webhooks/"+hook.ID, "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).NotTo(ContainSubstring("secret"))
+				w = send("GET", "/webhooks", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(hook.ID))
+
+				w = send("POST", "/tasks", `{"title": "Test Task", "due_date": "2025-12-31T10:00:00Z", "status": "pending"}`)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				Expect(webhook.NewDispatcher(testDB, webhook.WithGuard(&webhook.Guard{AllowPrivate: true})).DeliverPending(context.Background())).To(Succeed())
+				var req *http.Request
+				Eventually(received).Should(Receive(&req))
+				var body []byte
+				Eventually(bodies).Should(Receive(&body))
+				Expect(req.Header.Get(webhook.HeaderEvent)).To(Equal("task.created"))
+				mac := hmac.New(sha256.New, []byte("0123456789abcdef"))
+				mac.Write(body)
+				Expect(req.Header.Get(webhook.HeaderSignature)).To(Equal("sha256=" + hex.EncodeToString(mac.Sum(nil))))
+
+				w = send("GET", "/webhooks/"+hook.ID+"/deliveries?order=desc", "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				var deliveries struct {
+					Items []model.WebhookDelivery `json:"items"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &deliveries)
+				Expect(deliveries.Items).To(HaveLen(1))
+				Expect(deliveries.Items[0].Status).To(Equal(model.DeliverySucceeded))
+				Expect(deliveries.Items[0].ResponseStatus).To(Equal(http.StatusOK))
+				Expect(string(deliveries.Items[0].Payload)).To(Equal(string(body)))
+
+				w = send("DELETE", "/webhooks/"+hook.ID, "")
+				Expect(w.Code).To(Equal(http.StatusOK))
+				w = send("GET", "/webhooks/"+hook.ID+"/deliveries", "")
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+				Expect(w.Body.String()).To(ContainSubstring(`"code":"webhook_not_found"`))
+			})
+
+			It("should validate webhooks", func() {
+				w := send("POST", "/webhooks", `{"url": "ftp://example.com", "events": ["task.created"]}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"url"`))
+
+				w = send("POST", "/webhooks", `{"url": "https://example.com", "events": []}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"events"`))
+
+				w = send("POST", "/webhooks", `{"url": "https://example.com", "events": ["task.archived"]}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("invalid event"))
+
+				w = send("POST", "/webhooks", `{"url": "https://example.com", "events": ["task.created"], "secret": "short"}`)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring(`"field":"secret"`))
+
+				w = send("GET", "/webhooks/missing/deliveries", "")
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("should refuse webhooks to private addresses", func() {
+				guarded := gin.New()
+				api.RegisterRoutes(guarded, testDB, api.WithWebhookGuard(&webhook.Guard{Resolver: staticResolver{"10.0.0.5"}}))
+				for _, url := range []string{receiver.URL, "http://169.254.169.254/latest/meta-data/", "http://localhost:8080", "https://internal.example.com"} {
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/webhooks", bytes.NewBufferString(`{"url": "`+url+`", "events": ["task.created"]}`))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					authorized{guarded, &token}.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusBadRequest), url)
+					Expect(w.Body.String()).To(ContainSubstring(`"field":"url"`))
+					Expect(w.Body.String()).To(ContainSubstring("public address"))
+				}
+				Expect(testDB.ListWebhooks(context.Background(), userID)).To(BeEmpty())
+			})
+
+			It("should keep webhooks to their owner", func() {
+				w := send("POST", "/webhooks", `{"url": "https://example.com", "events": ["task.created"]}`)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var hook model.Webhook
+				json.Unmarshal(w.Body.Bytes(), &hook)
+
+				memberID, memberToken := registerUser(router, "Bob", "bob@example.com")
+				for _, path := range []string{"/users/" + userID + "/webhooks", "/users/" + userID + "/webhooks/" + hook.ID} {
+					req, _ := http.NewRequest("GET", path, nil)
+					req.Header.Set("Authorization", "Bearer "+memberToken)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusForbidden))
+					Expect(w.Body.String()).To(ContainSubstring("not allowed to manage these webhooks"))
+				}
+				req, _ := http.NewRequest("GET", "/users/"+memberID+"/webhooks/"+hook.ID, nil)
+				req.Header.Set("Authorization", "Bearer "+memberToken)
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Describe("Error responses", func() {
+			// problem is the RFC 7807 body of every error response
+			type problem struct {
+				Type     string `json:"type"`
+				Title    string `json:"title"`
+				Status   int    `json:"status"`
+				Detail   string `json:"detail"`
+				Instance string `json:"instance"`
+				Code     string `json:"code"`
+				Errors   []struct {
+					Field   string `json:"field"`
+					Message string `json:"message"`
+				} `json:"errors"`
+				TaskCount int `json:"task_count"`
+			}
+			decode := func(w *httptest.ResponseRecorder) problem {
+				Expect(w.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+				var p problem
+				Expect(json.Unmarshal(w.Body.Bytes(), &p)).To(Succeed())
+				Expect(p.Status).To(Equal(w.Code))
+				return p
+			}
+
+			It("should describe invalid fields", func() {
+				body := []byte(`{"title": "Test Task", "due_date": "2025-08-09T15:04:05Z", "status": "bad_status"}`)
+				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				p := decode(w)
+				Expect(p.Type).To(Equal("about:blank"))
+				Expect(p.Title).To(Equal("Bad Request"))
+				Expect(p.Code).To(Equal("validation_failed"))
+				Expect(p.Instance).To(Equal("/users/" + userID + "/tasks"))
+				Expect(p.Errors).To(HaveLen(1))
+				Expect(p.Errors[0].Field).To(Equal("status"))
+				Expect(p.Errors[0].Message).To(Equal("invalid status: must be one of pending, in_progress, done"))
+			})
+
+			It("should report missing resources as 404", func() {
+				req, _ := http.NewRequest("PUT", "/users/"+userID+"/tasks/non-existent-id",
+					bytes.NewBufferString(`{"title": "Test Task", "due_date": "2025-08-09T15:04:05Z", "status": "pending"}`))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusNotFound))
+				Expect(decode(w).Code).To(Equal("task_not_found"))
+			})
+
+			It("should add details specific to the error", func() {
+				memberID, memberToken := registerUser(router, "Bob", "bob@example.com")
+				req, _ := http.NewRequest("POST", "/users/"+memberID+"/tasks",
+					bytes.NewBufferString(`{"title": "Bob's Task", "due_date": "2025-08-09T15:04:05Z", "status": "pending"}`))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+memberToken)
+				router.ServeHTTP(httptest.NewRecorder(), req)
+
+				req, _ = http.NewRequest("DELETE", "/users/"+memberID, nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusConflict))
+				p := decode(w)
+				Expect(p.Code).To(Equal("user_has_tasks"))
+				Expect(p.TaskCount).To(Equal(1))
+			})
+
+			It("should report authentication and authorization failures", func() {
+				req, _ := http.NewRequest("GET", "/users", nil)
+				req.Header.Set("Authorization", "Bearer nonsense")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusUnauthorized))
+				Expect(decode(w).Code).To(Equal("unauthorized"))
+
+				_, memberToken := registerUser(router, "Bob", "bob@example.com")
+				req, _ = http.NewRequest("GET", "/users", nil)
+				req.Header.Set("Authorization", "Bearer "+memberToken)
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusForbidden))
+				Expect(decode(w).Code).To(Equal("forbidden"))
+			})
 		})
 
-		It("should not create a user with missing fields", func() {
-			user := model.User{Name: "", Email: ""}
-			userJson, _ := json.Marshal(user)
-			req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(userJson))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusBadRequest))
-		})
+		Describe("Authentication", func() {
+			It("should register every user as a member", func() {
+				// Even the first one
+				fresh := gin.New()
+				freshDB := open()
+				DeferCleanup(freshDB.Close)
+				api.RegisterRoutes(fresh, freshDB)
+				firstID, firstToken := registerUser(fresh, "Alice", "alice@example.com")
+				req, _ := http.NewRequest("GET", "/users/"+firstID, nil)
+				req.Header.Set("Authorization", "Bearer "+firstToken)
+				w := httptest.NewRecorder()
+				fresh.ServeHTTP(w, req)
+				Expect(w.Body.String()).To(ContainSubstring(`"role":"member"`))
 
-		It("should not create a user with too short name", func() {
-			user := model.User{Name: "A", Email: "short@example.com"}
-			userJson, _ := json.Marshal(user)
-			req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(userJson))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusBadRequest))
-			Expect(w.Body.String()).To(ContainSubstring("name must be between 2 and 50 characters"))
-		})
+				otherID, otherToken := registerUser(router, "Bob", "bob@example.com")
+				req, _ = http.NewRequest("GET", "/users/"+otherID, nil)
+				req.Header.Set("Authorization", "Bearer "+otherToken)
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Body.String()).To(ContainSubstring(`"role":"member"`))
+			})
 
-		It("should not create a user with too long name", func() {
-			longName := ""
-			for i := 0; i < 51; i++ {
-				longName += "a"
-			}
-			user := model.User{Name: longName, Email: "long@example.com"}
-			userJson, _ := json.Marshal(user)
-			req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(userJson))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusBadRequest))
-			Expect(w.Body.String()).To(ContainSubstring("name must be between 2 and 50 characters"))
-		})
+			It("should reject requests without a valid token", func() {
+				token = ""
+				for _, header := range []string{"", "Bearer", "Bearer tm_bogus", "Basic dXNlcjpwYXNz"} {
+					req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks", nil)
+					if header != "" {
+						req.Header.Set("Authorization", header)
+					}
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusUnauthorized), header)
+					Expect(w.Header().Get("WWW-Authenticate")).To(Equal("Bearer"))
+				}
+			})
 
-		It("should get a user by ID", func() {
-			req, _ := http.NewRequest("GET", "/users/"+userID, nil)
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusOK))
-			Expect(w.Body.String()).To(ContainSubstring("Test User"))
-		})
+			It("should only let members reach their own routes", func() {
+				otherID, otherToken := registerUser(router, "Bob", "bob@example.com")
+				for _, path := range []string{"/users/" + userID, "/users/" + userID + "/tasks", "/users/" + userID + "/tokens"} {
+					req, _ := http.NewRequest("GET", path, nil)
+					req.Header.Set("Authorization", "Bearer "+otherToken)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusForbidden), path)
+				}
 
-		It("should return 404 for non-existent user", func() {
-			req, _ := http.NewRequest("GET", "/users/non-existent-id", nil)
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusNotFound))
-		})
+				req, _ := http.NewRequest("GET", "/users/"+otherID+"/tasks", nil)
+				req.Header.Set("Authorization", "Bearer "+otherToken)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
 
-		It("should list users", func() {
-			req, _ := http.NewRequest("GET", "/users", nil)
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusOK))
-			Expect(w.Body.String()).To(ContainSubstring("Test User"))
-		})
+				// An admin may act for anyone
+				req, _ = http.NewRequest("GET", "/users/"+otherID+"/tasks", nil)
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+			})
 
-		It("should delete a user", func() {
-			req, _ := http.NewRequest("DELETE", "/users/"+userID, nil)
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusOK))
-		})
+			It("should create, list and revoke API tokens", func() {
+				req, _ := http.NewRequest("POST", "/users/"+userID+"/tokens", bytes.NewBufferString(`{"name": "laptop"}`))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var created struct {
+					ID    string `json:"id"`
+					Token string `json:"token"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &created)
+				Expect(created.Token).To(HavePrefix("tm_"))
 
-		It("should return error when deleting non-existent user", func() {
-			req, _ := http.NewRequest("DELETE", "/users/non-existent-id", nil)
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusInternalServerError))
-		})
-	})
+				req, _ = http.NewRequest("GET", "/users/"+userID+"/tokens", nil)
+				req.Header.Set("Authorization", "Bearer "+created.Token)
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"name":"laptop"`))
+				Expect(w.Body.String()).NotTo(ContainSubstring(created.Token))
 
-	Describe("Task API", func() {
-		var taskID string
+				req, _ = http.NewRequest("DELETE", "/users/"+userID+"/tokens/"+created.ID, nil)
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
 
-		It("should create a task", func() {
-			task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
-			jsonData, _ := json.Marshal(task)
-			req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusCreated))
-			Expect(w.Body.String()).To(ContainSubstring("Test Task"))
-			var createdTask model.Task
-			json.Unmarshal(w.Body.Bytes(), &createdTask)
-			taskID = createdTask.ID
+				req, _ = http.NewRequest("GET", "/users/"+userID+"/tokens", nil)
+				req.Header.Set("Authorization", "Bearer "+created.Token)
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			})
 		})
 
-		It("should not create a task with missing title", func() {
-			task := model.Task{Title: "", Description: "desc"}
-			jsonData, _ := json.Marshal(task)
-			req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusBadRequest))
-		})
+		Describe("Roles", func() {
+			var memberID, memberToken string
 
-		It("should not create a task with invalid status", func() {
-			task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "invalid_status"}
-			jsonData, _ := json.Marshal(task)
-			req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusBadRequest))
-			Expect(w.Body.String()).To(ContainSubstring("invalid status"))
-		})
+			setRole := func(id, role string) *httptest.ResponseRecorder {
+				req, _ := http.NewRequest("PUT", "/users/"+id+"/role", bytes.NewBufferString(`{"role": "`+role+`"}`))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
 
-		It("should not create a task with too long description", func() {
-			longDesc := ""
-			for i := 0; i < 201; i++ {
-				longDesc += "a"
+			asMember := func(method, path, body string) int {
+				req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+memberToken)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w.Code
 			}
-			task := model.Task{Title: "Test Task", Description: longDesc, DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
-			jsonData, _ := json.Marshal(task)
-			req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusBadRequest))
-			Expect(w.Body.String()).To(ContainSubstring("description must be at most 200 characters"))
-		})
 
-		It("should not create a task with invalid due_date", func() {
-			task := model.Task{Title: "Test Task", Description: "desc", DueDate: "not-a-date", Status: "pending"}
-			jsonData, _ := json.Marshal(task)
-			req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			router.ServeHTTP(w, req)
-			Expect(w.Code).To(Equal(http.StatusBadRequest))
-			Expect(w.Body.String()).To(ContainSubstring("due_date must be ISO 8601 format"))
+			BeforeEach(func() {
+				memberID, memberToken = registerUser(router, "Bob", "bob@example.com")
+			})
+
+			It("should keep user management to admins", func() {
+				Expect(asMember("GET", "/users", "")).To(Equal(http.StatusForbidden))
+				Expect(asMember("DELETE", "/users/"+memberID, "")).To(Equal(http.StatusForbidden))
+				Expect(asMember("PUT", "/users/"+memberID+"/role", `{"role": "admin"}`)).To(Equal(http.StatusForbidden))
+
+				req, _ := http.NewRequest("GET", "/users", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring("Bob"))
+			})
+
+			It("should let read-only users view but not change their tasks", func() {
+				task := `{"title": "Test Task", "due_date": "2025-12-31T10:00:00Z", "status": "pending"}`
+				Expect(asMember("POST", "/users/"+memberID+"/tasks", task)).To(Equal(http.StatusCreated))
+
+				w := setRole(memberID, model.RoleReadOnly)
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(ContainSubstring(`"role":"read_only"`))
+
+				Expect(asMember("GET", "/users/"+memberID+"/tasks", "")).To(Equal(http.StatusOK))
+				Expect(asMember("GET", "/users/"+memberID, "")).To(Equal(http.StatusOK))
+				Expect(asMember("POST", "/users/"+memberID+"/tasks", task)).To(Equal(http.StatusForbidden))
+			})
+
+			It("should validate role changes", func() {
+				Expect(setRole(memberID, "superuser").Code).To(Equal(http.StatusBadRequest))
+				Expect(setRole("non-existent-id", model.RoleMember).Code).To(Equal(http.StatusNotFound))
+				Expect(setRole(userID, model.RoleMember).Code).To(Equal(http.StatusConflict))
+
+				// Once there is another admin the first one may step down
+				Expect(setRole(memberID, model.RoleAdmin).Code).To(Equal(http.StatusOK))
+				Expect(setRole(userID, model.RoleMember).Code).To(Equal(http.StatusOK))
+				Expect(asMember("GET", "/users", "")).To(Equal(http.StatusOK))
+			})
 		})
 
-		Context("with a created task", func() {
-			BeforeEach(func() {
-				task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-09-02T15:04:05Z", Status: "pending"}
-				jsonData, _ := json.Marshal(task)
-				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+		Describe("Sessions", func() {
+			var session model.Session
+
+			login := func(email, password string) *httptest.ResponseRecorder {
+				body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+				req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
 				req.Header.Set("Content-Type", "application/json")
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
-				var createdTask model.Task
-				json.Unmarshal(w.Body.Bytes(), &createdTask)
-				taskID = createdTask.ID
-			})
+				return w
+			}
 
-			It("should list tasks for a user", func() {
+			refresh := func(refreshToken string) *httptest.ResponseRecorder {
+				body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+				req, _ := http.NewRequest("POST", "/auth/refresh", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			getTasks := func(accessToken string) int {
 				req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks", nil)
+				req.Header.Set("Authorization", "Bearer "+accessToken)
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			BeforeEach(func() {
+				w := login("test@example.com", testPassword)
 				Expect(w.Code).To(Equal(http.StatusOK))
-				Expect(w.Body.String()).To(ContainSubstring("Test Task"))
+				session = model.Session{}
+				json.Unmarshal(w.Body.Bytes(), &session)
+				Expect(session.TokenType).To(Equal("Bearer"))
+				Expect(session.ExpiresIn).To(Equal(900))
 			})
 
-			It("should list tasks with filter", func() {
-				req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks?status=pending", nil)
-				w := httptest.NewRecorder()
-				router.ServeHTTP(w, req)
+			It("should authenticate requests with the access token", func() {
+				Expect(getTasks(session.AccessToken)).To(Equal(http.StatusOK))
+				// A refresh token is not an access token
+				Expect(getTasks(session.RefreshToken)).To(Equal(http.StatusUnauthorized))
+				Expect(getTasks(session.AccessToken + "x")).To(Equal(http.StatusUnauthorized))
+			})
+
+			It("should ignore the case of the email", func() {
+				Expect(login(" Test@Example.COM", testPassword).Code).To(Equal(http.StatusOK))
+			})
+
+			It("should reject wrong credentials", func() {
+				Expect(login("test@example.com", "wrong password").Code).To(Equal(http.StatusUnauthorized))
+				Expect(login("nobody@example.com", testPassword).Code).To(Equal(http.StatusUnauthorized))
+				Expect(login("", "").Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("should rotate refresh tokens", func() {
+				w := refresh(session.RefreshToken)
 				Expect(w.Code).To(Equal(http.StatusOK))
-				Expect(w.Body.String()).To(ContainSubstring("Test Task"))
+				var next model.Session
+				json.Unmarshal(w.Body.Bytes(), &next)
+				Expect(getTasks(next.AccessToken)).To(Equal(http.StatusOK))
+
+				// Each refresh token may only be used once
+				Expect(refresh(session.RefreshToken).Code).To(Equal(http.StatusUnauthorized))
+				Expect(refresh(session.AccessToken).Code).To(Equal(http.StatusUnauthorized))
 			})
 
-			It("should get a task by ID", func() {
-				req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks/"+taskID, nil)
+			It("should revoke the session on logout", func() {
+				body, _ := json.Marshal(map[string]string{"refresh_token": session.RefreshToken})
+				req, _ := http.NewRequest("POST", "/auth/logout", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+session.AccessToken)
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
-				Expect(w.Code).To(Equal(http.StatusOK))
-				Expect(w.Body.String()).To(ContainSubstring("Test Task"))
+				Expect(w.Code).To(Equal(http.StatusNoContent))
+
+				Expect(getTasks(session.AccessToken)).To(Equal(http.StatusUnauthorized))
+				Expect(refresh(session.RefreshToken).Code).To(Equal(http.StatusUnauthorized))
 			})
 
-			It("should return 404 for non-existent task", func() {
-				req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks/non-existent-id", nil)
+			It("should not log out an API token", func() {
+				req, _ := http.NewRequest("POST", "/auth/logout", nil)
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
-				Expect(w.Code).To(Equal(http.StatusNotFound))
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
 			})
+		})
 
-			It("should update a task", func() {
-				updatedTask := model.Task{Title: "Updated Task", Description: "Updated desc", DueDate: "2025-08-09T15:04:05Z", Status: "done"}
-				updatedJson, _ := json.Marshal(updatedTask)
-				req, _ := http.NewRequest("PUT", "/users/"+userID+"/tasks/"+taskID, bytes.NewBuffer(updatedJson))
+		Describe("User deletion with tasks", func() {
+			var memberID string
+
+			BeforeEach(func() {
+				memberID, _ = registerUser(router, "Bob", "bob@example.com")
+				task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
+				jsonData, _ := json.Marshal(task)
+				req, _ := http.NewRequest("POST", "/users/"+memberID+"/tasks", bytes.NewBuffer(jsonData))
 				req.Header.Set("Content-Type", "application/json")
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
-				fmt.Println(w.Body.String())
+				Expect(w.Code).To(Equal(http.StatusCreated))
+			})
+
+			It("should refuse to delete a user who owns tasks", func() {
+				req, _ := http.NewRequest("DELETE", "/users/"+memberID, nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusConflict))
+				Expect(w.Body.String()).To(ContainSubstring(`"task_count":1`))
+			})
+
+			It("should delete a user and their tasks with cascade", func() {
+				req, _ := http.NewRequest("DELETE", "/users/"+memberID+"?cascade=true", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
 				Expect(w.Code).To(Equal(http.StatusOK))
-				Expect(w.Body.String()).To(ContainSubstring("Updated Task"))
+
+				tasks, _, err := testDB.ListTasks(context.Background(), memberID, db.TaskQuery{})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(BeEmpty())
+			})
+
+			It("should reject an invalid cascade value", func() {
+				req, _ := http.NewRequest("DELETE", "/users/"+memberID+"?cascade=maybe", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
 			})
+		})
+
+		Describe("Task API", func() {
+			var taskID string
 
-			It("should not update a task with invalid status", func() {
-				// Create a valid task first
+			It("should create a task", func() {
 				task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
 				jsonData, _ := json.Marshal(task)
 				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
 				req.Header.Set("Content-Type", "application/json")
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				Expect(w.Body.String()).To(ContainSubstring("Test Task"))
 				var createdTask model.Task
 				json.Unmarshal(w.Body.Bytes(), &createdTask)
+				taskID = createdTask.ID
+			})
 
-				// Update the task with valid status
-				updatedTask := model.Task{Status: "in_progress"}
-				updatedJson, _ := json.Marshal(updatedTask)
-				req, _ = http.NewRequest("PUT", "/users/"+userID+"/tasks/"+createdTask.ID, bytes.NewBuffer(updatedJson))
+			It("should not let clients set timestamps", func() {
+				for _, body := range []string{
+					`{"title": "Test Task", "due_date": "2025-12-31T10:00:00Z", "status": "pending", "created_at": "2020-01-01T00:00:00Z"}`,
+					`{"title": "Test Task", "due_date": "2025-12-31T10:00:00Z", "status": "pending", "updated_at": "2020-01-01T00:00:00Z"}`,
+				} {
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBufferString(body))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusBadRequest), body)
+				}
+				req, _ := http.NewRequest("POST", "/users", bytes.NewBufferString(`{"name": "Alice", "email": "alice@example.com", "created_at": "2020-01-01T00:00:00Z"}`))
 				req.Header.Set("Content-Type", "application/json")
-				w = httptest.NewRecorder()
+				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
-				Expect(w.Code).To(Equal(http.StatusOK))
-				Expect(w.Body.String()).To(ContainSubstring("in_progress"))
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+			})
+
+			It("should not create a task with missing title", func() {
+				task := model.Task{Title: "", Description: "desc"}
+				jsonData, _ := json.Marshal(task)
+				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+			})
 
-				// Try to update with invalid status
-				updatedTask = model.Task{Status: "bad_status"}
-				updatedJson, _ = json.Marshal(updatedTask)
-				req, _ = http.NewRequest("PUT", "/users/"+userID+"/tasks/"+createdTask.ID, bytes.NewBuffer(updatedJson))
+			It("should report every invalid field at once", func() {
+				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBufferString(`{"title": "x", "due_date": "soon", "status": "later"}`))
 				req.Header.Set("Content-Type", "application/json")
-				w = httptest.NewRecorder()
+				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
 				Expect(w.Code).To(Equal(http.StatusBadRequest))
-				Expect(w.Body.String()).To(ContainSubstring("invalid status"))
+				var p struct {
+					Errors []struct {
+						Field string `json:"field"`
+					} `json:"errors"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &p)
+				Expect(p.Errors).To(HaveLen(3))
+				Expect(p.Errors[0].Field).To(Equal("title"))
+				Expect(p.Errors[1].Field).To(Equal("due_date"))
+				Expect(p.Errors[2].Field).To(Equal("status"))
 			})
 
-			It("should not update a task with invalid due_date", func() {
-				// Create a valid task first
-				task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
-				jsonData, _ := json.Marshal(task)
-				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+			It("should trim task fields and collapse whitespace in the title", func() {
+				body := []byte(`{"title": "  Plan \n  launch  ", "description": " notes ", "due_date": "2025-12-31T10:00:00Z ", "status": " pending"}`)
+				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(body))
 				req.Header.Set("Content-Type", "application/json")
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
-				var createdTask model.Task
-				json.Unmarshal(w.Body.Bytes(), &createdTask)
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				var created model.Task
+				json.Unmarshal(w.Body.Bytes(), &created)
+				Expect(created.Title).To(Equal("Plan launch"))
+				Expect(created.Description).To(Equal("notes"))
+				Expect(created.Status).To(Equal("pending"))
 
-				// Try to update with invalid due_date
-				updatedTask := model.Task{Title: "Updated Task", Description: "desc", DueDate: "not-a-date", Status: "pending"}
-				updatedJson, _ := json.Marshal(updatedTask)
-				req, _ = http.NewRequest("PUT", "/users/"+userID+"/tasks/"+createdTask.ID, bytes.NewBuffer(updatedJson))
+				req, _ = http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBufferString(`{"title": "  a  ", "due_date": "2025-12-31T10:00:00Z", "status": "pending"}`))
 				req.Header.Set("Content-Type", "application/json")
 				w = httptest.NewRecorder()
 				router.ServeHTTP(w, req)
 				Expect(w.Code).To(Equal(http.StatusBadRequest))
-				Expect(w.Body.String()).To(ContainSubstring("due_date must be ISO 8601 format"))
 			})
 
-			It("should not update a task with no fields", func() {
-				// Create a valid task first
-				task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
+			It("should not create a task with invalid status", func() {
+				task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "invalid_status"}
 				jsonData, _ := json.Marshal(task)
 				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
 				req.Header.Set("Content-Type", "application/json")
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
-				var createdTask model.Task
-				json.Unmarshal(w.Body.Bytes(), &createdTask)
-				// Try to update with no fields
-				updatedTask := model.Task{}
-				updatedJson, _ := json.Marshal(updatedTask)
-				req, _ = http.NewRequest("PUT", "/users/"+userID+"/tasks/"+createdTask.ID, bytes.NewBuffer(updatedJson))
-				req.Header.Set("Content-Type", "application/json")
-				w = httptest.NewRecorder()
-				router.ServeHTTP(w, req)
 				Expect(w.Code).To(Equal(http.StatusBadRequest))
-				Expect(w.Body.String()).To(ContainSubstring("at least one field must be updated"))
+				Expect(w.Body.String()).To(ContainSubstring("invalid status"))
 			})
 
-			It("should delete a task", func() {
-				req, _ := http.NewRequest("DELETE", "/users/"+userID+"/tasks/"+taskID, nil)
+			It("should not create a task with too long description", func() {
+				longDesc := ""
+				for i := 0; i < 201; i++ {
+					longDesc += "a"
+				}
+				task := model.Task{Title: "Test Task", Description: longDesc, DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
+				jsonData, _ := json.Marshal(task)
+				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+				req.Header.Set("Content-Type", "application/json")
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
-				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("description must be at most 200 characters"))
 			})
 
-			It("should return error when deleting non-existent task", func() {
-				req, _ := http.NewRequest("DELETE", "/users/"+userID+"/tasks/non-existent-id", nil)
+			It("should not create a task with invalid due_date", func() {
+				task := model.Task{Title: "Test Task", Description: "desc", DueDate: "not-a-date", Status: "pending"}
+				jsonData, _ := json.Marshal(task)
+				req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+				req.Header.Set("Content-Type", "application/json")
 				w := httptest.NewRecorder()
 				router.ServeHTTP(w, req)
-				Expect(w.Code).To(Equal(http.StatusInternalServerError))
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(w.Body.String()).To(ContainSubstring("due_date must be ISO 8601 format"))
+			})
+
+			Context("with a created task", func() {
+				BeforeEach(func() {
+					task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-09-02T15:04:05Z", Status: "pending"}
+					jsonData, _ := json.Marshal(task)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					var createdTask model.Task
+					json.Unmarshal(w.Body.Bytes(), &createdTask)
+					taskID = createdTask.ID
+				})
+
+				It("should list tasks for a user", func() {
+					req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks", nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					Expect(w.Body.String()).To(ContainSubstring("Test Task"))
+				})
+
+				It("should list tasks with filter", func() {
+					req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks?status=pending", nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					Expect(w.Body.String()).To(ContainSubstring("Test Task"))
+				})
+
+				It("should page through tasks with a cursor", func() {
+					task := model.Task{Title: "Another Task", Description: "desc", DueDate: "2025-09-03T15:04:05Z", Status: "pending"}
+					jsonData, _ := json.Marshal(task)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+					req.Header.Set("Content-Type", "application/json")
+					router.ServeHTTP(httptest.NewRecorder(), req)
+
+					req, _ = http.NewRequest("GET", "/users/"+userID+"/tasks?limit=1&sort=title&order=desc", nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					var page struct {
+						Items      []model.Task `json:"items"`
+						NextCursor string       `json:"next_cursor"`
+					}
+					json.Unmarshal(w.Body.Bytes(), &page)
+					Expect(page.Items).To(HaveLen(1))
+					Expect(page.Items[0].Title).To(Equal("Test Task"))
+					Expect(page.NextCursor).NotTo(BeEmpty())
+
+					req, _ = http.NewRequest("GET", "/users/"+userID+"/tasks?limit=1&sort=title&order=desc&cursor="+page.NextCursor, nil)
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					page.NextCursor = ""
+					json.Unmarshal(w.Body.Bytes(), &page)
+					Expect(page.Items).To(HaveLen(1))
+					Expect(page.Items[0].Title).To(Equal("Another Task"))
+					Expect(page.NextCursor).To(BeEmpty())
+				})
+
+				It("should combine list filters", func() {
+					task := model.Task{Title: "Old Report", Description: "overdue report", DueDate: "2020-01-01T00:00:00Z", Status: "in_progress"}
+					jsonData, _ := json.Marshal(task)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+					req.Header.Set("Content-Type", "application/json")
+					router.ServeHTTP(httptest.NewRecorder(), req)
+
+					req, _ = http.NewRequest("GET", "/users/"+userID+"/tasks?overdue=true&status=pending,in_progress&q=REPORT", nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					Expect(w.Body.String()).To(ContainSubstring("Old Report"))
+					Expect(w.Body.String()).NotTo(ContainSubstring("Test Task"))
+
+					req, _ = http.NewRequest("GET", "/users/"+userID+"/tasks?status=pending&status=done&due_after=2025-01-01T00:00:00Z", nil)
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Body.String()).To(ContainSubstring("Test Task"))
+					Expect(w.Body.String()).NotTo(ContainSubstring("Old Report"))
+				})
+
+				It("should filter and sort tasks by priority", func() {
+					for title, priority := range map[string]string{"Urgent Task": "urgent", "Low Task": "low"} {
+						task := model.Task{Title: title, DueDate: "2025-09-03T15:04:05Z", Status: "pending", Priority: priority}
+						jsonData, _ := json.Marshal(task)
+						req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+						req.Header.Set("Content-Type", "application/json")
+						w := httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						Expect(w.Code).To(Equal(http.StatusCreated))
+					}
+
+					req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks?sort=priority&order=desc", nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					var page struct {
+						Items []model.Task `json:"items"`
+					}
+					json.Unmarshal(w.Body.Bytes(), &page)
+					Expect(page.Items).To(HaveLen(3))
+					Expect([]string{page.Items[0].Title, page.Items[1].Title, page.Items[2].Title}).To(Equal([]string{"Urgent Task", "Test Task", "Low Task"}))
+					Expect(page.Items[1].Priority).To(Equal("medium"))
+
+					req, _ = http.NewRequest("GET", "/users/"+userID+"/tasks?priority=low,medium", nil)
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Body.String()).To(ContainSubstring("Low Task"))
+					Expect(w.Body.String()).To(ContainSubstring("Test Task"))
+					Expect(w.Body.String()).NotTo(ContainSubstring("Urgent Task"))
+
+					req, _ = http.NewRequest("GET", "/users/"+userID+"/tasks?priority=low,%20medium&status=pending,%20done", nil)
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					Expect(w.Body.String()).To(ContainSubstring("Low Task"))
+					Expect(w.Body.String()).To(ContainSubstring("Test Task"))
+				})
+
+				It("should change the priority of a task", func() {
+					req, _ := http.NewRequest("PATCH", "/users/"+userID+"/tasks/"+taskID, bytes.NewBufferString(`{"priority": "high"}`))
+					req.Header.Set("Content-Type", "application/merge-patch+json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					Expect(w.Body.String()).To(ContainSubstring(`"priority":"high"`))
+
+					req, _ = http.NewRequest("PATCH", "/users/"+userID+"/tasks/"+taskID, bytes.NewBufferString(`{"priority": "whenever"}`))
+					req.Header.Set("Content-Type", "application/merge-patch+json")
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusBadRequest))
+					Expect(w.Body.String()).To(ContainSubstring("invalid priority: must be one of low, medium, high, urgent"))
+				})
+
+				It("should reject invalid filters", func() {
+					for _, query := range []string{"status=bad_status", "priority=asap", "due_before=tomorrow", "due_after=2025-13-01", "updated_since=yesterday", "overdue=maybe"} {
+						req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks?"+query, nil)
+						w := httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						Expect(w.Code).To(Equal(http.StatusBadRequest), query)
+					}
+
+					req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks?updated_since=x&due_after=x&due_before=x", nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusBadRequest))
+					Expect(w.Body.String()).To(ContainSubstring("due_before must be ISO 8601 format (RFC3339); due_after must be ISO 8601 format (RFC3339); updated_since must be ISO 8601 format (RFC3339)"))
+				})
+
+				It("should reject invalid pagination parameters", func() {
+					for _, query := range []string{"limit=0", "limit=abc", "sort=description", "order=sideways", "cursor=bogus"} {
+						req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks?"+query, nil)
+						w := httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						Expect(w.Code).To(Equal(http.StatusBadRequest), query)
+					}
+				})
+
+				It("should search tasks", func() {
+					task := model.Task{Title: "Quarterly report", Description: "numbers for the board", DueDate: "2025-09-03T15:04:05Z", Status: "pending"}
+					jsonData, _ := json.Marshal(task)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+					req.Header.Set("Content-Type", "application/json")
+					router.ServeHTTP(httptest.NewRecorder(), req)
+
+					req, _ = http.NewRequest("GET", "/users/"+userID+"/tasks/search?q=quart+num", nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					var page struct {
+						Items []model.TaskSearchResult `json:"items"`
+					}
+					json.Unmarshal(w.Body.Bytes(), &page)
+					Expect(page.Items).To(HaveLen(1))
+					Expect(page.Items[0].Title).To(Equal("Quarterly report"))
+					Expect(page.Items[0].TitleSnippet).To(Equal("<mark>Quarterly</mark> report"))
+				})
+
+				It("should ignore case outside of ASCII when filtering and searching", func() {
+					task := model.Task{Title: "Été au chalet", Description: "Skilift reservieren für Ölberg", DueDate: "2025-09-03T15:04:05Z", Status: "pending"}
+					jsonData, _ := json.Marshal(task)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+					req.Header.Set("Content-Type", "application/json")
+					router.ServeHTTP(httptest.NewRecorder(), req)
+
+					for _, path := range []string{"/tasks", "/tasks/search"} {
+						for _, text := range []string{"été", "ÉTÉ", "ölberg", "ÖLBERG"} {
+							req, _ = http.NewRequest("GET", "/users/"+userID+path+"?q="+url.QueryEscape(text), nil)
+							w := httptest.NewRecorder()
+							router.ServeHTTP(w, req)
+							Expect(w.Code).To(Equal(http.StatusOK), path+" "+text)
+							Expect(w.Body.String()).To(ContainSubstring("au chalet"), path+" "+text)
+						}
+					}
+				})
+
+				It("should reject a search without terms", func() {
+					for _, query := range []string{"", "q=", "q=%20-%20", "q=task&limit=0"} {
+						req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks/search?"+query, nil)
+						w := httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						Expect(w.Code).To(Equal(http.StatusBadRequest), query)
+					}
+				})
+
+				It("should get a task by ID", func() {
+					req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks/"+taskID, nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					Expect(w.Body.String()).To(ContainSubstring("Test Task"))
+				})
+
+				It("should return 404 for non-existent task", func() {
+					req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks/non-existent-id", nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusNotFound))
+				})
+
+				It("should update a task", func() {
+					updatedTask := model.Task{Title: "Updated Task", Description: "Updated desc", DueDate: "2025-08-09T15:04:05Z", Status: "done"}
+					updatedJson, _ := json.Marshal(updatedTask)
+					req, _ := http.NewRequest("PUT", "/users/"+userID+"/tasks/"+taskID, bytes.NewBuffer(updatedJson))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					fmt.Println(w.Body.String())
+					Expect(w.Code).To(Equal(http.StatusOK))
+					Expect(w.Body.String()).To(ContainSubstring("Updated Task"))
+				})
+
+				It("should not update a task with invalid status", func() {
+					// Create a valid task first
+					task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
+					jsonData, _ := json.Marshal(task)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					var createdTask model.Task
+					json.Unmarshal(w.Body.Bytes(), &createdTask)
+
+					// Update the task with valid status
+					updatedTask := model.Task{Title: "Test Task", DueDate: "2025-12-31T10:00:00Z", Status: "in_progress"}
+					updatedJson, _ := json.Marshal(updatedTask)
+					req, _ = http.NewRequest("PUT", "/users/"+userID+"/tasks/"+createdTask.ID, bytes.NewBuffer(updatedJson))
+					req.Header.Set("Content-Type", "application/json")
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					Expect(w.Body.String()).To(ContainSubstring("in_progress"))
+
+					// Try to update with invalid status
+					updatedTask = model.Task{Title: "Test Task", DueDate: "2025-12-31T10:00:00Z", Status: "bad_status"}
+					updatedJson, _ = json.Marshal(updatedTask)
+					req, _ = http.NewRequest("PUT", "/users/"+userID+"/tasks/"+createdTask.ID, bytes.NewBuffer(updatedJson))
+					req.Header.Set("Content-Type", "application/json")
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusBadRequest))
+					Expect(w.Body.String()).To(ContainSubstring("invalid status"))
+				})
+
+				It("should not update a task with invalid due_date", func() {
+					// Create a valid task first
+					task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
+					jsonData, _ := json.Marshal(task)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					var createdTask model.Task
+					json.Unmarshal(w.Body.Bytes(), &createdTask)
+
+					// Try to update with invalid due_date
+					updatedTask := model.Task{Title: "Updated Task", Description: "desc", DueDate: "not-a-date", Status: "pending"}
+					updatedJson, _ := json.Marshal(updatedTask)
+					req, _ = http.NewRequest("PUT", "/users/"+userID+"/tasks/"+createdTask.ID, bytes.NewBuffer(updatedJson))
+					req.Header.Set("Content-Type", "application/json")
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusBadRequest))
+					Expect(w.Body.String()).To(ContainSubstring("due_date must be ISO 8601 format"))
+				})
+
+				It("should require every field when replacing a task", func() {
+					// Create a valid task first
+					task := model.Task{Title: "Test Task", Description: "desc", DueDate: "2025-12-31T10:00:00Z", Status: "pending"}
+					jsonData, _ := json.Marshal(task)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks", bytes.NewBuffer(jsonData))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					var createdTask model.Task
+					json.Unmarshal(w.Body.Bytes(), &createdTask)
+					// PUT replaces the whole task, so missing fields are not kept
+					updatedTask := model.Task{}
+					updatedJson, _ := json.Marshal(updatedTask)
+					req, _ = http.NewRequest("PUT", "/users/"+userID+"/tasks/"+createdTask.ID, bytes.NewBuffer(updatedJson))
+					req.Header.Set("Content-Type", "application/json")
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusBadRequest))
+					Expect(w.Body.String()).To(ContainSubstring("title must be between 2 and 50 characters"))
+				})
+
+				It("should return the stored task after replacing it", func() {
+					body := []byte(`{"title": "Replaced Task", "due_date": "2025-10-01T09:00:00Z", "status": "in_progress"}`)
+					req, _ := http.NewRequest("PUT", "/users/"+userID+"/tasks/"+taskID, bytes.NewBuffer(body))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+					var replaced model.Task
+					json.Unmarshal(w.Body.Bytes(), &replaced)
+					Expect(replaced.ID).To(Equal(taskID))
+					Expect(replaced.UserID).To(Equal(userID))
+					Expect(replaced.CreatedAt).NotTo(BeEmpty())
+					Expect(replaced.Title).To(Equal("Replaced Task"))
+					Expect(replaced.Description).To(BeEmpty())
+					Expect(replaced.DueDate).To(Equal("2025-10-01T09:00:00Z"))
+				})
+
+				It("should return 404 when replacing a non-existent task", func() {
+					body := []byte(`{"title": "Replaced Task", "due_date": "2025-10-01T09:00:00Z", "status": "pending"}`)
+					req, _ := http.NewRequest("PUT", "/users/"+userID+"/tasks/non-existent-id", bytes.NewBuffer(body))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusNotFound))
+				})
+
+				Describe("versioning", func() {
+					get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+						req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks/"+taskID, nil)
+						if ifNoneMatch != "" {
+							req.Header.Set("If-None-Match", ifNoneMatch)
+						}
+						w := httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						return w
+					}
+					put := func(ifMatch, title string) *httptest.ResponseRecorder {
+						body := []byte(`{"title": "` + title + `", "due_date": "2025-09-02T15:04:05Z", "status": "pending"}`)
+						req, _ := http.NewRequest("PUT", "/users/"+userID+"/tasks/"+taskID, bytes.NewBuffer(body))
+						req.Header.Set("Content-Type", "application/json")
+						if ifMatch != "" {
+							req.Header.Set("If-Match", ifMatch)
+						}
+						w := httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						return w
+					}
+
+					It("should return an ETag that changes with every update", func() {
+						w := get("")
+						etag := w.Header().Get("ETag")
+						Expect(etag).To(Equal(`"1"`))
+						Expect(w.Body.String()).To(ContainSubstring(`"version":1`))
+
+						w = put(etag, "First Edit")
+						Expect(w.Code).To(Equal(http.StatusOK))
+						Expect(w.Header().Get("ETag")).To(Equal(`"2"`))
+						Expect(w.Body.String()).To(ContainSubstring(`"version":2`))
+					})
+
+					It("should refuse to overwrite a task changed since it was read", func() {
+						etag := get("").Header().Get("ETag")
+						Expect(put(etag, "First Edit").Code).To(Equal(http.StatusOK))
+
+						w := put(etag, "Second Edit")
+						Expect(w.Code).To(Equal(http.StatusPreconditionFailed))
+						Expect(get("").Body.String()).To(ContainSubstring("First Edit"))
+
+						req, _ := http.NewRequest("PATCH", "/users/"+userID+"/tasks/"+taskID, bytes.NewBufferString(`{"title": "Patched"}`))
+						req.Header.Set("Content-Type", "application/merge-patch+json")
+						req.Header.Set("If-Match", etag)
+						w = httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						Expect(w.Code).To(Equal(http.StatusPreconditionFailed))
+					})
+
+					It("should accept any listed or wildcard ETag", func() {
+						Expect(put(`"7", "1"`, "First Edit").Code).To(Equal(http.StatusOK))
+						Expect(put("*", "Second Edit").Code).To(Equal(http.StatusOK))
+						Expect(put("", "Third Edit").Code).To(Equal(http.StatusOK))
+					})
+
+					It("should answer 304 when the client has the current version", func() {
+						etag := get("").Header().Get("ETag")
+						w := get(etag)
+						Expect(w.Code).To(Equal(http.StatusNotModified))
+						Expect(w.Body.String()).To(BeEmpty())
+						Expect(w.Header().Get("ETag")).To(Equal(etag))
+
+						Expect(get("W/" + etag).Code).To(Equal(http.StatusNotModified))
+
+						put("", "Changed")
+						w = get(etag)
+						Expect(w.Code).To(Equal(http.StatusOK))
+						Expect(w.Body.String()).To(ContainSubstring("Changed"))
+					})
+
+					It("should not let clients set the version", func() {
+						req, _ := http.NewRequest("PATCH", "/users/"+userID+"/tasks/"+taskID, bytes.NewBufferString(`{"version": 5}`))
+						req.Header.Set("Content-Type", "application/merge-patch+json")
+						w := httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						Expect(w.Code).To(Equal(http.StatusBadRequest))
+						Expect(w.Body.String()).To(ContainSubstring("version cannot be changed"))
+					})
+				})
+
+				Describe("patching", func() {
+					patch := func(id, contentType, body string) *httptest.ResponseRecorder {
+						req, _ := http.NewRequest("PATCH", "/users/"+userID+"/tasks/"+id, bytes.NewBufferString(body))
+						req.Header.Set("Content-Type", contentType)
+						w := httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						return w
+					}
+
+					It("should change only the given fields", func() {
+						w := patch(taskID, "application/merge-patch+json", `{"status": "in_progress"}`)
+						Expect(w.Code).To(Equal(http.StatusOK))
+						var patched model.Task
+						json.Unmarshal(w.Body.Bytes(), &patched)
+						Expect(patched.Status).To(Equal("in_progress"))
+						Expect(patched.Title).To(Equal("Test Task"))
+						Expect(patched.Description).To(Equal("desc"))
+						Expect(patched.DueDate).To(Equal("2025-09-02T15:04:05Z"))
+						Expect(patched.CreatedAt).NotTo(BeEmpty())
+					})
+
+					It("should clear fields set to null", func() {
+						w := patch(taskID, "application/merge-patch+json", `{"description": null}`)
+						Expect(w.Code).To(Equal(http.StatusOK))
+
+						req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks/"+taskID, nil)
+						w = httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						var stored model.Task
+						json.Unmarshal(w.Body.Bytes(), &stored)
+						Expect(stored.Title).To(Equal("Test Task"))
+						Expect(stored.Description).To(BeEmpty())
+						Expect(stored.DueDate).To(Equal("2025-09-02T15:04:05Z"))
+					})
+
+					It("should accept plain JSON", func() {
+						w := patch(taskID, "application/json", `{"title": "Renamed"}`)
+						Expect(w.Code).To(Equal(http.StatusOK))
+						Expect(w.Body.String()).To(ContainSubstring(`"title":"Renamed"`))
+					})
+
+					It("should reject patches that leave the task invalid", func() {
+						for body, message := range map[string]string{
+							`{"title": null}`:          "title must be between 2 and 50 characters",
+							`{"status": "bad_status"}`: "invalid status",
+							`{"due_date": "tomorrow"}`: "due_date must be ISO 8601 format",
+							`{"due_date": null}`:       "due_date must be ISO 8601 format",
+							`{"title": 42}`:            "title must be a string",
+						} {
+							w := patch(taskID, "application/merge-patch+json", body)
+							Expect(w.Code).To(Equal(http.StatusBadRequest), body)
+							Expect(w.Body.String()).To(ContainSubstring(message), body)
+						}
+
+						req, _ := http.NewRequest("GET", "/users/"+userID+"/tasks/"+taskID, nil)
+						w := httptest.NewRecorder()
+						router.ServeHTTP(w, req)
+						Expect(w.Body.String()).To(ContainSubstring(`"title":"Test Task"`))
+					})
+
+					It("should reject malformed patches", func() {
+						for body, message := range map[string]string{
+							`[]`:                   "patch must be a JSON object",
+							`null`:                 "patch must be a JSON object",
+							`{}`:                   "at least one field must be updated",
+							`{"id": "other"}`:      "id cannot be changed",
+							`{"created_at": null}`: "created_at cannot be changed",
+							`{"color": "red"}`:     "unknown field color",
+						} {
+							w := patch(taskID, "application/merge-patch+json", body)
+							Expect(w.Code).To(Equal(http.StatusBadRequest), body)
+							Expect(w.Body.String()).To(ContainSubstring(message), body)
+						}
+					})
+
+					It("should reject other content types", func() {
+						w := patch(taskID, "text/plain", `{"title": "Renamed"}`)
+						Expect(w.Code).To(Equal(http.StatusUnsupportedMediaType))
+					})
+
+					It("should return 404 for a non-existent task", func() {
+						w := patch("non-existent-id", "application/merge-patch+json", `{"title": "Renamed"}`)
+						Expect(w.Code).To(Equal(http.StatusNotFound))
+					})
+				})
+
+				It("should update the status of several tasks at once", func() {
+					body := []byte(`{"task_ids": ["` + taskID + `"], "status": "done"}`)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks/bulk-status", bytes.NewBuffer(body))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+
+					req, _ = http.NewRequest("GET", "/users/"+userID+"/tasks/"+taskID, nil)
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Body.String()).To(ContainSubstring(`"status":"done"`))
+				})
+
+				It("should not update any status if one task is missing", func() {
+					body := []byte(`{"task_ids": ["` + taskID + `", "non-existent-id"], "status": "done"}`)
+					req, _ := http.NewRequest("POST", "/users/"+userID+"/tasks/bulk-status", bytes.NewBuffer(body))
+					req.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusNotFound))
+
+					req, _ = http.NewRequest("GET", "/users/"+userID+"/tasks/"+taskID, nil)
+					w = httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Body.String()).To(ContainSubstring(`"status":"pending"`))
+				})
+
+				It("should delete a task", func() {
+					req, _ := http.NewRequest("DELETE", "/users/"+userID+"/tasks/"+taskID, nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusOK))
+				})
+
+				It("should return 404 when deleting non-existent task", func() {
+					req, _ := http.NewRequest("DELETE", "/users/"+userID+"/tasks/non-existent-id", nil)
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, req)
+					Expect(w.Code).To(Equal(http.StatusNotFound))
+					Expect(w.Body.String()).To(ContainSubstring(`"code":"task_not_found"`))
+				})
 			})
 		})
 	})
-})
+}
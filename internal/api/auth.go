@@ -0,0 +1,248 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"task-manager/internal/model"
+	"task-manager/internal/policy"
+	"task-manager/internal/service"
+	"task-manager/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserKey is the gin context key holding the authenticated *model.User
+const currentUserKey = "currentUser"
+
+// password length limits; bcrypt ignores anything past 72 bytes
+const (
+	minPasswordLen = 8
+	maxPasswordLen = 72
+)
+
+// bearerToken returns the token of the Authorization header
+func bearerToken(c *gin.Context) (string, bool) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	return token, ok && token != ""
+}
+
+// authenticate resolves the bearer token of the request, an API token or a
+// session access token, to its user and rejects the request with 401 if
+// there is none
+func authenticate(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearer, ok := bearerToken(c)
+		if !ok {
+			unauthorized(c, "missing bearer token")
+			return
+		}
+		user, err := authService.Authenticate(c.Request.Context(), bearer)
+		if errors.Is(err, service.ErrInvalidToken) {
+			unauthorized(c, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Set(currentUserKey, user)
+		c.Next()
+	}
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", "Bearer")
+	respondError(c, &apiError{status: http.StatusUnauthorized, code: codeUnauthorized, detail: message})
+}
+
+// currentUser returns the user set by authenticate
+func currentUser(c *gin.Context) *model.User {
+	user, _ := c.MustGet(currentUserKey).(*model.User)
+	return user
+}
+
+// authorize consults the policy for the current user performing action on
+// the account in the user_id path parameter, if any, and rejects the request
+// with 403 if it is not allowed
+func authorize(action policy.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !policy.Allowed(currentUser(c), action, c.Param("user_id")) {
+			respondError(c, &apiError{status: http.StatusForbidden, code: codeForbidden, detail: "not allowed to " + describe(action)})
+			return
+		}
+		c.Next()
+	}
+}
+
+func describe(action policy.Action) string {
+	switch action {
+	case policy.ReadUser:
+		return "view this user"
+	case policy.ReadTasks:
+		return "view these tasks"
+	case policy.WriteTasks:
+		return "change these tasks"
+	case policy.ManageTokens:
+		return "manage these tokens"
+	case policy.ManageWebhooks:
+		return "manage these webhooks"
+	case policy.ListUsers:
+		return "list users"
+	case policy.DeleteUser:
+		return "delete users"
+	case policy.ChangeRole:
+		return "change roles"
+	}
+	return string(action)
+}
+
+// --- API Token Handlers ---
+
+// tokenResponse carries a token's secret, which is only returned on creation
+type tokenResponse struct {
+	model.APIToken
+	Token string `json:"token"`
+}
+
+type createTokenRequest struct {
+	Name string `json:"name"`
+}
+
+func createTokenHandler(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		var req createTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, badRequest(err.Error()))
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		var errs validation.Errors
+		if errs.Check("name", name, validation.Length(1, validation.MaxNameLen)); len(errs) > 0 {
+			respondError(c, errs)
+			return
+		}
+		token, secret, err := authService.CreateToken(c.Request.Context(), userID, name)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, tokenResponse{APIToken: *token, Token: secret})
+	}
+}
+
+func listTokensHandler(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		tokens, err := authService.ListTokens(c.Request.Context(), userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, listResponse[model.APIToken]{Items: tokens})
+	}
+}
+
+func deleteTokenHandler(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		tokenID, ok := getParam(c, "token_id")
+		if !ok {
+			return
+		}
+		err := authService.DeleteToken(c.Request.Context(), userID, tokenID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// --- Session Handlers ---
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func loginHandler(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req loginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, badRequest(err.Error()))
+			return
+		}
+		if strings.TrimSpace(req.Email) == "" || req.Password == "" {
+			respondError(c, badRequest("email and password are required"))
+			return
+		}
+		session, err := authService.Login(c.Request.Context(), validation.NormalizeEmail(req.Email), req.Password)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+func refreshHandler(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req refreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, badRequest(err.Error()))
+			return
+		}
+		if req.RefreshToken == "" {
+			respondError(c, invalidField("refresh_token", "refresh_token is required"))
+			return
+		}
+		session, err := authService.Refresh(c.Request.Context(), req.RefreshToken)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// logoutHandler revokes the access token the request was made with and the
+// refresh token in the body, if any
+func logoutHandler(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req refreshRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				respondError(c, badRequest(err.Error()))
+				return
+			}
+		}
+		bearer, _ := bearerToken(c)
+		err := authService.Logout(c.Request.Context(), bearer, req.RefreshToken)
+		if errors.Is(err, service.ErrInvalidToken) {
+			respondError(c, badRequest("logout needs a session access token and, optionally, its refresh token; API tokens are revoked by deleting them"))
+			return
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"task-manager/internal/model"
+	"task-manager/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Dependency Handlers ---
+
+// dependenciesResponse lists the tasks a task waits for and those waiting for it
+type dependenciesResponse struct {
+	BlockedBy []model.Task `json:"blocked_by"`
+	Blocks    []model.Task `json:"blocks"`
+}
+
+type dependencyRequest struct {
+	BlockerID string `json:"blocker_id"`
+}
+
+func listDependencies(c *gin.Context, taskService *service.TaskService) {
+	taskID, ok := getParam(c, "task_id")
+	if !ok {
+		return
+	}
+	blockedBy, blocks, err := taskService.Dependencies(c.Request.Context(), taskID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dependenciesResponse{BlockedBy: blockedBy, Blocks: blocks})
+}
+
+// addDependency makes the task wait for the task named by blocker_id
+func addDependency(c *gin.Context, taskService *service.TaskService) {
+	taskID, ok := getParam(c, "task_id")
+	if !ok {
+		return
+	}
+	var req dependencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	req.BlockerID = strings.TrimSpace(req.BlockerID)
+	if req.BlockerID == "" {
+		respondError(c, invalidField("blocker_id", "blocker_id is required"))
+		return
+	}
+	dep, err := taskService.AddDependency(c.Request.Context(), taskID, req.BlockerID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, dep)
+}
+
+func removeDependency(c *gin.Context, taskService *service.TaskService) {
+	taskID, ok := getParam(c, "task_id")
+	if !ok {
+		return
+	}
+	blockerID, ok := getParam(c, "blocker_id")
+	if !ok {
+		return
+	}
+	if err := taskService.RemoveDependency(c.Request.Context(), taskID, blockerID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"task-manager/internal/db"
+	"task-manager/internal/service"
+	"task-manager/internal/validation"
+	"task-manager/internal/webhook"
+	"task-manager/internal/workflow"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problemContentType is the media type of RFC 7807 problem details
+const problemContentType = "application/problem+json"
+
+// Error codes are stable, machine-readable names for what went wrong; the
+// detail message that accompanies them may change
+const (
+	codeInvalidRequest       = "invalid_request"
+	codeValidationFailed     = "validation_failed"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeTaskNotFound         = "task_not_found"
+	codeUserNotFound         = "user_not_found"
+	codeTagNotFound          = "tag_not_found"
+	codeDependencyNotFound   = "dependency_not_found"
+	codeTokenNotFound        = "token_not_found"
+	codeWebhookNotFound      = "webhook_not_found"
+	codeEmailTaken           = "email_taken"
+	codeTagExists            = "tag_exists"
+	codeDependencyExists     = "dependency_exists"
+	codeUserHasTasks         = "user_has_tasks"
+	codeLastAdmin            = "last_admin"
+	codeVersionConflict      = "version_conflict"
+	codeInvalidTransition    = "invalid_transition"
+	codeOpenSubtasks         = "open_subtasks"
+	codeTaskBlocked          = "task_blocked"
+	codeNotRecurring         = "not_recurring"
+	codeSeriesEnded          = "series_ended"
+	codeOccurrenceFinished   = "occurrence_finished"
+	codePreconditionFailed   = "precondition_failed"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeTimeout              = "timeout"
+	codeClientClosedRequest  = "client_closed_request"
+	codeInternal             = "internal_error"
+)
+
+// statusClientClosedRequest is the non-standard status (popularized by nginx)
+// for requests abandoned by the client before a response was written
+const statusClientClosedRequest = 499
+
+// apiError is an error that knows how it is reported to clients. Handlers
+// return or pass one to respondError; other errors are translated by
+// toAPIError.
+type apiError struct {
+	status int
+	code   string
+	detail string
+	fields []validation.FieldError
+	// extra holds additional members of the problem body
+	extra map[string]any
+}
+
+func (e *apiError) Error() string {
+	return e.detail
+}
+
+func badRequest(detail string) *apiError {
+	return &apiError{status: http.StatusBadRequest, code: codeInvalidRequest, detail: detail}
+}
+
+// invalidFields reports request fields that failed validation
+func invalidFields(errs validation.Errors) *apiError {
+	return &apiError{status: http.StatusBadRequest, code: codeValidationFailed, detail: errs.Error(), fields: errs}
+}
+
+func invalidField(field, message string) *apiError {
+	return invalidFields(validation.Errors{{Field: field, Message: message}})
+}
+
+// toAPIError maps the errors of the lower layers to their status and code.
+// Unexpected errors become an opaque 500 so database details do not leak.
+func toAPIError(c *gin.Context, err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		return invalidFields(fieldErrs)
+	}
+	ctxErr := c.Request.Context().Err()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(ctxErr, context.DeadlineExceeded):
+		return &apiError{status: http.StatusGatewayTimeout, code: codeTimeout, detail: "the request took too long"}
+	case errors.Is(err, context.Canceled), errors.Is(ctxErr, context.Canceled):
+		return &apiError{status: statusClientClosedRequest, code: codeClientClosedRequest, detail: "the client closed the request"}
+	}
+
+	var hasTasks *db.UserHasTasksError
+	var transition *workflow.TransitionError
+	var openSubtasks *service.OpenSubtasksError
+	var blocked *service.BlockedError
+	switch {
+	case errors.As(err, &transition):
+		return &apiError{
+			status: http.StatusUnprocessableEntity,
+			code:   codeInvalidTransition,
+			detail: err.Error(),
+			extra:  map[string]any{"from": transition.From, "to": transition.To, "allowed_statuses": nonNil(transition.Allowed)},
+		}
+	case errors.As(err, &openSubtasks):
+		return &apiError{
+			status: http.StatusUnprocessableEntity,
+			code:   codeOpenSubtasks,
+			detail: err.Error(),
+			extra:  map[string]any{"open_subtasks": openSubtasks.Open},
+		}
+	case errors.As(err, &blocked):
+		return &apiError{
+			status: http.StatusUnprocessableEntity,
+			code:   codeTaskBlocked,
+			detail: err.Error(),
+			extra:  map[string]any{"open_blockers": blocked.Open},
+		}
+	case errors.As(err, &hasTasks):
+		return &apiError{
+			status: http.StatusConflict,
+			code:   codeUserHasTasks,
+			detail: "user still owns tasks; retry with ?cascade=true to delete them too",
+			extra:  map[string]any{"task_count": hasTasks.TaskCount},
+		}
+	case errors.Is(err, db.ErrTaskNotFound):
+		return &apiError{status: http.StatusNotFound, code: codeTaskNotFound, detail: err.Error()}
+	case errors.Is(err, db.ErrUserNotFound):
+		return &apiError{status: http.StatusNotFound, code: codeUserNotFound, detail: err.Error()}
+	case errors.Is(err, db.ErrTagNotFound):
+		return &apiError{status: http.StatusNotFound, code: codeTagNotFound, detail: err.Error()}
+	case errors.Is(err, db.ErrDependencyNotFound):
+		return &apiError{status: http.StatusNotFound, code: codeDependencyNotFound, detail: err.Error()}
+	case errors.Is(err, db.ErrTokenNotFound):
+		return &apiError{status: http.StatusNotFound, code: codeTokenNotFound, detail: err.Error()}
+	case errors.Is(err, db.ErrWebhookNotFound):
+		return &apiError{status: http.StatusNotFound, code: codeWebhookNotFound, detail: err.Error()}
+	case errors.Is(err, db.ErrEmailTaken):
+		return &apiError{status: http.StatusConflict, code: codeEmailTaken, detail: err.Error(),
+			fields: validation.Errors{{Field: "email", Message: err.Error()}}}
+	case errors.Is(err, db.ErrTagExists):
+		return &apiError{status: http.StatusConflict, code: codeTagExists, detail: err.Error(),
+			fields: validation.Errors{{Field: "name", Message: err.Error()}}}
+	case errors.Is(err, service.ErrParentNotFound), errors.Is(err, service.ErrSubtaskCycle):
+		return invalidField("parent_id", err.Error())
+	case errors.Is(err, db.ErrDependencyExists):
+		return &apiError{status: http.StatusConflict, code: codeDependencyExists, detail: err.Error(),
+			fields: validation.Errors{{Field: "blocker_id", Message: err.Error()}}}
+	case errors.Is(err, service.ErrBlockerNotFound), errors.Is(err, service.ErrDependencyCycle):
+		return invalidField("blocker_id", err.Error())
+	case errors.Is(err, webhook.ErrPrivateAddress):
+		return invalidField("url", webhook.ErrPrivateAddress.Error())
+	case errors.Is(err, webhook.ErrUnknownHost):
+		return invalidField("url", webhook.ErrUnknownHost.Error())
+	case errors.Is(err, service.ErrNotRecurring):
+		return &apiError{status: http.StatusUnprocessableEntity, code: codeNotRecurring, detail: err.Error()}
+	case errors.Is(err, service.ErrSeriesEnded):
+		return &apiError{status: http.StatusUnprocessableEntity, code: codeSeriesEnded, detail: err.Error()}
+	case errors.Is(err, service.ErrOccurrenceFinished):
+		return &apiError{status: http.StatusConflict, code: codeOccurrenceFinished, detail: err.Error()}
+	case errors.Is(err, service.ErrLastAdmin):
+		return &apiError{status: http.StatusConflict, code: codeLastAdmin, detail: err.Error()}
+	case errors.Is(err, db.ErrVersionConflict):
+		// Only requests with If-Match state a precondition; others merely
+		// raced another update
+		if c.GetHeader("If-Match") != "" {
+			return &apiError{status: http.StatusPreconditionFailed, code: codePreconditionFailed,
+				detail: "the task has changed since the ETag in If-Match was issued; fetch it again and retry"}
+		}
+		return &apiError{status: http.StatusConflict, code: codeVersionConflict, detail: err.Error()}
+	case errors.Is(err, db.ErrInvalidSort), errors.Is(err, db.ErrInvalidCursor):
+		return badRequest(err.Error())
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidToken):
+		return &apiError{status: http.StatusUnauthorized, code: codeUnauthorized, detail: err.Error()}
+	}
+	_ = c.Error(err)
+	return &apiError{status: http.StatusInternalServerError, code: codeInternal, detail: "internal server error"}
+}
+
+// nonNil keeps empty lists from being rendered as null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// respondError aborts the request with err as an RFC 7807 problem
+func respondError(c *gin.Context, err error) {
+	apiErr := toAPIError(c, err)
+	body := map[string]any{
+		"type":     "about:blank",
+		"title":    http.StatusText(apiErr.status),
+		"status":   apiErr.status,
+		"detail":   apiErr.detail,
+		"instance": c.Request.URL.Path,
+		"code":     apiErr.code,
+	}
+	if apiErr.status == statusClientClosedRequest {
+		body["title"] = "Client Closed Request"
+	}
+	if len(apiErr.fields) > 0 {
+		body["errors"] = apiErr.fields
+	}
+	for name, value := range apiErr.extra {
+		body[name] = value
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Abort()
+	c.Data(apiErr.status, problemContentType, data)
+}
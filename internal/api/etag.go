@@ -0,0 +1,48 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+)
+
+// taskETag identifies a version of a task. Every update bumps the version,
+// so the tag changes whenever the task does.
+func taskETag(task *model.Task) string {
+	return `"` + strconv.Itoa(task.Version) + `"`
+}
+
+// etagListed reports whether an If-Match or If-None-Match header names etag.
+// Weak comparison ignores the W/ prefix, as If-None-Match requires.
+func etagListed(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch returns db.ErrVersionConflict unless the request has no
+// If-Match header or it lists the current ETag of task
+func checkIfMatch(c *gin.Context, task *model.Task) error {
+	header := c.GetHeader("If-Match")
+	if header != "" && !etagListed(header, taskETag(task), false) {
+		return db.ErrVersionConflict
+	}
+	return nil
+}
+
+// writeTask responds with a task and its ETag
+func writeTask(c *gin.Context, status int, task *model.Task) {
+	c.Header("ETag", taskETag(task))
+	c.JSON(status, task)
+}
@@ -1,89 +1,181 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"task-manager/internal/db"
 	"task-manager/internal/model"
+	"task-manager/internal/policy"
 	"task-manager/internal/service"
+	"task-manager/internal/validation"
+	"task-manager/internal/workflow"
 	"time"
-	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
 
-// RegisterRoutes sets up the API routes for user and task management
-func RegisterRoutes(router *gin.Engine, dbInstance db.DB) {
+// RegisterRoutes sets up the API routes for user and task management. Apart
+// from registration, every route requires a bearer token.
+func RegisterRoutes(router *gin.Engine, dbInstance db.DB, opts ...Option) {
+	cfg := newConfig(opts)
 	userService := service.NewUserService(dbInstance)
+	authService := service.NewAuthService(dbInstance, cfg.jwtSecret)
+	tagService := service.NewTagService(dbInstance)
+	webhookService := service.NewWebhookService(dbInstance, cfg.webhookGuard)
+	public := router.Group("", requestTimeout(cfg.queryTimeout))
+	public.POST("/users", createUserHandler(userService))
+	public.POST("/auth/login", loginHandler(authService))
+	public.POST("/auth/refresh", refreshHandler(authService))
+
+	routes := public.Group("", authenticate(authService))
+	routes.POST("/auth/logout", logoutHandler(authService))
 
 	// User routes
-	router.POST("/users", createUserHandler(userService))
-	router.GET("/users/:user_id", getUserHandler(userService))
-	router.GET("/users", listUsersHandler(userService))
-	router.DELETE("/users/:user_id", deleteUserHandler(userService))
+	routes.GET("/users/:user_id", authorize(policy.ReadUser), getUserHandler(userService))
+	routes.GET("/users", authorize(policy.ListUsers), listUsersHandler(userService))
+	routes.DELETE("/users/:user_id", authorize(policy.DeleteUser), deleteUserHandler(userService))
+	routes.PUT("/users/:user_id/role", authorize(policy.ChangeRole), setRoleHandler(userService))
 
-	// Task routes (under user context)
-	router.POST("/users/:user_id/tasks", taskHandler(dbInstance, createTask))
-	router.GET("/users/:user_id/tasks", taskHandler(dbInstance, listTasks))
-	router.GET("/users/:user_id/tasks/:task_id", taskHandler(dbInstance, getTask))
-	router.PUT("/users/:user_id/tasks/:task_id", taskHandler(dbInstance, updateTask))
-	router.DELETE("/users/:user_id/tasks/:task_id", taskHandler(dbInstance, deleteTask))
-}
+	// API token routes
+	tokens := routes.Group("/users/:user_id/tokens", authorize(policy.ManageTokens))
+	tokens.POST("", createTokenHandler(authService))
+	tokens.GET("", listTokensHandler(authService))
+	tokens.DELETE("/:token_id", deleteTokenHandler(authService))
 
-var validStatuses = map[string]struct{}{
-	"pending":     {},
-	"in_progress": {},
-	"done":        {},
-}
+	// Webhook routes
+	webhooks := routes.Group("/users/:user_id/webhooks", authorize(policy.ManageWebhooks))
+	webhooks.POST("", createWebhookHandler(webhookService))
+	webhooks.GET("", listWebhooksHandler(webhookService))
+	webhooks.GET("/:webhook_id", getWebhookHandler(webhookService))
+	webhooks.DELETE("/:webhook_id", deleteWebhookHandler(webhookService))
+	webhooks.GET("/:webhook_id/deliveries", listDeliveriesHandler(webhookService))
 
-const (
-	minNameLen = 2
-	maxNameLen = 50
-	maxDescLen = 200
-)
+	routes.GET("/workflow", workflowHandler(cfg.workflow))
 
-func isValidStatus(status string) bool {
-	_, ok := validStatuses[status]
-	return ok
-}
+	// Tag routes
+	routes.GET("/users/:user_id/tags", authorize(policy.ReadTasks), listTagsHandler(tagService))
+	tags := routes.Group("/users/:user_id/tags", authorize(policy.WriteTasks))
+	tags.POST("", createTagHandler(tagService))
+	tags.PUT("/:tag_id", renameTagHandler(tagService))
+	tags.DELETE("/:tag_id", deleteTagHandler(tagService))
+
+	// Task routes (under user context)
+	read := routes.Group("/users/:user_id/tasks", authorize(policy.ReadTasks))
+	read.GET("", taskHandler(dbInstance, cfg.workflow, listTasks))
+	read.GET("/search", taskHandler(dbInstance, cfg.workflow, searchTasks))
+	read.GET("/:task_id", taskHandler(dbInstance, cfg.workflow, getTask))
+	read.GET("/:task_id/subtasks", taskHandler(dbInstance, cfg.workflow, listSubtasks))
+	read.GET("/:task_id/dependencies", taskHandler(dbInstance, cfg.workflow, listDependencies))
 
-func isValidISO8601(dateStr string) bool {
-	_, err := time.Parse(time.RFC3339, dateStr)
-	return err == nil
+	write := routes.Group("/users/:user_id/tasks", authorize(policy.WriteTasks))
+	write.POST("", taskHandler(dbInstance, cfg.workflow, createTask))
+	write.PUT("/:task_id", taskHandler(dbInstance, cfg.workflow, updateTask))
+	write.PATCH("/:task_id", taskHandler(dbInstance, cfg.workflow, patchTask))
+	write.DELETE("/:task_id", taskHandler(dbInstance, cfg.workflow, deleteTask))
+	write.POST("/bulk-status", taskHandler(dbInstance, cfg.workflow, bulkUpdateStatus))
+	write.POST("/:task_id/dependencies", taskHandler(dbInstance, cfg.workflow, addDependency))
+	write.DELETE("/:task_id/dependencies/:blocker_id", taskHandler(dbInstance, cfg.workflow, removeDependency))
+	write.PATCH("/:task_id/series", taskHandler(dbInstance, cfg.workflow, patchSeries))
+	write.POST("/:task_id/series/skip", taskHandler(dbInstance, cfg.workflow, skipOccurrence))
+	write.POST("/:task_id/series/stop", taskHandler(dbInstance, cfg.workflow, stopSeries))
 }
 
 func getParam(c *gin.Context, param string) (string, bool) {
 	value := c.Param(param)
 	if value == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": param + " is required"})
+		respondError(c, badRequest(param+" is required"))
 		return "", false
 	}
 	return value, true
 }
 
+// serverManaged responds with 400 and returns true if the client tried to set
+// timestamps that only the server may set
+func serverManaged(c *gin.Context, createdAt, updatedAt string) bool {
+	if createdAt == "" && updatedAt == "" {
+		return false
+	}
+	field := "created_at"
+	if createdAt == "" {
+		field = "updated_at"
+	}
+	respondError(c, invalidField(field, "created_at and updated_at are set by the server"))
+	return true
+}
+
+// listResponse is the envelope returned by paginated list endpoints
+type listResponse[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// parsePage reads the limit, cursor, sort and order query parameters shared
+// by the list endpoints
+func parsePage(c *gin.Context) (db.Page, bool) {
+	page := db.Page{Cursor: c.Query("cursor"), Sort: c.Query("sort")}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > db.MaxPageSize {
+			respondError(c, invalidField("limit", fmt.Sprintf("limit must be between 1 and %d", db.MaxPageSize)))
+			return page, false
+		}
+		page.Limit = n
+	}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		respondError(c, invalidField("order", "order must be asc or desc"))
+		return page, false
+	}
+	return page, true
+}
+
 // --- User Handlers ---
+// registerRequest is a new user and the password they will log in with
+type registerRequest struct {
+	model.User
+	Password string `json:"password"`
+}
+
+// createdUserResponse is a new user together with the secret of their first API token
+type createdUserResponse struct {
+	model.User
+	Token string `json:"token"`
+}
+
 func createUserHandler(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var user model.User
-		if err := c.ShouldBindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var req registerRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, badRequest(err.Error()))
+			return
+		}
+		user := req.User
+		if serverManaged(c, user.CreatedAt, user.UpdatedAt) {
 			return
 		}
-		nameLen := utf8.RuneCountInString(strings.TrimSpace(user.Name))
-		if nameLen < minNameLen || nameLen > maxNameLen {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 2 and 50 characters"})
+		errs := validation.User(&user)
+		errs.Check("password", req.Password, validation.Bytes(minPasswordLen, maxPasswordLen))
+		if len(errs) > 0 {
+			respondError(c, errs)
 			return
 		}
-		if strings.TrimSpace(user.Email) == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+		hash, err := service.HashPassword(req.Password)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
-		err := userService.Create(&user)
+		user.PasswordHash = hash
+		secret, err := userService.Register(c.Request.Context(), &user, "default")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, user)
+		c.JSON(http.StatusCreated, createdUserResponse{User: user, Token: secret})
 	}
 }
 
@@ -93,9 +185,9 @@ func getUserHandler(userService *service.UserService) gin.HandlerFunc {
 		if !ok {
 			return
 		}
-		user, err := userService.Get(userID)
+		user, err := userService.Get(c.Request.Context(), userID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, user)
@@ -104,12 +196,44 @@ func getUserHandler(userService *service.UserService) gin.HandlerFunc {
 
 func listUsersHandler(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		users, err := userService.List()
+		page, ok := parsePage(c)
+		if !ok {
+			return
+		}
+		users, next, err := userService.List(c.Request.Context(), page)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, users)
+		c.JSON(http.StatusOK, listResponse[model.User]{Items: users, NextCursor: next})
+	}
+}
+
+type setRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func setRoleHandler(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		var req setRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, badRequest(err.Error()))
+			return
+		}
+		if !model.IsValidRole(req.Role) {
+			respondError(c, invalidField("role", "role must be admin, member or read_only"))
+			return
+		}
+		user, err := userService.SetRole(c.Request.Context(), userID, req.Role)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, user)
 	}
 }
 
@@ -119,26 +243,37 @@ func deleteUserHandler(userService *service.UserService) gin.HandlerFunc {
 		if !ok {
 			return
 		}
-		err := userService.Delete(userID)
+		cascade, err := strconv.ParseBool(c.DefaultQuery("cascade", "false"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, invalidField("cascade", "cascade must be true or false"))
+			return
+		}
+		err = userService.Delete(c.Request.Context(), userID, cascade)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 		c.Status(http.StatusOK)
 	}
 }
 
+// workflowHandler describes the task statuses and the transitions between them
+func workflowHandler(wf *workflow.Workflow) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, wf.Config())
+	}
+}
+
 // --- Task Handler Wrapper ---
 type taskAction func(c *gin.Context, taskService *service.TaskService)
 
-func taskHandler(dbInstance db.DB, action taskAction) gin.HandlerFunc {
+func taskHandler(dbInstance db.DB, wf *workflow.Workflow, action taskAction) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, ok := getParam(c, "user_id")
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
 			return
 		}
-		taskService := service.NewTaskService(dbInstance, userID)
+		taskService := service.NewTaskService(dbInstance, wf, userID)
 		action(c, taskService)
 	}
 }
@@ -147,43 +282,148 @@ func taskHandler(dbInstance db.DB, action taskAction) gin.HandlerFunc {
 func createTask(c *gin.Context, taskService *service.TaskService) {
 	var task model.Task
 	if err := c.ShouldBindJSON(&task); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	if serverManaged(c, task.CreatedAt, task.UpdatedAt) {
 		return
 	}
-	titleLen := utf8.RuneCountInString(strings.TrimSpace(task.Title))
-	if titleLen < minNameLen || titleLen > maxNameLen {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "title must be between 2 and 50 characters"})
+	if strings.TrimSpace(task.Status) == "" {
+		task.Status = taskService.Workflow().Initial()
+	}
+	if err := validation.Task(&task, taskService.Workflow().Statuses()).Err(); err != nil {
+		respondError(c, err)
 		return
 	}
-	descLen := utf8.RuneCountInString(strings.TrimSpace(task.Description))
-	if descLen > maxDescLen {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "description must be at most 200 characters"})
+	err := taskService.Create(c.Request.Context(), &task)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
-	if !isValidStatus(task.Status) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+	writeTask(c, http.StatusCreated, &task)
+}
+
+func listTasks(c *gin.Context, taskService *service.TaskService) {
+	page, ok := parsePage(c)
+	if !ok {
 		return
 	}
-	if !isValidISO8601(task.DueDate) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "due_date must be ISO 8601 format (RFC3339)"})
+	q, ok := parseTaskQuery(c, taskService)
+	if !ok {
 		return
 	}
-	err := taskService.Create(&task)
+	q.Page = page
+	tasks, next, err := taskService.List(c.Request.Context(), q)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
-	c.JSON(http.StatusCreated, task)
+	c.JSON(http.StatusOK, listResponse[model.Task]{Items: tasks, NextCursor: next})
 }
 
-func listTasks(c *gin.Context, taskService *service.TaskService) {
-	status := c.Query("status")
-	tasks, err := taskService.List(status)
+// listSubtasks lists the direct subtasks of a task, with the same paging and
+// filters as listTasks
+func listSubtasks(c *gin.Context, taskService *service.TaskService) {
+	taskID, ok := getParam(c, "task_id")
+	if !ok {
+		return
+	}
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	q, ok := parseTaskQuery(c, taskService)
+	if !ok {
+		return
+	}
+	q.Page = page
+	tasks, next, err := taskService.Subtasks(c.Request.Context(), taskID, q)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, tasks)
+	c.JSON(http.StatusOK, listResponse[model.Task]{Items: tasks, NextCursor: next})
+}
+
+// parseTaskQuery reads the task list filters: status, priority and tag
+// (repeatable or comma-separated), tag_match, due_before, due_after,
+// updated_since, overdue, series_id and q
+func parseTaskQuery(c *gin.Context, taskService *service.TaskService) (db.TaskQuery, bool) {
+	var q db.TaskQuery
+	var errs validation.Errors
+	statusRule := validation.OneOf(taskService.Workflow().Statuses()...)
+	for _, value := range c.QueryArray("status") {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			errs.Check("status", status, statusRule)
+			q.Statuses = append(q.Statuses, status)
+		}
+	}
+	priorityRule := validation.OneOf(model.Priorities...)
+	for _, value := range c.QueryArray("priority") {
+		for _, priority := range strings.Split(value, ",") {
+			priority = strings.TrimSpace(priority)
+			errs.Check("priority", priority, priorityRule)
+			q.Priorities = append(q.Priorities, priority)
+		}
+	}
+	for _, value := range c.QueryArray("tag") {
+		for _, tag := range strings.Split(value, ",") {
+			q.Tags = append(q.Tags, strings.TrimSpace(tag))
+		}
+	}
+	tagMatch := c.DefaultQuery("tag_match", "any")
+	errs.Check("tag_match", tagMatch, validation.OneOf("any", "all"))
+	q.AllTags = tagMatch == "all"
+	dates := []struct {
+		param  string
+		target *string
+	}{{"due_before", &q.DueBefore}, {"due_after", &q.DueAfter}, {"updated_since", &q.UpdatedSince}}
+	for _, date := range dates {
+		value := c.Query(date.param)
+		if value != "" {
+			errs.Check(date.param, value, validation.RFC3339)
+		}
+		*date.target = value
+	}
+	if len(errs) > 0 {
+		respondError(c, errs)
+		return q, false
+	}
+	q.Text = strings.TrimSpace(c.Query("q"))
+	q.SeriesID = strings.TrimSpace(c.Query("series_id"))
+	overdue, err := strconv.ParseBool(c.DefaultQuery("overdue", "false"))
+	if err != nil {
+		respondError(c, invalidField("overdue", "overdue must be true or false"))
+		return q, false
+	}
+	if overdue {
+		q = taskService.OnlyOverdue(q, time.Now())
+	}
+	return q, true
+}
+
+func searchTasks(c *gin.Context, taskService *service.TaskService) {
+	query := c.Query("q")
+	if len(db.SearchTerms(query)) == 0 {
+		respondError(c, invalidField("q", "q is required"))
+		return
+	}
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > db.MaxPageSize {
+			respondError(c, invalidField("limit", fmt.Sprintf("limit must be between 1 and %d", db.MaxPageSize)))
+			return
+		}
+		limit = n
+	}
+	results, err := taskService.Search(c.Request.Context(), query, limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, listResponse[model.TaskSearchResult]{Items: results})
 }
 
 func getTask(c *gin.Context, taskService *service.TaskService) {
@@ -191,14 +431,22 @@ func getTask(c *gin.Context, taskService *service.TaskService) {
 	if !ok {
 		return
 	}
-	task, err := taskService.Get(taskID)
+	task, err := taskService.Get(c.Request.Context(), taskID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(c, err)
+		return
+	}
+	if header := c.GetHeader("If-None-Match"); header != "" && etagListed(header, taskETag(task), true) {
+		c.Header("ETag", taskETag(task))
+		c.Status(http.StatusNotModified)
 		return
 	}
-	c.JSON(http.StatusOK, task)
+	writeTask(c, http.StatusOK, task)
 }
 
+// updateTask replaces a task: every field is required, and omitted optional
+// fields such as description are cleared. With If-Match the task is only
+// replaced if it has not changed since the client read it.
 func updateTask(c *gin.Context, taskService *service.TaskService) {
 	taskID, ok := getParam(c, "task_id")
 	if !ok {
@@ -206,51 +454,58 @@ func updateTask(c *gin.Context, taskService *service.TaskService) {
 	}
 	var task model.Task
 	if err := c.ShouldBindJSON(&task); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, badRequest(err.Error()))
 		return
 	}
-	var atLeastOneField bool
-	if task.Title != "" {
-		titleLen := utf8.RuneCountInString(strings.TrimSpace(task.Title))
-		if titleLen < minNameLen || titleLen > maxNameLen {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "title must be between 2 and 50 characters"})
-			return
-		}
-		atLeastOneField = true
+	if serverManaged(c, task.CreatedAt, task.UpdatedAt) {
+		return
 	}
-	if task.Description != "" {
-		descLen := utf8.RuneCountInString(strings.TrimSpace(task.Description))
-		if descLen > maxDescLen {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "description must be at most 200 characters"})
-			return
-		}
-		atLeastOneField = true
+	if err := validation.Task(&task, taskService.Workflow().Statuses()).Err(); err != nil {
+		respondError(c, err)
+		return
 	}
-	if task.Status != "" {
-		if !isValidStatus(task.Status) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
-			return
+	updated, err := taskService.Modify(c.Request.Context(), taskID, func(current *model.Task) error {
+		if err := checkIfMatch(c, current); err != nil {
+			return err
 		}
-		atLeastOneField = true
+		task.Version = current.Version
+		task.SeriesID, task.Occurrence = current.SeriesID, current.Occurrence
+		task.NextReminderAt, task.OverdueAt = current.NextReminderAt, current.OverdueAt
+		*current = task
+		return nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
 	}
-	if task.DueDate != "" {
-		if !isValidISO8601(task.DueDate) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "due_date must be ISO 8601 format (RFC3339)"})
-			return
-		}
-		atLeastOneField = true
+	writeTask(c, http.StatusOK, updated)
+}
+
+// patchTask applies a JSON Merge Patch (RFC 7396) to a task: fields in the
+// patch are replaced, null fields are cleared and the rest are kept
+func patchTask(c *gin.Context, taskService *service.TaskService) {
+	taskID, ok := getParam(c, "task_id")
+	if !ok {
+		return
 	}
-	if !atLeastOneField {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one field must be updated"})
+	patch, ok := readMergePatch(c, patchableTaskFields, readOnlyTaskFields)
+	if !ok {
 		return
 	}
-	task.ID = taskID
-	err := taskService.Update(&task)
+	task, err := taskService.Modify(c.Request.Context(), taskID, func(task *model.Task) error {
+		if err := checkIfMatch(c, task); err != nil {
+			return err
+		}
+		if err := applyMergePatch(task, patch); err != nil {
+			return err
+		}
+		return validation.Task(task, taskService.Workflow().Statuses()).Err()
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, task)
+	writeTask(c, http.StatusOK, task)
 }
 
 func deleteTask(c *gin.Context, taskService *service.TaskService) {
@@ -258,8 +513,36 @@ func deleteTask(c *gin.Context, taskService *service.TaskService) {
 	if !ok {
 		return
 	}
-	if err := taskService.Delete(taskID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := taskService.Delete(c.Request.Context(), taskID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+type bulkStatusRequest struct {
+	TaskIDs []string `json:"task_ids"`
+	Status  string   `json:"status"`
+}
+
+func bulkUpdateStatus(c *gin.Context, taskService *service.TaskService) {
+	var req bulkStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	if len(req.TaskIDs) == 0 {
+		respondError(c, invalidField("task_ids", "task_ids must not be empty"))
+		return
+	}
+	var errs validation.Errors
+	if errs.Check("status", req.Status, validation.OneOf(taskService.Workflow().Statuses()...)); len(errs) > 0 {
+		respondError(c, errs)
+		return
+	}
+	err := taskService.UpdateStatuses(c.Request.Context(), req.TaskIDs, req.Status)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 	c.Status(http.StatusOK)
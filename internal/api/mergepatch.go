@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mergePatchContentType is the media type of JSON Merge Patch documents
+const mergePatchContentType = "application/merge-patch+json"
+
+// The task fields a merge patch may set or clear, and those it must not touch
+var (
+	patchableTaskFields = []string{"title", "description", "due_date", "status", "priority", "tags", "parent_id", "recurrence", "reminders"}
+	readOnlyTaskFields  = []string{"id", "user_id", "created_at", "updated_at", "version", "progress", "blocked", "series_id", "occurrence",
+		"next_reminder_at", "overdue_at"}
+)
+
+// The fields a series patch may set; the others belong to single occurrences
+var (
+	patchableSeriesFields = []string{"title", "description", "priority", "tags", "recurrence", "reminders"}
+	readOnlySeriesFields  = append([]string{"due_date", "status", "parent_id"}, readOnlyTaskFields...)
+)
+
+// readMergePatch reads a non-empty merge patch from the request body and
+// responds with an error if there is none
+func readMergePatch(c *gin.Context, allowed, readOnly []string) (map[string]any, bool) {
+	if ct := c.ContentType(); ct != mergePatchContentType && ct != gin.MIMEJSON {
+		respondError(c, &apiError{
+			status: http.StatusUnsupportedMediaType,
+			code:   codeUnsupportedMediaType,
+			detail: "content type must be " + mergePatchContentType,
+		})
+		return nil, false
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return nil, false
+	}
+	patch, err := parseMergePatch(body, allowed, readOnly)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return nil, false
+	}
+	if len(patch) == 0 {
+		respondError(c, badRequest("at least one field must be updated"))
+		return nil, false
+	}
+	return patch, true
+}
+
+// parseMergePatch decodes a merge patch, which must be a JSON object whose
+// members are all in allowed
+func parseMergePatch(body []byte, allowed, readOnly []string) (map[string]any, error) {
+	var patch map[string]any
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return nil, badRequest("patch must be a JSON object")
+	}
+	for field := range patch {
+		if slices.Contains(readOnly, field) {
+			return nil, invalidField(field, field+" cannot be changed")
+		}
+		if !slices.Contains(allowed, field) {
+			return nil, invalidField(field, "unknown field "+field)
+		}
+	}
+	return patch, nil
+}
+
+// mergePatch applies patch to target as described in RFC 7396
+func mergePatch(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	doc, ok := target.(map[string]any)
+	if !ok {
+		doc = map[string]any{}
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(doc, name)
+		} else {
+			doc[name] = mergePatch(doc[name], value)
+		}
+	}
+	return doc
+}
+
+// applyMergePatch patches v through its JSON form; cleared fields take their
+// zero value
+func applyMergePatch[T any](v *T, patch map[string]any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(mergePatch(doc, patch)); err != nil {
+		return err
+	}
+	var patched T
+	if err := json.Unmarshal(data, &patched); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return invalidField(typeErr.Field, fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type))
+		}
+		return err
+	}
+	*v = patched
+	return nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"task-manager/internal/webhook"
+	"task-manager/internal/workflow"
+)
+
+// DefaultQueryTimeout bounds the time a single request may spend in the database
+const DefaultQueryTimeout = 5 * time.Second
+
+type config struct {
+	queryTimeout time.Duration
+	jwtSecret    []byte
+	workflow     *workflow.Workflow
+	webhookGuard *webhook.Guard
+}
+
+// Option customizes RegisterRoutes
+type Option func(*config)
+
+// WithQueryTimeout sets the per-request deadline for database work; zero disables it
+func WithQueryTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.queryTimeout = d
+	}
+}
+
+// WithJWTSecret sets the key that signs session tokens. Without it a random
+// key is generated, so sessions do not survive a restart; the server only
+// allows that in development.
+func WithJWTSecret(secret []byte) Option {
+	return func(c *config) {
+		c.jwtSecret = secret
+	}
+}
+
+// WithWorkflow sets the task statuses and the transitions allowed between
+// them; workflow.Default is used otherwise
+func WithWorkflow(wf *workflow.Workflow) Option {
+	return func(c *config) {
+		c.workflow = wf
+	}
+}
+
+// WithWebhookGuard sets the guard that webhook URLs must pass; only URLs
+// that resolve to public addresses are accepted otherwise
+func WithWebhookGuard(g *webhook.Guard) Option {
+	return func(c *config) {
+		c.webhookGuard = g
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{queryTimeout: DefaultQueryTimeout, workflow: workflow.Default}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(cfg.jwtSecret) == 0 {
+		cfg.jwtSecret = make([]byte, 32)
+		// A predictable key would let anyone forge sessions
+		if _, err := rand.Read(cfg.jwtSecret); err != nil {
+			panic(fmt.Sprintf("generating a JWT secret: %v", err))
+		}
+	}
+	return cfg
+}
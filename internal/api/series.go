@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"task-manager/internal/model"
+	"task-manager/internal/service"
+	"task-manager/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Recurring Task Handlers ---
+
+// patchSeries applies a JSON Merge Patch to every unfinished occurrence of
+// the series a task belongs to, and so to the occurrences still to come
+func patchSeries(c *gin.Context, taskService *service.TaskService) {
+	taskID, ok := getParam(c, "task_id")
+	if !ok {
+		return
+	}
+	patch, ok := readMergePatch(c, patchableSeriesFields, readOnlySeriesFields)
+	if !ok {
+		return
+	}
+	tasks, err := taskService.ModifySeries(c.Request.Context(), taskID, func(task *model.Task) error {
+		if err := applyMergePatch(task, patch); err != nil {
+			return err
+		}
+		return validation.Task(task, taskService.Workflow().Statuses()).Err()
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, listResponse[model.Task]{Items: tasks})
+}
+
+// skipOccurrence moves an occurrence on to the date of the next one
+func skipOccurrence(c *gin.Context, taskService *service.TaskService) {
+	taskID, ok := getParam(c, "task_id")
+	if !ok {
+		return
+	}
+	task, err := taskService.SkipOccurrence(c.Request.Context(), taskID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	writeTask(c, http.StatusOK, task)
+}
+
+// stopSeries keeps the unfinished occurrences of a series but stops them
+// from recurring
+func stopSeries(c *gin.Context, taskService *service.TaskService) {
+	taskID, ok := getParam(c, "task_id")
+	if !ok {
+		return
+	}
+	tasks, err := taskService.StopSeries(c.Request.Context(), taskID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, listResponse[model.Task]{Items: tasks})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+
+	"task-manager/internal/model"
+	"task-manager/internal/service"
+	"task-manager/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Tag Handlers ---
+
+type tagRequest struct {
+	Name string `json:"name"`
+}
+
+// bindTag reads and validates the tag name in the request body
+func bindTag(c *gin.Context) (model.Tag, bool) {
+	var req tagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, badRequest(err.Error()))
+		return model.Tag{}, false
+	}
+	tag := model.Tag{Name: req.Name}
+	if errs := validation.Tag(&tag); len(errs) > 0 {
+		respondError(c, errs)
+		return tag, false
+	}
+	return tag, true
+}
+
+func createTagHandler(tagService *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		req, ok := bindTag(c)
+		if !ok {
+			return
+		}
+		tag, err := tagService.Create(c.Request.Context(), userID, req.Name)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, tag)
+	}
+}
+
+func listTagsHandler(tagService *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		tags, err := tagService.List(c.Request.Context(), userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, listResponse[model.Tag]{Items: tags})
+	}
+}
+
+func renameTagHandler(tagService *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		tagID, ok := getParam(c, "tag_id")
+		if !ok {
+			return
+		}
+		req, ok := bindTag(c)
+		if !ok {
+			return
+		}
+		tag, err := tagService.Rename(c.Request.Context(), userID, tagID, req.Name)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, tag)
+	}
+}
+
+func deleteTagHandler(tagService *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		tagID, ok := getParam(c, "tag_id")
+		if !ok {
+			return
+		}
+		if err := tagService.Delete(c.Request.Context(), userID, tagID); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
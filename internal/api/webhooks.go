@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+
+	"task-manager/internal/model"
+	"task-manager/internal/service"
+	"task-manager/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Webhook Handlers ---
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// createdWebhookResponse is a new webhook together with the secret its
+// deliveries are signed with, which is not shown again
+type createdWebhookResponse struct {
+	model.Webhook
+	Secret string `json:"secret"`
+}
+
+func createWebhookHandler(webhookService *service.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		var req webhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, badRequest(err.Error()))
+			return
+		}
+		hook := model.Webhook{URL: req.URL, Events: req.Events, Secret: req.Secret}
+		if errs := validation.Webhook(&hook); len(errs) > 0 {
+			respondError(c, errs)
+			return
+		}
+		if err := webhookService.Create(c.Request.Context(), userID, &hook); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, createdWebhookResponse{Webhook: hook, Secret: hook.Secret})
+	}
+}
+
+func listWebhooksHandler(webhookService *service.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		hooks, err := webhookService.List(c.Request.Context(), userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, listResponse[model.Webhook]{Items: hooks})
+	}
+}
+
+func getWebhookHandler(webhookService *service.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		webhookID, ok := getParam(c, "webhook_id")
+		if !ok {
+			return
+		}
+		hook, err := webhookService.Get(c.Request.Context(), userID, webhookID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, hook)
+	}
+}
+
+func deleteWebhookHandler(webhookService *service.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		webhookID, ok := getParam(c, "webhook_id")
+		if !ok {
+			return
+		}
+		if err := webhookService.Delete(c.Request.Context(), userID, webhookID); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// listDeliveriesHandler pages through the delivery log of a webhook
+func listDeliveriesHandler(webhookService *service.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getParam(c, "user_id")
+		if !ok {
+			return
+		}
+		webhookID, ok := getParam(c, "webhook_id")
+		if !ok {
+			return
+		}
+		page, ok := parsePage(c)
+		if !ok {
+			return
+		}
+		deliveries, next, err := webhookService.Deliveries(c.Request.Context(), userID, webhookID, page)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, listResponse[model.WebhookDelivery]{Items: deliveries, NextCursor: next})
+	}
+}
@@ -0,0 +1,19 @@
+// Package clock lets background workers tell the time through an interface
+// that tests can replace, to control both the time and how long waits take.
+package clock
+
+import "time"
+
+// Clock tells the time and waits for it to pass
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type system struct{}
+
+func (system) Now() time.Time                         { return time.Now() }
+func (system) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// System is the clock of the machine
+var System Clock = system{}
@@ -0,0 +1,1162 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// describeConformance runs the shared DB scenarios against the
+// implementation returned by open, which must start out empty
+func describeConformance(name string, open func() db.DB) bool {
+	return Describe(name+" conformance", func() {
+		var testDB db.DB
+		var testUser *model.User
+		ctx := context.Background()
+
+		BeforeEach(func() {
+			testDB = open()
+
+			testUser = &model.User{Name: "Test User", Email: "test@example.com"}
+			err := testDB.CreateUser(ctx, testUser)
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			if testDB != nil {
+				testDB.Close()
+			}
+		})
+
+		Describe("User CRUD", func() {
+			It("should create a user", func() {
+				user := &model.User{Name: "Alice", Email: "alice@example.com"}
+				err := testDB.CreateUser(ctx, user)
+				Expect(err).To(BeNil())
+				Expect(user.ID).NotTo(BeEmpty())
+			})
+
+			It("should get a user", func() {
+				got, err := testDB.GetUser(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Name).To(Equal("Test User"))
+				Expect(got.Email).To(Equal("test@example.com"))
+			})
+
+			It("should not get a non-existent user", func() {
+				_, err := testDB.GetUser(ctx, "non_existent_id")
+				Expect(errors.Is(err, db.ErrUserNotFound)).To(BeTrue())
+			})
+
+			It("should stop when the context is cancelled", func() {
+				cancelled, cancel := context.WithCancel(ctx)
+				cancel()
+				_, err := testDB.GetUser(cancelled, testUser.ID)
+				Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			})
+
+			It("should not create a user with a duplicate email", func() {
+				user := &model.User{Name: "Other", Email: "test@example.com"}
+				err := testDB.CreateUser(ctx, user)
+				Expect(errors.Is(err, db.ErrEmailTaken)).To(BeTrue())
+			})
+
+			It("should treat emails that differ only in case as the same", func() {
+				user := &model.User{Name: "Other", Email: "Test@Example.com"}
+				err := testDB.CreateUser(ctx, user)
+				Expect(errors.Is(err, db.ErrEmailTaken)).To(BeTrue())
+				got, err := testDB.GetUserByEmail(ctx, " TEST@example.COM ")
+				Expect(err).To(BeNil())
+				Expect(got.ID).To(Equal(testUser.ID))
+			})
+
+			It("should list users", func() {
+				users, _, err := testDB.ListUsers(ctx, db.Page{})
+				Expect(err).To(BeNil())
+				Expect(users).NotTo(BeEmpty())
+			})
+
+			It("should delete a user", func() {
+				err := testDB.DeleteUser(ctx, testUser.ID, false)
+				Expect(err).To(BeNil())
+				users, _, err := testDB.ListUsers(ctx, db.Page{})
+				Expect(err).To(BeNil())
+				found := false
+				for _, u := range users {
+					if u.ID == testUser.ID {
+						found = true
+					}
+				}
+				Expect(found).To(BeFalse())
+			})
+
+			It("should not delete a non-existent user", func() {
+				err := testDB.DeleteUser(ctx, "non_existent_id", false)
+				Expect(errors.Is(err, db.ErrUserNotFound)).To(BeTrue())
+			})
+		})
+
+		Describe("Task CRUD", func() {
+			var task *model.Task
+
+			BeforeEach(func() {
+				task = &model.Task{
+					Title:       "Test Task",
+					Description: "This is a test task",
+					DueDate:     "2023-12-31T10:00:00Z",
+					Status:      "pending",
+					UserID:      testUser.ID,
+				}
+				err := testDB.CreateTask(ctx, task)
+				Expect(err).To(BeNil())
+			})
+
+			It("should create a task", func() {
+				Expect(task.ID).NotTo(BeEmpty())
+			})
+
+			It("should list tasks", func() {
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(1))
+			})
+
+			It("should get a task by ID", func() {
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Title).To(Equal("Test Task"))
+				Expect(got.Description).To(Equal("This is a test task"))
+				Expect(got.DueDate).To(Equal("2023-12-31T10:00:00Z"))
+				Expect(got.Status).To(Equal("pending"))
+				Expect(got.UserID).To(Equal(testUser.ID))
+			})
+
+			It("should get task based on status filter", func() {
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{Statuses: []string{"pending"}})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(1))
+				Expect(tasks[0].Title).To(Equal("Test Task"))
+			})
+
+			It("should update a task", func() {
+				task.Title = "Updated Task"
+				err := testDB.UpdateTask(ctx, task)
+				Expect(err).To(BeNil())
+
+				updatedTask, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(updatedTask.Title).To(Equal("Updated Task"))
+			})
+
+			It("should replace every editable field and return the stored task", func() {
+				replacement := &model.Task{ID: task.ID, UserID: testUser.ID, Title: "Replaced", DueDate: "2024-01-01T00:00:00Z", Status: "done"}
+				Expect(testDB.UpdateTask(ctx, replacement)).To(Succeed())
+				Expect(replacement.Description).To(BeEmpty())
+				Expect(replacement.CreatedAt).To(Equal(task.CreatedAt))
+				Expect(replacement.UpdatedAt).NotTo(BeEmpty())
+
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(*got).To(Equal(*replacement))
+			})
+
+			It("should bump the version on every update", func() {
+				Expect(task.Version).To(Equal(1))
+				Expect(testDB.UpdateTask(ctx, task)).To(Succeed())
+				Expect(task.Version).To(Equal(2))
+
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Version).To(Equal(2))
+			})
+
+			It("should only update the expected version", func() {
+				stale := *task
+				Expect(testDB.UpdateTask(ctx, task)).To(Succeed())
+
+				stale.Title = "Stale Title"
+				Expect(testDB.UpdateTask(ctx, &stale)).To(MatchError(db.ErrVersionConflict))
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Title).To(Equal("Test Task"))
+
+				missing := &model.Task{ID: "non_existent_id", UserID: testUser.ID, Title: "Missing", Version: 1}
+				Expect(testDB.UpdateTask(ctx, missing)).To(MatchError(db.ErrTaskNotFound))
+			})
+
+			It("should manage created and updated timestamps", func() {
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.CreatedAt).NotTo(BeEmpty())
+				Expect(got.UpdatedAt).To(Equal(got.CreatedAt))
+				Expect(testUser.UpdatedAt).To(Equal(testUser.CreatedAt))
+
+				// Timestamps have microsecond precision
+				time.Sleep(time.Millisecond)
+				Expect(testDB.UpdateTask(ctx, &model.Task{ID: task.ID, UserID: testUser.ID, Status: "done"})).To(Succeed())
+				updated, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(updated.CreatedAt).To(Equal(got.CreatedAt))
+				Expect(updated.UpdatedAt > got.UpdatedAt).To(BeTrue())
+			})
+
+			It("should list tasks updated since a time and sort by update time", func() {
+				other := &model.Task{Title: "Other Task", DueDate: "2023-12-31T10:00:00Z", Status: "pending", UserID: testUser.ID}
+				Expect(testDB.CreateTask(ctx, other)).To(Succeed())
+				time.Sleep(time.Millisecond)
+				Expect(testDB.UpdateTask(ctx, &model.Task{ID: task.ID, UserID: testUser.ID, Status: "done"})).To(Succeed())
+				updated, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{UpdatedSince: updated.UpdatedAt})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(1))
+				Expect(tasks[0].ID).To(Equal(task.ID))
+
+				tasks, _, err = testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{Page: db.Page{Sort: "updated_at", Desc: true}})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(2))
+				Expect(tasks[0].ID).To(Equal(task.ID))
+			})
+
+			It("should delete a task", func() {
+				err := testDB.DeleteTask(ctx, task.ID, testUser.ID)
+				Expect(err).To(BeNil())
+
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(0))
+			})
+
+			It("should not delete a task with wrong user ID", func() {
+				err := testDB.DeleteTask(ctx, task.ID, "wrong_user_id")
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("task not found"))
+			})
+
+			It("should not create a task for a non-existent user", func() {
+				orphan := &model.Task{Title: "Orphan", DueDate: "2023-12-31T10:00:00Z", Status: "pending", UserID: "non_existent_id"}
+				err := testDB.CreateTask(ctx, orphan)
+				Expect(errors.Is(err, db.ErrUserNotFound)).To(BeTrue())
+			})
+
+			It("should refuse to delete a user who still owns tasks", func() {
+				err := testDB.DeleteUser(ctx, testUser.ID, false)
+				var hasTasks *db.UserHasTasksError
+				Expect(errors.As(err, &hasTasks)).To(BeTrue())
+				Expect(hasTasks.TaskCount).To(Equal(1))
+				Expect(errors.Is(err, db.ErrUserHasTasks)).To(BeTrue())
+
+				_, err = testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+			})
+
+			It("should delete a user and their tasks when cascading", func() {
+				err := testDB.DeleteUser(ctx, testUser.ID, true)
+				Expect(err).To(BeNil())
+
+				_, err = testDB.GetUser(ctx, testUser.ID)
+				Expect(errors.Is(err, db.ErrUserNotFound)).To(BeTrue())
+				_, err = testDB.GetTask(ctx, task.ID)
+				Expect(errors.Is(err, db.ErrTaskNotFound)).To(BeTrue())
+			})
+
+			It("should not get a non-existent task", func() {
+				_, err := testDB.GetTask(ctx, "non_existent_id")
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("task not found"))
+			})
+
+			It("should not update a non-existent task", func() {
+				task.ID = "non_existent_id"
+				err := testDB.UpdateTask(ctx, task)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("task not found"))
+			})
+		})
+
+		Describe("API tokens", func() {
+			It("should find the owner of a token by its hash", func() {
+				Expect(testUser.Role).To(Equal(model.RoleMember))
+				token := &model.APIToken{UserID: testUser.ID, Name: "laptop"}
+				Expect(testDB.CreateAPIToken(ctx, token, "hash-1")).To(Succeed())
+				Expect(token.ID).NotTo(BeEmpty())
+
+				user, err := testDB.GetUserByTokenHash(ctx, "hash-1")
+				Expect(err).To(BeNil())
+				Expect(user.ID).To(Equal(testUser.ID))
+				_, err = testDB.GetUserByTokenHash(ctx, "hash-2")
+				Expect(errors.Is(err, db.ErrTokenNotFound)).To(BeTrue())
+			})
+
+			It("should list and delete a user's tokens", func() {
+				first := &model.APIToken{UserID: testUser.ID, Name: "first"}
+				second := &model.APIToken{UserID: testUser.ID, Name: "second"}
+				Expect(testDB.CreateAPIToken(ctx, first, "hash-1")).To(Succeed())
+				Expect(testDB.CreateAPIToken(ctx, second, "hash-2")).To(Succeed())
+
+				tokens, err := testDB.ListAPITokens(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(tokens).To(HaveLen(2))
+
+				Expect(testDB.DeleteAPIToken(ctx, first.ID, "someone-else")).To(MatchError(db.ErrTokenNotFound))
+				Expect(testDB.DeleteAPIToken(ctx, first.ID, testUser.ID)).To(Succeed())
+				tokens, err = testDB.ListAPITokens(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(tokens).To(ConsistOf(*second))
+			})
+
+			It("should not create a token for a non-existent user", func() {
+				err := testDB.CreateAPIToken(ctx, &model.APIToken{UserID: "missing", Name: "x"}, "hash-1")
+				Expect(errors.Is(err, db.ErrUserNotFound)).To(BeTrue())
+			})
+
+			It("should delete a user's tokens with the user", func() {
+				Expect(testDB.CreateAPIToken(ctx, &model.APIToken{UserID: testUser.ID, Name: "laptop"}, "hash-1")).To(Succeed())
+				Expect(testDB.DeleteUser(ctx, testUser.ID, false)).To(Succeed())
+				_, err := testDB.GetUserByTokenHash(ctx, "hash-1")
+				Expect(errors.Is(err, db.ErrTokenNotFound)).To(BeTrue())
+			})
+		})
+
+		Describe("Webhooks", func() {
+			var hook *model.Webhook
+
+			BeforeEach(func() {
+				hook = &model.Webhook{UserID: testUser.ID, URL: "https://example.com/hook", Events: []string{"task.created", "task.deleted"}, Secret: "secret"}
+				Expect(testDB.CreateWebhook(ctx, hook)).To(Succeed())
+			})
+
+			delivery := func(webhookID, status, nextAttemptAt string) *model.WebhookDelivery {
+				d := &model.WebhookDelivery{WebhookID: webhookID, EventID: "event", Event: "task.created", URL: "https://example.com/hook",
+					Payload: []byte(`{"type":"task.created"}`), Signature: "sha256=00", Status: status, NextAttemptAt: nextAttemptAt}
+				Expect(testDB.CreateDelivery(ctx, d)).To(Succeed())
+				return d
+			}
+
+			It("should store, list and delete a user's webhooks", func() {
+				Expect(hook.ID).NotTo(BeEmpty())
+				got, err := testDB.GetWebhook(ctx, hook.ID, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(*got).To(Equal(*hook))
+				_, err = testDB.GetWebhook(ctx, hook.ID, "someone-else")
+				Expect(errors.Is(err, db.ErrWebhookNotFound)).To(BeTrue())
+
+				second := &model.Webhook{UserID: testUser.ID, URL: "https://example.com/other", Events: []string{"user.deleted"}, Secret: "other"}
+				Expect(testDB.CreateWebhook(ctx, second)).To(Succeed())
+				hooks, err := testDB.ListWebhooks(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(hooks).To(ConsistOf(*hook, *second))
+
+				Expect(testDB.DeleteWebhook(ctx, hook.ID, "someone-else")).To(MatchError(db.ErrWebhookNotFound))
+				Expect(testDB.DeleteWebhook(ctx, hook.ID, testUser.ID)).To(Succeed())
+				hooks, err = testDB.ListWebhooks(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(hooks).To(Equal([]model.Webhook{*second}))
+			})
+
+			It("should not create a webhook for a non-existent user", func() {
+				err := testDB.CreateWebhook(ctx, &model.Webhook{UserID: "missing", URL: "https://example.com", Events: []string{"task.created"}})
+				Expect(errors.Is(err, db.ErrUserNotFound)).To(BeTrue())
+			})
+
+			It("should queue deliveries and record their attempts", func() {
+				first := delivery(hook.ID, model.DeliveryPending, "2025-03-10T08:00:00Z")
+				delivery(hook.ID, model.DeliveryPending, "2025-03-10T09:00:00Z")
+				delivery(hook.ID, model.DeliverySucceeded, "")
+
+				now := time.Date(2025, 3, 10, 8, 30, 0, 0, time.UTC)
+				pending, err := testDB.ListPendingDeliveries(ctx, now, 10)
+				Expect(err).To(BeNil())
+				Expect(pending).To(HaveLen(1))
+				Expect(pending[0].ID).To(Equal(first.ID))
+				Expect(string(pending[0].Payload)).To(Equal(`{"type":"task.created"}`))
+				Expect(pending[0].Signature).To(Equal("sha256=00"))
+
+				first.Attempts, first.ResponseStatus, first.Error = 1, 500, "unexpected response status 500"
+				first.NextAttemptAt = "2025-03-10T09:30:00Z"
+				Expect(testDB.UpdateDelivery(ctx, first)).To(Succeed())
+				pending, err = testDB.ListPendingDeliveries(ctx, now, 10)
+				Expect(err).To(BeNil())
+				Expect(pending).To(BeEmpty())
+
+				deliveries, next, err := testDB.ListDeliveries(ctx, hook.ID, db.Page{Limit: 2})
+				Expect(err).To(BeNil())
+				Expect(deliveries).To(HaveLen(2))
+				Expect(next).NotTo(BeEmpty())
+				rest, next, err := testDB.ListDeliveries(ctx, hook.ID, db.Page{Limit: 2, Cursor: next})
+				Expect(err).To(BeNil())
+				Expect(rest).To(HaveLen(1))
+				Expect(next).To(BeEmpty())
+				deliveries = append(deliveries, rest...)
+				i := slices.IndexFunc(deliveries, func(d model.WebhookDelivery) bool { return d.ID == first.ID })
+				Expect(i).NotTo(Equal(-1))
+				Expect(deliveries[i].Attempts).To(Equal(1))
+				Expect(deliveries[i].ResponseStatus).To(Equal(500))
+				Expect(deliveries[i].NextAttemptAt).To(Equal("2025-03-10T09:30:00Z"))
+			})
+
+			It("should delete the deliveries of a webhook with it", func() {
+				delivery(hook.ID, model.DeliveryPending, "2025-03-10T08:00:00Z")
+				Expect(testDB.DeleteWebhook(ctx, hook.ID, testUser.ID)).To(Succeed())
+				deliveries, _, err := testDB.ListDeliveries(ctx, hook.ID, db.Page{})
+				Expect(err).To(BeNil())
+				Expect(deliveries).To(BeEmpty())
+			})
+
+			It("should keep the pending deliveries of a deleted user", func() {
+				pending := delivery(hook.ID, model.DeliveryPending, "2025-03-10T08:00:00Z")
+				delivery(hook.ID, model.DeliveryFailed, "")
+				Expect(testDB.DeleteUser(ctx, testUser.ID, false)).To(Succeed())
+
+				hooks, err := testDB.ListWebhooks(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(hooks).To(BeEmpty())
+				deliveries, _, err := testDB.ListDeliveries(ctx, hook.ID, db.Page{})
+				Expect(err).To(BeNil())
+				Expect(deliveries).To(HaveLen(1))
+				Expect(deliveries[0].ID).To(Equal(pending.ID))
+			})
+		})
+
+		Describe("Tags", func() {
+			var task *model.Task
+
+			BeforeEach(func() {
+				task = &model.Task{Title: "Write report", DueDate: "2024-01-10T09:00:00Z", Status: "pending", UserID: testUser.ID, Tags: []string{"work", "q4", "work"}}
+				Expect(testDB.CreateTask(ctx, task)).To(Succeed())
+			})
+
+			tagNamed := func(name string) model.Tag {
+				tags, err := testDB.ListTags(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				for _, t := range tags {
+					if t.Name == name {
+						return t
+					}
+				}
+				Fail("no tag named " + name)
+				return model.Tag{}
+			}
+
+			It("should create missing tags and attach them to the task", func() {
+				Expect(task.Tags).To(Equal([]string{"q4", "work"}))
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Tags).To(Equal([]string{"q4", "work"}))
+
+				tags, err := testDB.ListTags(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(tags).To(HaveLen(2))
+				Expect(tags[0].Name).To(Equal("q4"))
+				Expect(tags[1].UserID).To(Equal(testUser.ID))
+			})
+
+			It("should return an empty list for untagged tasks", func() {
+				untagged := &model.Task{Title: "Untagged", DueDate: "2024-01-10T09:00:00Z", Status: "pending", UserID: testUser.ID}
+				Expect(testDB.CreateTask(ctx, untagged)).To(Succeed())
+				got, err := testDB.GetTask(ctx, untagged.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Tags).NotTo(BeNil())
+				Expect(got.Tags).To(BeEmpty())
+			})
+
+			It("should replace the tags of a task on update", func() {
+				task.Tags = []string{"home"}
+				Expect(testDB.UpdateTask(ctx, task)).To(Succeed())
+				Expect(task.Tags).To(Equal([]string{"home"}))
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Tags).To(Equal([]string{"home"}))
+				// Tags that are no longer used are kept
+				Expect(tagNamed("work").ID).NotTo(BeEmpty())
+			})
+
+			It("should filter tasks by any or all of their tags", func() {
+				other := &model.Task{Title: "Tidy desk", DueDate: "2024-01-10T09:00:00Z", Status: "pending", UserID: testUser.ID, Tags: []string{"work"}}
+				Expect(testDB.CreateTask(ctx, other)).To(Succeed())
+				titles := func(q db.TaskQuery) []string {
+					tasks, _, err := testDB.ListTasks(ctx, testUser.ID, q)
+					Expect(err).To(BeNil())
+					var out []string
+					for _, t := range tasks {
+						out = append(out, t.Title)
+					}
+					return out
+				}
+				Expect(titles(db.TaskQuery{Tags: []string{"q4", "home"}})).To(ConsistOf("Write report"))
+				Expect(titles(db.TaskQuery{Tags: []string{"q4", "work"}})).To(ConsistOf("Write report", "Tidy desk"))
+				Expect(titles(db.TaskQuery{Tags: []string{"q4", "work", "work"}, AllTags: true})).To(ConsistOf("Write report"))
+				Expect(titles(db.TaskQuery{Tags: []string{"work"}, AllTags: true, Page: db.Page{Sort: "title"}})).To(Equal([]string{"Tidy desk", "Write report"}))
+				Expect(titles(db.TaskQuery{Tags: []string{"missing"}})).To(BeEmpty())
+			})
+
+			It("should reject duplicate tag names", func() {
+				Expect(testDB.CreateTag(ctx, &model.Tag{UserID: testUser.ID, Name: "work"})).To(MatchError(db.ErrTagExists))
+				home := &model.Tag{UserID: testUser.ID, Name: "home"}
+				Expect(testDB.CreateTag(ctx, home)).To(Succeed())
+				Expect(home.ID).NotTo(BeEmpty())
+				Expect(testDB.RenameTag(ctx, &model.Tag{ID: home.ID, UserID: testUser.ID, Name: "q4"})).To(MatchError(db.ErrTagExists))
+
+				alice := &model.User{Name: "Alice", Email: "alice@example.com"}
+				Expect(testDB.CreateUser(ctx, alice)).To(Succeed())
+				Expect(testDB.CreateTag(ctx, &model.Tag{UserID: alice.ID, Name: "work"})).To(Succeed())
+				Expect(testDB.CreateTag(ctx, &model.Tag{UserID: "missing", Name: "work"})).To(MatchError(db.ErrUserNotFound))
+			})
+
+			It("should rename a tag on every task", func() {
+				renamed := &model.Tag{ID: tagNamed("work").ID, UserID: testUser.ID, Name: "office"}
+				Expect(testDB.RenameTag(ctx, renamed)).To(Succeed())
+				Expect(renamed.CreatedAt).NotTo(BeEmpty())
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Tags).To(Equal([]string{"office", "q4"}))
+				Expect(got.Version).To(Equal(task.Version + 1))
+
+				err = testDB.RenameTag(ctx, &model.Tag{ID: renamed.ID, UserID: "someone-else", Name: "x"})
+				Expect(err).To(MatchError(db.ErrTagNotFound))
+			})
+
+			It("should delete a tag from every task", func() {
+				Expect(testDB.DeleteTag(ctx, tagNamed("q4").ID, "someone-else")).To(MatchError(db.ErrTagNotFound))
+				Expect(testDB.DeleteTag(ctx, tagNamed("q4").ID, testUser.ID)).To(Succeed())
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Tags).To(Equal([]string{"work"}))
+				Expect(got.Version).To(Equal(task.Version + 1))
+				tags, err := testDB.ListTags(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(tags).To(HaveLen(1))
+			})
+
+			It("should delete tags with their tasks and users", func() {
+				Expect(testDB.DeleteTask(ctx, task.ID, testUser.ID)).To(Succeed())
+				Expect(testDB.DeleteTag(ctx, tagNamed("work").ID, testUser.ID)).To(Succeed())
+				Expect(testDB.DeleteUser(ctx, testUser.ID, false)).To(Succeed())
+				tags, err := testDB.ListTags(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(tags).To(BeEmpty())
+			})
+
+			It("should find tagged tasks by search", func() {
+				results, err := testDB.SearchTasks(ctx, testUser.ID, "report", 0)
+				Expect(err).To(BeNil())
+				Expect(results).To(HaveLen(1))
+				Expect(results[0].Tags).To(Equal([]string{"q4", "work"}))
+			})
+		})
+
+		Describe("Subtasks", func() {
+			var parent *model.Task
+
+			BeforeEach(func() {
+				parent = &model.Task{Title: "Move house", DueDate: "2024-01-10T09:00:00Z", Status: "pending", UserID: testUser.ID}
+				Expect(testDB.CreateTask(ctx, parent)).To(Succeed())
+				for i, status := range []string{"pending", "completed", "pending"} {
+					child := &model.Task{Title: fmt.Sprintf("Step %d", i+1), DueDate: "2024-01-10T09:00:00Z", Status: status, UserID: testUser.ID, ParentID: parent.ID}
+					Expect(testDB.CreateTask(ctx, child)).To(Succeed())
+				}
+			})
+
+			It("should list the subtasks of a task", func() {
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{ParentID: parent.ID, Page: db.Page{Sort: "title"}})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(3))
+				Expect(tasks[0].Title).To(Equal("Step 1"))
+				Expect(tasks[0].ParentID).To(Equal(parent.ID))
+
+				got, err := testDB.GetTask(ctx, parent.ID)
+				Expect(err).To(BeNil())
+				Expect(got.ParentID).To(BeEmpty())
+			})
+
+			It("should count finished subtasks", func() {
+				counts, err := testDB.CountSubtasks(ctx, []string{parent.ID, "no-children"}, []string{"completed"})
+				Expect(err).To(BeNil())
+				Expect(counts).To(HaveLen(1))
+				Expect(counts[parent.ID]).To(Equal(model.Progress{Total: 3, Done: 1, Percent: 33}))
+
+				counts, err = testDB.CountSubtasks(ctx, nil, []string{"completed"})
+				Expect(err).To(BeNil())
+				Expect(counts).To(BeEmpty())
+			})
+
+			It("should detach subtasks when their parent is deleted", func() {
+				Expect(testDB.DeleteTask(ctx, parent.ID, testUser.ID)).To(Succeed())
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(3))
+				for _, t := range tasks {
+					Expect(t.ParentID).To(BeEmpty())
+					Expect(t.Version).To(Equal(2))
+				}
+			})
+		})
+
+		Describe("Recurring tasks", func() {
+			It("should store the recurrence and list the occurrences of a series", func() {
+				for i := 1; i <= 2; i++ {
+					task := &model.Task{Title: fmt.Sprintf("Water plants %d", i), DueDate: "2024-01-10T09:00:00Z", Status: "pending", UserID: testUser.ID,
+						Recurrence: "FREQ=WEEKLY", SeriesID: "series-1", Occurrence: i}
+					Expect(testDB.CreateTask(ctx, task)).To(Succeed())
+				}
+				other := &model.Task{Title: "One-off", DueDate: "2024-01-10T09:00:00Z", Status: "pending", UserID: testUser.ID}
+				Expect(testDB.CreateTask(ctx, other)).To(Succeed())
+
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{SeriesID: "series-1", Page: db.Page{Sort: "title"}})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(2))
+				Expect(tasks[1].Recurrence).To(Equal("FREQ=WEEKLY"))
+				Expect(tasks[1].Occurrence).To(Equal(2))
+
+				tasks[1].Recurrence, tasks[1].Occurrence = "", 3
+				Expect(testDB.UpdateTask(ctx, &tasks[1])).To(Succeed())
+				got, err := testDB.GetTask(ctx, tasks[1].ID)
+				Expect(err).To(BeNil())
+				Expect(got.Recurrence).To(BeEmpty())
+				Expect(got.SeriesID).To(Equal("series-1"))
+				Expect(got.Occurrence).To(Equal(3))
+			})
+		})
+
+		Describe("Scheduling", func() {
+			var now time.Time
+
+			BeforeEach(func() {
+				now = time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+			})
+
+			create := func(title, due, status string, reminders []int, nextReminderAt string) *model.Task {
+				task := &model.Task{Title: title, DueDate: due, Status: status, UserID: testUser.ID, Reminders: reminders, NextReminderAt: nextReminderAt}
+				Expect(testDB.CreateTask(ctx, task)).To(Succeed())
+				return task
+			}
+
+			It("should store reminders largest first", func() {
+				task := create("Standup", "2025-03-10T10:00:00Z", "pending", []int{15, 60, 15}, "2025-03-10T09:00:00Z")
+				Expect(task.Reminders).To(Equal([]int{60, 15}))
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Reminders).To(Equal([]int{60, 15}))
+				Expect(got.NextReminderAt).To(Equal("2025-03-10T09:00:00Z"))
+
+				got.Reminders, got.NextReminderAt, got.OverdueAt = nil, "", "2025-03-10T10:00:00Z"
+				Expect(testDB.UpdateTask(ctx, got)).To(Succeed())
+				got, err = testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Reminders).To(Equal([]int{}))
+				Expect(got.NextReminderAt).To(BeEmpty())
+				Expect(got.OverdueAt).To(Equal("2025-03-10T10:00:00Z"))
+			})
+
+			It("should list the reminders that are due for every user", func() {
+				other := &model.User{Name: "Other", Email: "other@example.com"}
+				Expect(testDB.CreateUser(ctx, other)).To(Succeed())
+				later := create("Later", "2025-03-10T09:00:00Z", "pending", []int{60}, "2025-03-10T08:00:00Z")
+				earlier := &model.Task{Title: "Earlier", DueDate: "2025-03-10T09:00:00Z", Status: "pending", UserID: other.ID,
+					Reminders: []int{90}, NextReminderAt: "2025-03-10T07:30:00Z", Tags: []string{"work"}}
+				Expect(testDB.CreateTask(ctx, earlier)).To(Succeed())
+				create("Not yet", "2025-03-10T10:00:00Z", "pending", []int{60}, "2025-03-10T09:00:00Z")
+				create("Finished", "2025-03-10T09:00:00Z", "done", []int{60}, "2025-03-10T08:00:00Z")
+				create("No reminders", "2025-03-10T07:00:00Z", "pending", nil, "")
+
+				tasks, err := testDB.ListDueReminders(ctx, now, []string{"done"}, 10)
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(2))
+				Expect(tasks[0].ID).To(Equal(earlier.ID))
+				Expect(tasks[0].Tags).To(Equal([]string{"work"}))
+				Expect(tasks[1].ID).To(Equal(later.ID))
+
+				tasks, err = testDB.ListDueReminders(ctx, now, []string{"done"}, 1)
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(1))
+			})
+
+			It("should list the tasks that became overdue", func() {
+				late := create("Late", "2025-03-10T07:00:00Z", "pending", nil, "")
+				create("Due now", "2025-03-10T08:00:00Z", "pending", nil, "")
+				create("Long overdue", "2025-03-09T07:00:00Z", "pending", nil, "")
+				create("Finished", "2025-03-10T07:00:00Z", "done", nil, "")
+				flagged := create("Flagged", "2025-03-10T06:00:00Z", "pending", nil, "")
+				flagged.OverdueAt = "2025-03-10T06:01:00Z"
+				Expect(testDB.UpdateTask(ctx, flagged)).To(Succeed())
+
+				tasks, err := testDB.ListNewlyOverdue(ctx, now.Add(-24*time.Hour), now, []string{"done"}, 10)
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(1))
+				Expect(tasks[0].ID).To(Equal(late.ID))
+			})
+
+			It("should store the schedule of a task without changing its version", func() {
+				task := create("Standup", "2025-03-10T10:00:00Z", "pending", []int{60}, "2025-03-10T09:00:00Z")
+				task.NextReminderAt, task.OverdueAt = "", "2025-03-10T10:01:00Z"
+				Expect(testDB.SetTaskSchedule(ctx, task)).To(Succeed())
+				got, err := testDB.GetTask(ctx, task.ID)
+				Expect(err).To(BeNil())
+				Expect(got.NextReminderAt).To(BeEmpty())
+				Expect(got.OverdueAt).To(Equal("2025-03-10T10:01:00Z"))
+				Expect(got.Version).To(Equal(task.Version))
+				Expect(got.UpdatedAt).To(Equal(task.UpdatedAt))
+
+				got.Title = "Daily standup"
+				Expect(testDB.UpdateTask(ctx, got)).To(Succeed())
+				Expect(testDB.SetTaskSchedule(ctx, task)).To(MatchError(db.ErrVersionConflict))
+				Expect(testDB.SetTaskSchedule(ctx, &model.Task{ID: "missing", Version: 1})).To(MatchError(db.ErrTaskNotFound))
+			})
+
+			It("should remember when the scheduler first ran", func() {
+				start, err := testDB.SchedulerStart(ctx, now)
+				Expect(err).To(BeNil())
+				Expect(start).To(Equal(now))
+				start, err = testDB.SchedulerStart(ctx, now.Add(time.Hour))
+				Expect(err).To(BeNil())
+				Expect(start).To(Equal(now))
+			})
+		})
+
+		Describe("Dependencies", func() {
+			var first, second, third *model.Task
+
+			BeforeEach(func() {
+				tasks := make([]*model.Task, 3)
+				for i := range tasks {
+					tasks[i] = &model.Task{Title: fmt.Sprintf("Step %d", i+1), DueDate: "2024-01-10T09:00:00Z", Status: "pending", UserID: testUser.ID}
+					Expect(testDB.CreateTask(ctx, tasks[i])).To(Succeed())
+				}
+				first, second, third = tasks[0], tasks[1], tasks[2]
+				Expect(testDB.AddDependency(ctx, &model.Dependency{TaskID: second.ID, BlockerID: first.ID})).To(Succeed())
+				Expect(testDB.AddDependency(ctx, &model.Dependency{TaskID: third.ID, BlockerID: second.ID})).To(Succeed())
+			})
+
+			It("should list the dependencies on either side of a task", func() {
+				deps, err := testDB.ListDependencies(ctx, second.ID)
+				Expect(err).To(BeNil())
+				Expect(deps).To(HaveLen(2))
+				Expect(deps[0].TaskID).To(Equal(second.ID))
+				Expect(deps[0].BlockerID).To(Equal(first.ID))
+				Expect(deps[0].CreatedAt).NotTo(BeEmpty())
+				Expect(deps[1].TaskID).To(Equal(third.ID))
+
+				deps, err = testDB.ListDependencies(ctx, "missing")
+				Expect(err).To(BeNil())
+				Expect(deps).NotTo(BeNil())
+				Expect(deps).To(BeEmpty())
+			})
+
+			It("should reject duplicate dependencies and unknown tasks", func() {
+				err := testDB.AddDependency(ctx, &model.Dependency{TaskID: second.ID, BlockerID: first.ID})
+				Expect(err).To(MatchError(db.ErrDependencyExists))
+				err = testDB.AddDependency(ctx, &model.Dependency{TaskID: second.ID, BlockerID: "missing"})
+				Expect(err).To(MatchError(db.ErrTaskNotFound))
+			})
+
+			It("should count the open blockers of tasks", func() {
+				counts, err := testDB.CountOpenBlockers(ctx, []string{first.ID, second.ID, third.ID}, []string{"completed"})
+				Expect(err).To(BeNil())
+				Expect(counts).To(Equal(map[string]int{second.ID: 1, third.ID: 1}))
+
+				first.Status = "completed"
+				Expect(testDB.UpdateTask(ctx, first)).To(Succeed())
+				counts, err = testDB.CountOpenBlockers(ctx, []string{second.ID, third.ID}, []string{"completed"})
+				Expect(err).To(BeNil())
+				Expect(counts).To(Equal(map[string]int{third.ID: 1}))
+			})
+
+			It("should record adding and removing dependencies as a change to the task", func() {
+				got, err := testDB.GetTask(ctx, second.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Version).To(Equal(2))
+
+				Expect(testDB.DeleteDependency(ctx, second.ID, first.ID)).To(Succeed())
+				Expect(testDB.DeleteDependency(ctx, second.ID, first.ID)).To(MatchError(db.ErrDependencyNotFound))
+				got, err = testDB.GetTask(ctx, second.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Version).To(Equal(3))
+			})
+
+			It("should drop the dependencies of deleted tasks", func() {
+				Expect(testDB.DeleteTask(ctx, second.ID, testUser.ID)).To(Succeed())
+				for _, task := range []*model.Task{first, third} {
+					deps, err := testDB.ListDependencies(ctx, task.ID)
+					Expect(err).To(BeNil())
+					Expect(deps).To(BeEmpty())
+				}
+				got, err := testDB.GetTask(ctx, third.ID)
+				Expect(err).To(BeNil())
+				Expect(got.Version).To(Equal(3))
+
+				Expect(testDB.DeleteUser(ctx, testUser.ID, true)).To(Succeed())
+			})
+		})
+
+		Describe("Roles", func() {
+			It("should change and count roles", func() {
+				count, err := testDB.CountUsersWithRole(ctx, model.RoleAdmin)
+				Expect(err).To(BeNil())
+				Expect(count).To(Equal(0))
+
+				Expect(testDB.UpdateUserRole(ctx, testUser.ID, model.RoleAdmin)).To(Succeed())
+				user, err := testDB.GetUser(ctx, testUser.ID)
+				Expect(err).To(BeNil())
+				Expect(user.Role).To(Equal(model.RoleAdmin))
+				count, err = testDB.CountUsersWithRole(ctx, model.RoleAdmin)
+				Expect(err).To(BeNil())
+				Expect(count).To(Equal(1))
+
+				Expect(testDB.UpdateUserRole(ctx, "missing", model.RoleAdmin)).To(MatchError(db.ErrUserNotFound))
+			})
+		})
+
+		Describe("Session revocation", func() {
+			It("should find users by email", func() {
+				user, err := testDB.GetUserByEmail(ctx, "test@example.com")
+				Expect(err).To(BeNil())
+				Expect(user.ID).To(Equal(testUser.ID))
+				_, err = testDB.GetUserByEmail(ctx, "nobody@example.com")
+				Expect(errors.Is(err, db.ErrUserNotFound)).To(BeTrue())
+			})
+
+			It("should revoke a token only once", func() {
+				expiry := time.Now().Add(time.Hour)
+				revoked, err := testDB.IsTokenRevoked(ctx, "jti-1")
+				Expect(err).To(BeNil())
+				Expect(revoked).To(BeFalse())
+
+				fresh, err := testDB.RevokeToken(ctx, "jti-1", expiry)
+				Expect(err).To(BeNil())
+				Expect(fresh).To(BeTrue())
+				fresh, err = testDB.RevokeToken(ctx, "jti-1", expiry)
+				Expect(err).To(BeNil())
+				Expect(fresh).To(BeFalse())
+
+				revoked, err = testDB.IsTokenRevoked(ctx, "jti-1")
+				Expect(err).To(BeNil())
+				Expect(revoked).To(BeTrue())
+			})
+
+			It("should forget revocations once the token has expired", func() {
+				_, err := testDB.RevokeToken(ctx, "jti-old", time.Now().Add(-time.Minute))
+				Expect(err).To(BeNil())
+				_, err = testDB.RevokeToken(ctx, "jti-new", time.Now().Add(time.Hour))
+				Expect(err).To(BeNil())
+				revoked, err := testDB.IsTokenRevoked(ctx, "jti-old")
+				Expect(err).To(BeNil())
+				Expect(revoked).To(BeFalse())
+			})
+		})
+
+		Describe("Transactions", func() {
+			It("should commit when the callback succeeds", func() {
+				err := testDB.WithTx(ctx, func(tx db.DB) error {
+					return tx.CreateUser(ctx, &model.User{Name: "Alice", Email: "alice@example.com"})
+				})
+				Expect(err).To(BeNil())
+				users, _, err := testDB.ListUsers(ctx, db.Page{})
+				Expect(err).To(BeNil())
+				Expect(users).To(HaveLen(2))
+			})
+
+			It("should roll back when the callback fails", func() {
+				failure := errors.New("seeding failed")
+				err := testDB.WithTx(ctx, func(tx db.DB) error {
+					user := &model.User{Name: "Alice", Email: "alice@example.com"}
+					if err := tx.CreateUser(ctx, user); err != nil {
+						return err
+					}
+					task := &model.Task{Title: "Starter", DueDate: "2023-12-31T10:00:00Z", Status: "pending", UserID: user.ID}
+					if err := tx.CreateTask(ctx, task); err != nil {
+						return err
+					}
+					return failure
+				})
+				Expect(err).To(Equal(failure))
+				users, _, err := testDB.ListUsers(ctx, db.Page{})
+				Expect(err).To(BeNil())
+				Expect(users).To(HaveLen(1))
+			})
+
+			It("should roll back and re-panic when the callback panics", func() {
+				Expect(func() {
+					testDB.WithTx(ctx, func(tx db.DB) error {
+						tx.CreateUser(ctx, &model.User{Name: "Alice", Email: "alice@example.com"})
+						panic("boom")
+					})
+				}).To(PanicWith("boom"))
+				users, _, err := testDB.ListUsers(ctx, db.Page{})
+				Expect(err).To(BeNil())
+				Expect(users).To(HaveLen(1))
+			})
+
+			It("should join an enclosing transaction when nested", func() {
+				err := testDB.WithTx(ctx, func(tx db.DB) error {
+					return tx.WithTx(ctx, func(inner db.DB) error {
+						return inner.CreateUser(ctx, &model.User{Name: "Alice", Email: "alice@example.com"})
+					})
+				})
+				Expect(err).To(BeNil())
+				users, _, err := testDB.ListUsers(ctx, db.Page{})
+				Expect(err).To(BeNil())
+				Expect(users).To(HaveLen(2))
+			})
+		})
+
+		Describe("Pagination", func() {
+			titles := []string{"delta", "alpha", "echo", "charlie", "bravo"}
+
+			BeforeEach(func() {
+				for i, title := range titles {
+					task := &model.Task{
+						Title:   title,
+						DueDate: fmt.Sprintf("2024-01-0%dT10:00:00Z", i+1),
+						Status:  "pending",
+						UserID:  testUser.ID,
+					}
+					Expect(testDB.CreateTask(ctx, task)).To(Succeed())
+				}
+			})
+
+			collect := func(q db.TaskQuery) []string {
+				var seen []string
+				for {
+					tasks, next, err := testDB.ListTasks(ctx, testUser.ID, q)
+					Expect(err).To(BeNil())
+					Expect(len(tasks)).To(BeNumerically("<=", q.Limit))
+					for _, t := range tasks {
+						seen = append(seen, t.Title)
+					}
+					if next == "" {
+						return seen
+					}
+					q.Cursor = next
+				}
+			}
+
+			It("should walk every page in sort order", func() {
+				Expect(collect(db.TaskQuery{Page: db.Page{Sort: "title", Limit: 2}})).To(Equal(
+					[]string{"alpha", "bravo", "charlie", "delta", "echo"}))
+			})
+
+			It("should walk every page in descending order", func() {
+				Expect(collect(db.TaskQuery{Page: db.Page{Sort: "due_date", Desc: true, Limit: 2}})).To(Equal(
+					[]string{"bravo", "charlie", "echo", "alpha", "delta"}))
+			})
+
+			It("should default to creation order", func() {
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(len(titles)))
+				for i := 1; i < len(tasks); i++ {
+					Expect(tasks[i].CreatedAt >= tasks[i-1].CreatedAt).To(BeTrue())
+				}
+				Expect(collect(db.TaskQuery{Page: db.Page{Limit: 3}})).To(ConsistOf(titles))
+			})
+
+			It("should page users", func() {
+				Expect(testDB.CreateUser(ctx, &model.User{Name: "Alice", Email: "alice@example.com"})).To(Succeed())
+				users, next, err := testDB.ListUsers(ctx, db.Page{Sort: "name", Limit: 1})
+				Expect(err).To(BeNil())
+				Expect(users).To(HaveLen(1))
+				Expect(users[0].Name).To(Equal("Alice"))
+				users, next, err = testDB.ListUsers(ctx, db.Page{Sort: "name", Limit: 1, Cursor: next})
+				Expect(err).To(BeNil())
+				Expect(users[0].Name).To(Equal("Test User"))
+				Expect(next).To(BeEmpty())
+			})
+
+			It("should reject unknown sort fields", func() {
+				_, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{Page: db.Page{Sort: "description"}})
+				Expect(errors.Is(err, db.ErrInvalidSort)).To(BeTrue())
+			})
+
+			It("should reject a cursor issued for a different order", func() {
+				_, next, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{Page: db.Page{Sort: "title", Limit: 1}})
+				Expect(err).To(BeNil())
+				_, _, err = testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{Page: db.Page{Sort: "status", Limit: 1, Cursor: next}})
+				Expect(errors.Is(err, db.ErrInvalidCursor)).To(BeTrue())
+				_, _, err = testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{Page: db.Page{Cursor: "not a cursor"}})
+				Expect(errors.Is(err, db.ErrInvalidCursor)).To(BeTrue())
+			})
+		})
+
+		Describe("Filters", func() {
+			BeforeEach(func() {
+				tasks := []*model.Task{
+					{Title: "Write report", Description: "Quarterly numbers", DueDate: "2024-01-10T09:00:00Z", Status: "pending"},
+					{Title: "Review PR", Description: "Check the 100% coverage claim", DueDate: "2024-02-10T09:00:00+02:00", Status: "in_progress"},
+					{Title: "Ship release", Description: "", DueDate: "2024-03-10T09:00:00Z", Status: "done"},
+				}
+				for _, t := range tasks {
+					t.UserID = testUser.ID
+					Expect(testDB.CreateTask(ctx, t)).To(Succeed())
+				}
+			})
+
+			titles := func(q db.TaskQuery) []string {
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, q)
+				Expect(err).To(BeNil())
+				var out []string
+				for _, t := range tasks {
+					out = append(out, t.Title)
+				}
+				return out
+			}
+
+			It("should store due dates in UTC", func() {
+				tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{Text: "review"})
+				Expect(err).To(BeNil())
+				Expect(tasks).To(HaveLen(1))
+				Expect(tasks[0].DueDate).To(Equal("2024-02-10T07:00:00Z"))
+			})
+
+			It("should filter by several statuses", func() {
+				Expect(titles(db.TaskQuery{Statuses: []string{"in_progress", "done"}})).To(ConsistOf("Review PR", "Ship release"))
+				Expect(titles(db.TaskQuery{ExcludeStatuses: []string{"done", "pending"}})).To(ConsistOf("Review PR"))
+			})
+
+			It("should filter by due date range", func() {
+				Expect(titles(db.TaskQuery{DueAfter: "2024-01-10T09:00:00Z"})).To(ConsistOf("Review PR", "Ship release"))
+				Expect(titles(db.TaskQuery{DueBefore: "2024-02-10T08:00:00+01:00"})).To(ConsistOf("Write report"))
+				Expect(titles(db.TaskQuery{DueAfter: "2024-01-01T00:00:00Z", DueBefore: "2024-03-01T00:00:00Z"})).To(ConsistOf("Write report", "Review PR"))
+			})
+
+			It("should match text in the title or description", func() {
+				Expect(titles(db.TaskQuery{Text: "QUARTERLY"})).To(ConsistOf("Write report"))
+				Expect(titles(db.TaskQuery{Text: "re"})).To(ConsistOf("Write report", "Review PR", "Ship release"))
+				Expect(titles(db.TaskQuery{Text: "100%"})).To(ConsistOf("Review PR"))
+				Expect(titles(db.TaskQuery{Text: "0%c"})).To(BeEmpty())
+			})
+
+			It("should combine filters", func() {
+				q := db.TaskQuery{Statuses: []string{"pending", "done"}, DueAfter: "2024-01-01T00:00:00Z", Text: "re"}
+				Expect(titles(q)).To(ConsistOf("Write report", "Ship release"))
+			})
+
+			Context("by priority", func() {
+				BeforeEach(func() {
+					for title, priority := range map[string]string{"Fix outage": model.PriorityUrgent, "Tidy wiki": model.PriorityLow, "Plan sprint": model.PriorityHigh} {
+						t := &model.Task{Title: title, DueDate: "2024-04-10T09:00:00Z", Status: "pending", Priority: priority, UserID: testUser.ID}
+						Expect(testDB.CreateTask(ctx, t)).To(Succeed())
+					}
+				})
+
+				It("should default to medium priority", func() {
+					tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{Text: "quarterly"})
+					Expect(err).To(BeNil())
+					Expect(tasks[0].Priority).To(Equal(model.PriorityMedium))
+				})
+
+				It("should filter by several priorities", func() {
+					Expect(titles(db.TaskQuery{Priorities: []string{model.PriorityUrgent, model.PriorityHigh}})).To(ConsistOf("Fix outage", "Plan sprint"))
+					Expect(titles(db.TaskQuery{Priorities: []string{model.PriorityLow}, Statuses: []string{"pending"}})).To(ConsistOf("Tidy wiki"))
+				})
+
+				It("should sort by urgency across pages", func() {
+					q := db.TaskQuery{Priorities: []string{model.PriorityUrgent, model.PriorityHigh, model.PriorityLow}, Page: db.Page{Sort: "priority", Desc: true, Limit: 1}}
+					var seen []string
+					for {
+						tasks, next, err := testDB.ListTasks(ctx, testUser.ID, q)
+						Expect(err).To(BeNil())
+						for _, t := range tasks {
+							seen = append(seen, t.Title)
+						}
+						if next == "" {
+							break
+						}
+						q.Cursor = next
+					}
+					Expect(seen).To(Equal([]string{"Fix outage", "Plan sprint", "Tidy wiki"}))
+				})
+
+				It("should keep the priority set by an update", func() {
+					tasks, _, err := testDB.ListTasks(ctx, testUser.ID, db.TaskQuery{Text: "wiki"})
+					Expect(err).To(BeNil())
+					task := tasks[0]
+					task.Priority = model.PriorityHigh
+					Expect(testDB.UpdateTask(ctx, &task)).To(Succeed())
+					stored, err := testDB.GetTask(ctx, task.ID)
+					Expect(err).To(BeNil())
+					Expect(stored.Priority).To(Equal(model.PriorityHigh))
+				})
+			})
+		})
+
+		Describe("Search", func() {
+			var report, review *model.Task
+
+			BeforeEach(func() {
+				report = &model.Task{Title: "Write report", Description: "Quarterly numbers for the board", DueDate: "2024-01-10T09:00:00Z", Status: "pending", UserID: testUser.ID}
+				review = &model.Task{Title: "Review PR", Description: "Check the report generator changes", DueDate: "2024-02-10T09:00:00Z", Status: "in_progress", UserID: testUser.ID}
+				for _, t := range []*model.Task{report, review} {
+					Expect(testDB.CreateTask(ctx, t)).To(Succeed())
+				}
+				other := &model.User{Name: "Other User", Email: "other@example.com"}
+				Expect(testDB.CreateUser(ctx, other)).To(Succeed())
+				Expect(testDB.CreateTask(ctx, &model.Task{Title: "Other report", DueDate: "2024-01-10T09:00:00Z", Status: "pending", UserID: other.ID})).To(Succeed())
+			})
+
+			ids := func(query string) []string {
+				results, err := testDB.SearchTasks(ctx, testUser.ID, query, 0)
+				Expect(err).To(BeNil())
+				var out []string
+				for _, r := range results {
+					out = append(out, r.ID)
+				}
+				return out
+			}
+
+			It("should rank title matches above description matches", func() {
+				Expect(ids("report")).To(Equal([]string{report.ID, review.ID}))
+			})
+
+			It("should match word prefixes and require every term", func() {
+				Expect(ids("quart")).To(Equal([]string{report.ID}))
+				Expect(ids("rep gen")).To(Equal([]string{review.ID}))
+				Expect(ids("report missing")).To(BeEmpty())
+			})
+
+			It("should highlight matches in snippets", func() {
+				results, err := testDB.SearchTasks(ctx, testUser.ID, "quarterly", 0)
+				Expect(err).To(BeNil())
+				Expect(results).To(HaveLen(1))
+				Expect(results[0].Title).To(Equal("Write report"))
+				Expect(results[0].DescriptionSnippet).To(ContainSubstring("<mark>Quarterly</mark>"))
+				Expect(results[0].Score).To(BeNumerically(">", 0))
+			})
+
+			It("should escape HTML in snippets", func() {
+				task := &model.Task{Title: "Fix <script>alert(1)</script> budget", Description: "Costs <img src=x onerror=alert(1)> & budget cuts", Status: "pending", UserID: testUser.ID}
+				Expect(testDB.CreateTask(ctx, task)).To(Succeed())
+				results, err := testDB.SearchTasks(ctx, testUser.ID, "budget", 0)
+				Expect(err).To(BeNil())
+				Expect(results).To(HaveLen(1))
+				Expect(results[0].TitleSnippet).To(ContainSubstring("&lt;script&gt;"))
+				Expect(results[0].TitleSnippet).To(ContainSubstring("<mark>budget</mark>"))
+				Expect(results[0].TitleSnippet).NotTo(ContainSubstring("<script>"))
+				Expect(results[0].DescriptionSnippet).To(ContainSubstring("&lt;img"))
+				Expect(results[0].DescriptionSnippet).To(ContainSubstring("&amp;"))
+				Expect(results[0].DescriptionSnippet).NotTo(ContainSubstring("<img"))
+			})
+
+			It("should respect the limit", func() {
+				results, err := testDB.SearchTasks(ctx, testUser.ID, "report", 1)
+				Expect(err).To(BeNil())
+				Expect(results).To(HaveLen(1))
+			})
+
+			It("should follow updates and deletes", func() {
+				Expect(testDB.UpdateTask(ctx, &model.Task{ID: review.ID, UserID: testUser.ID, Title: "Review budget", Description: "Numbers"})).To(Succeed())
+				Expect(ids("report")).To(Equal([]string{report.ID}))
+				Expect(ids("budget")).To(Equal([]string{review.ID}))
+				Expect(testDB.DeleteTask(ctx, report.ID, testUser.ID)).To(Succeed())
+				Expect(ids("numbers")).To(Equal([]string{review.ID}))
+			})
+		})
+	})
+}
@@ -1,158 +1,347 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"task-manager/internal/model"
 
 	"github.com/google/uuid"
-	_ "github.com/mattn/go-sqlite3"
 )
 
-// SQLiteDB wraps a sql.DB connection for database operations
-type SQLiteDB struct {
-	conn *sql.DB
+// sqlDB implements DB on top of database/sql; the SQLite and Postgres
+// implementations differ only in their dialect and schema
+type sqlDB struct {
+	conn    *sql.DB
+	dialect dialect
+	// tx is set on the copies of sqlDB handed to WithTx callbacks
+	tx *sql.Tx
 }
 
-// NewSQLiteDB initializes a new SQLiteDB instance
-func NewSQLiteDB(dataSourceName string) (DB, error) {
-	conn, err := sql.Open("sqlite3", dataSourceName)
-	if err != nil {
-		return nil, err
+// querier is the subset of *sql.DB and *sql.Tx used to run statements
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Close closes the database connection; it is a no-op inside a transaction
+func (s *sqlDB) Close() error {
+	if s.conn != nil && s.tx == nil {
+		return s.conn.Close()
 	}
-	// Create tables if they don't exist
-	tables := []struct {
-		name       string
-		createStmt string
-	}{
-		{
-			name: "users",
-			createStmt: `
-				CREATE TABLE IF NOT EXISTS users (
-					id TEXT PRIMARY KEY,
-					name TEXT NOT NULL,
-					email TEXT NOT NULL UNIQUE
-				)
-			`,
-		},
-		{
-			name: "tasks",
-			createStmt: `
-				CREATE TABLE IF NOT EXISTS tasks (
-					id TEXT PRIMARY KEY,
-					title TEXT NOT NULL,
-					description TEXT,
-					due_date TEXT,
-					status TEXT NOT NULL DEFAULT 'pending',
-					user_id TEXT NOT NULL,
-					FOREIGN KEY(user_id) REFERENCES users(id)
-				)
-			`,
-		},
+	return nil
+}
+
+func (s *sqlDB) q() querier {
+	if s.tx != nil {
+		return s.tx
 	}
+	return s.conn
+}
 
-	for _, table := range tables {
-		_, err = conn.Exec(table.createStmt)
-		if err != nil {
-			return nil, fmt.Errorf("error creating table %s: %w", table.name, err)
+func (s *sqlDB) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.q().ExecContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *sqlDB) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.q().QueryContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *sqlDB) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.q().QueryRowContext(ctx, s.dialect.rebind(query), args...)
+}
+
+// WithTx runs fn inside a database transaction. Calls nested in an existing
+// transaction join it rather than starting a new one.
+func (s *sqlDB) WithTx(ctx context.Context, fn func(tx DB) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
 		}
+	}()
+	if err := fn(&sqlDB{conn: s.conn, dialect: s.dialect, tx: tx}); err != nil {
+		tx.Rollback()
+		return err
 	}
+	return tx.Commit()
+}
 
-	return &SQLiteDB{conn: conn}, nil
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
 }
 
-// Close closes the SQLiteDB connection
-func (s *SQLiteDB) Close() error {
-	if s.conn != nil {
-		return s.conn.Close()
+// pageClause appends the keyset condition, ordering and limit for p to the
+// WHERE conditions of a list query. One extra row is fetched so the caller
+// can tell whether another page follows.
+func pageClause(p Page, after *cursor, where []string, args []any) (string, []any) {
+	if after != nil {
+		op := ">"
+		if p.Desc {
+			op = "<"
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id > ?))", p.Sort, op))
+		args = append(args, after.Value, after.Value, after.ID)
 	}
-	return nil
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+	direction := "ASC"
+	if p.Desc {
+		direction = "DESC"
+	}
+	clause += fmt.Sprintf(" ORDER BY %s %s, id ASC LIMIT ?", p.Sort, direction)
+	return clause, append(args, p.Limit+1)
 }
 
 // Task methods
 
-func (s *SQLiteDB) CreateTask(task *model.Task) error {
+const taskColumns = "id, title, description, due_date, status, priority, parent_id, recurrence, series_id, occurrence, reminders, next_reminder_at, overdue_at, user_id, created_at, updated_at, version"
+
+// taskFields returns the scan destinations for taskColumns
+func taskFields(t *model.Task) []any {
+	return []any{&t.ID, &t.Title, &t.Description, &t.DueDate, &t.Status, (*priorityColumn)(&t.Priority), &t.ParentID, &t.Recurrence, &t.SeriesID, &t.Occurrence, (*remindersColumn)(&t.Reminders), &t.NextReminderAt, &t.OverdueAt, &t.UserID, &t.CreatedAt, &t.UpdatedAt, &t.Version}
+}
+
+func scanTask(row scanner) (model.Task, error) {
+	var t model.Task
+	err := row.Scan(taskFields(&t)...)
+	return t, err
+}
+
+func (s *sqlDB) CreateTask(ctx context.Context, task *model.Task) error {
 	task.ID = uuid.New().String()
-	_, err := s.conn.Exec(
-		"INSERT INTO tasks (id, title, description, due_date, status, user_id) VALUES (?, ?, ?, ?, ?, ?)",
-		task.ID, task.Title, task.Description, task.DueDate, task.Status, task.UserID,
-	)
-	return err
+	task.CreatedAt = now()
+	task.UpdatedAt = task.CreatedAt
+	task.Version = 1
+	task.DueDate = normalizeDueDate(task.DueDate)
+	task.Priority = normalizePriority(task.Priority)
+	task.Tags = normalizeTags(task.Tags)
+	task.Reminders = normalizeReminders(task.Reminders)
+	return s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		_, err := t.exec(ctx,
+			"INSERT INTO tasks ("+taskColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			task.ID, task.Title, task.Description, task.DueDate, task.Status, priorityRank(task.Priority), task.ParentID, task.Recurrence, task.SeriesID, task.Occurrence,
+			formatReminders(task.Reminders), task.NextReminderAt, task.OverdueAt, task.UserID, task.CreatedAt, task.UpdatedAt, task.Version,
+		)
+		if t.dialect.isForeignKeyViolation(err) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return t.setTaskTags(ctx, task)
+	})
 }
 
-func (s *SQLiteDB) GetTask(id string) (*model.Task, error) {
-	row := s.conn.QueryRow("SELECT id, title, description, due_date, status, user_id FROM tasks WHERE id = ?", id)
-	var task model.Task
-	err := row.Scan(&task.ID, &task.Title, &task.Description, &task.DueDate, &task.Status, &task.UserID)
+func (s *sqlDB) GetTask(ctx context.Context, id string) (*model.Task, error) {
+	task, err := scanTask(s.queryRow(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = ?", id))
 	if err == sql.ErrNoRows {
 		return nil, ErrTaskNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	if err := s.loadTags(ctx, &task); err != nil {
+		return nil, err
+	}
 	return &task, nil
 }
 
-func (s *SQLiteDB) ListTasks(userID string, status string) ([]model.Task, error) {
-	var rows *sql.Rows
-	var err error
-	if status == "" {
-		rows, err = s.conn.Query("SELECT id, title, description, due_date, status, user_id FROM tasks WHERE user_id = ?", userID)
-	} else {
-		rows, err = s.conn.Query("SELECT id, title, description, due_date, status, user_id FROM tasks WHERE user_id = ? AND status = ?", userID, status)
+func (s *sqlDB) ListTasks(ctx context.Context, userID string, q TaskQuery) ([]model.Task, string, error) {
+	page, after, err := q.Page.normalize(TaskSortFields)
+	if err != nil {
+		return nil, "", err
 	}
+	where, args := q.where(s.dialect, userID)
+	clause, args := pageClause(page, after, where, args)
+	rows, err := s.query(ctx, "SELECT "+taskColumns+" FROM tasks"+clause, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var tasks []model.Task
+	tasks := []model.Task{}
 	for rows.Next() {
-		var t model.Task
-		err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.DueDate, &t.Status, &t.UserID)
+		t, err := scanTask(rows)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		tasks = append(tasks, t)
 	}
-	return tasks, nil
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	tasks, next := nextPage(page, tasks, taskSortKey)
+	if err := s.loadTags(ctx, pointers(tasks)...); err != nil {
+		return nil, "", err
+	}
+	return tasks, next, nil
 }
 
-func (s *SQLiteDB) UpdateTask(task *model.Task) error {
-	query := "UPDATE tasks SET "
-	updates := []string{}
-	args := []any{}
-	if task.Title != "" {
-		updates = append(updates, "title = ?")
-		args = append(args, task.Title)
+func (s *sqlDB) SearchTasks(ctx context.Context, userID string, query string, limit int) ([]model.TaskSearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return []model.TaskSearchResult{}, nil
+	}
+	results, err := s.dialect.searchTasks(ctx, s, userID, terms, searchLimit(limit))
+	if err != nil {
+		return nil, err
 	}
-	if task.Description != "" {
-		updates = append(updates, "description = ?")
-		args = append(args, task.Description)
+	tasks := make([]*model.Task, len(results))
+	for i := range results {
+		tasks[i] = &results[i].Task
 	}
-	if task.DueDate != "" {
-		updates = append(updates, "due_date = ?")
-		args = append(args, task.DueDate)
+	if err := s.loadTags(ctx, tasks...); err != nil {
+		return nil, err
 	}
-	if task.Status != "" {
-		updates = append(updates, "status = ?")
-		args = append(args, task.Status)
+	return results, nil
+}
+
+func (s *sqlDB) UpdateTask(ctx context.Context, task *model.Task) error {
+	task.DueDate = normalizeDueDate(task.DueDate)
+	task.Priority = normalizePriority(task.Priority)
+	return s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		// Version 0 never matches, so unconditional updates only test the owner
+		updated, err := scanTask(t.queryRow(ctx,
+			"UPDATE tasks SET title = ?, description = ?, due_date = ?, status = ?, priority = ?, parent_id = ?, recurrence = ?,"+
+				" series_id = ?, occurrence = ?, reminders = ?, next_reminder_at = ?, overdue_at = ?, updated_at = ?, version = version + 1"+
+				" WHERE id = ? AND user_id = ? AND (? = 0 OR version = ?) RETURNING "+taskColumns,
+			task.Title, task.Description, task.DueDate, task.Status, priorityRank(task.Priority), task.ParentID, task.Recurrence, task.SeriesID, task.Occurrence,
+			formatReminders(task.Reminders), task.NextReminderAt, task.OverdueAt, now(), task.ID, task.UserID, task.Version, task.Version,
+		))
+		if err == sql.ErrNoRows && task.Version != 0 {
+			var exists int
+			err = t.queryRow(ctx, "SELECT 1 FROM tasks WHERE id = ? AND user_id = ?", task.ID, task.UserID).Scan(&exists)
+			if err == nil {
+				return ErrVersionConflict
+			}
+		}
+		if err == sql.ErrNoRows {
+			return ErrTaskNotFound
+		}
+		if err != nil {
+			return err
+		}
+		updated.Tags = normalizeTags(task.Tags)
+		if err := t.setTaskTags(ctx, &updated); err != nil {
+			return err
+		}
+		*task = updated
+		return nil
+	})
+}
+
+func (s *sqlDB) DeleteTask(ctx context.Context, id string, userID string) error {
+	return s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		if _, err := t.exec(ctx, "DELETE FROM task_tags WHERE task_id IN (SELECT id FROM tasks WHERE id = ? AND user_id = ?)", id, userID); err != nil {
+			return err
+		}
+		// Subtasks outlive their parent as top-level tasks
+		_, err := t.exec(ctx,
+			"UPDATE tasks SET parent_id = '', updated_at = ?, version = version + 1 WHERE parent_id = ? AND user_id = ?",
+			now(), id, userID,
+		)
+		if err != nil {
+			return err
+		}
+		// Tasks it blocked may no longer be blocked
+		_, err = t.exec(ctx,
+			"UPDATE tasks SET updated_at = ?, version = version + 1 WHERE id IN (SELECT task_id FROM task_dependencies WHERE blocker_id = ?) AND user_id = ?",
+			now(), id, userID,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = t.exec(ctx,
+			"DELETE FROM task_dependencies WHERE (task_id = ? OR blocker_id = ?) AND ? IN (SELECT user_id FROM tasks WHERE id = ?)",
+			id, id, userID, id,
+		)
+		if err != nil {
+			return err
+		}
+		res, err := t.exec(ctx, "DELETE FROM tasks WHERE id = ? AND user_id = ?", id, userID)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrTaskNotFound
+		}
+		return nil
+	})
+}
+
+func (s *sqlDB) CountSubtasks(ctx context.Context, parentIDs []string, doneStatuses []string) (map[string]model.Progress, error) {
+	counts := make(map[string]model.Progress, len(parentIDs))
+	if len(parentIDs) == 0 {
+		return counts, nil
 	}
-	if len(updates) == 0 {
-		return fmt.Errorf("no fields to update")
+	done := "0"
+	var args []any
+	if len(doneStatuses) > 0 {
+		done = "SUM(CASE WHEN status IN (" + placeholders(len(doneStatuses)) + ") THEN 1 ELSE 0 END)"
+		for _, status := range doneStatuses {
+			args = append(args, status)
+		}
 	}
-	query += updates[0]
-	for _, update := range updates[1:] {
-		query += ", " + update
+	for _, id := range parentIDs {
+		args = append(args, id)
 	}
-	query += " WHERE id = ? AND user_id = ?"
-	fmt.Println("Executing query:", query)
-	args = append(args, task.ID, task.UserID)
-	res, err := s.conn.Exec(
-		query,
+	rows, err := s.query(ctx,
+		"SELECT parent_id, COUNT(*), "+done+" FROM tasks WHERE parent_id IN ("+placeholders(len(parentIDs))+") GROUP BY parent_id",
 		args...,
 	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var parentID string
+		var p model.Progress
+		if err := rows.Scan(&parentID, &p.Total, &p.Done); err != nil {
+			return nil, err
+		}
+		counts[parentID] = newProgress(p.Total, p.Done)
+	}
+	return counts, rows.Err()
+}
+
+// Scheduler methods
+
+func (s *sqlDB) ListDueReminders(ctx context.Context, now time.Time, doneStatuses []string, limit int) ([]model.Task, error) {
+	return s.listScheduled(ctx, "next_reminder_at != '' AND next_reminder_at <= ?", "next_reminder_at", []time.Time{now}, doneStatuses, limit)
+}
+
+func (s *sqlDB) ListNewlyOverdue(ctx context.Context, since, now time.Time, doneStatuses []string, limit int) ([]model.Task, error) {
+	return s.listScheduled(ctx, "overdue_at = '' AND due_date != '' AND due_date >= ? AND due_date < ?", "due_date", []time.Time{since, now}, doneStatuses, limit)
+}
+
+func (s *sqlDB) SetTaskSchedule(ctx context.Context, task *model.Task) error {
+	res, err := s.exec(ctx,
+		"UPDATE tasks SET next_reminder_at = ?, overdue_at = ? WHERE id = ? AND version = ?",
+		task.NextReminderAt, task.OverdueAt, task.ID, task.Version,
+	)
 	if err != nil {
 		return err
 	}
@@ -160,42 +349,389 @@ func (s *SQLiteDB) UpdateTask(task *model.Task) error {
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
+	if rowsAffected > 0 {
+		return nil
+	}
+	var exists int
+	err = s.queryRow(ctx, "SELECT 1 FROM tasks WHERE id = ?", task.ID).Scan(&exists)
+	if err == sql.ErrNoRows {
 		return ErrTaskNotFound
 	}
-	return nil
+	if err != nil {
+		return err
+	}
+	return ErrVersionConflict
 }
 
-func (s *SQLiteDB) DeleteTask(id string, userID string) error {
-	res, err := s.conn.Exec("DELETE FROM tasks WHERE id = ? AND user_id = ?", id, userID)
+func (s *sqlDB) SchedulerStart(ctx context.Context, start time.Time) (time.Time, error) {
+	_, err := s.exec(ctx,
+		"INSERT INTO scheduler_state (name, value) VALUES ('started_at', ?) ON CONFLICT (name) DO NOTHING",
+		start.UTC().Format(dueDateLayout),
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var value string
+	if err := s.queryRow(ctx, "SELECT value FROM scheduler_state WHERE name = 'started_at'").Scan(&value); err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(dueDateLayout, value)
+}
+
+// listScheduled returns up to limit tasks of every user that are not in one
+// of doneStatuses and meet cond, which compares columns with times
+func (s *sqlDB) listScheduled(ctx context.Context, cond, orderBy string, times []time.Time, doneStatuses []string, limit int) ([]model.Task, error) {
+	where := []string{cond}
+	var args []any
+	for _, t := range times {
+		args = append(args, t.UTC().Format(dueDateLayout))
+	}
+	if len(doneStatuses) > 0 {
+		where = append(where, "status NOT IN ("+placeholders(len(doneStatuses))+")")
+		for _, status := range doneStatuses {
+			args = append(args, status)
+		}
+	}
+	rows, err := s.query(ctx,
+		"SELECT "+taskColumns+" FROM tasks WHERE "+strings.Join(where, " AND ")+" ORDER BY "+orderBy+", id LIMIT ?",
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []model.Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.loadTags(ctx, pointers(tasks)...); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Dependency methods
+
+const dependencyColumns = "task_id, blocker_id, created_at"
+
+func (s *sqlDB) AddDependency(ctx context.Context, dep *model.Dependency) error {
+	dep.CreatedAt = now()
+	return s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		_, err := t.exec(ctx,
+			"INSERT INTO task_dependencies ("+dependencyColumns+") VALUES (?, ?, ?)",
+			dep.TaskID, dep.BlockerID, dep.CreatedAt,
+		)
+		switch {
+		case t.dialect.isUniqueViolation(err):
+			return ErrDependencyExists
+		case t.dialect.isForeignKeyViolation(err):
+			return ErrTaskNotFound
+		case err != nil:
+			return err
+		}
+		return t.touchTask(ctx, dep.TaskID)
+	})
+}
+
+func (s *sqlDB) DeleteDependency(ctx context.Context, taskID string, blockerID string) error {
+	return s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		res, err := t.exec(ctx, "DELETE FROM task_dependencies WHERE task_id = ? AND blocker_id = ?", taskID, blockerID)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrDependencyNotFound
+		}
+		return t.touchTask(ctx, taskID)
+	})
+}
+
+func (s *sqlDB) ListDependencies(ctx context.Context, taskID string) ([]model.Dependency, error) {
+	rows, err := s.query(ctx,
+		"SELECT "+dependencyColumns+" FROM task_dependencies WHERE task_id = ? OR blocker_id = ? ORDER BY created_at, task_id, blocker_id",
+		taskID, taskID,
+	)
 	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deps := []model.Dependency{}
+	for rows.Next() {
+		var d model.Dependency
+		if err := rows.Scan(&d.TaskID, &d.BlockerID, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deps = append(deps, d)
+	}
+	return deps, rows.Err()
+}
+
+func (s *sqlDB) CountOpenBlockers(ctx context.Context, taskIDs []string, doneStatuses []string) (map[string]int, error) {
+	counts := make(map[string]int, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return counts, nil
+	}
+	var args []any
+	for _, id := range taskIDs {
+		args = append(args, id)
+	}
+	open := ""
+	if len(doneStatuses) > 0 {
+		open = " AND b.status NOT IN (" + placeholders(len(doneStatuses)) + ")"
+		for _, status := range doneStatuses {
+			args = append(args, status)
+		}
+	}
+	rows, err := s.query(ctx,
+		"SELECT d.task_id, COUNT(*) FROM task_dependencies d JOIN tasks b ON b.id = d.blocker_id"+
+			" WHERE d.task_id IN ("+placeholders(len(taskIDs))+")"+open+" GROUP BY d.task_id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID string
+		var n int
+		if err := rows.Scan(&taskID, &n); err != nil {
+			return nil, err
+		}
+		counts[taskID] = n
+	}
+	return counts, rows.Err()
+}
+
+// touchTask records a change to a task whose computed fields changed
+func (s *sqlDB) touchTask(ctx context.Context, id string) error {
+	_, err := s.exec(ctx, "UPDATE tasks SET updated_at = ?, version = version + 1 WHERE id = ?", now(), id)
+	return err
+}
+
+// setTaskTags attaches the tags named in task.Tags to the task in place of
+// its current ones, creating the tags its owner does not have yet
+func (s *sqlDB) setTaskTags(ctx context.Context, task *model.Task) error {
+	if _, err := s.exec(ctx, "DELETE FROM task_tags WHERE task_id = ?", task.ID); err != nil {
 		return err
 	}
-	rowsAffected, err := res.RowsAffected()
+	if len(task.Tags) == 0 {
+		return nil
+	}
+	args := []any{task.ID, task.UserID}
+	for _, name := range task.Tags {
+		_, err := s.exec(ctx,
+			"INSERT INTO tags ("+tagColumns+") VALUES (?, ?, ?, ?) ON CONFLICT (user_id, name) DO NOTHING",
+			uuid.New().String(), task.UserID, name, now(),
+		)
+		if err != nil {
+			return err
+		}
+		args = append(args, name)
+	}
+	_, err := s.exec(ctx,
+		"INSERT INTO task_tags (task_id, tag_id) SELECT ?, id FROM tags WHERE user_id = ? AND name IN ("+placeholders(len(task.Tags))+")",
+		args...,
+	)
+	return err
+}
+
+// loadTags fills in the tags of tasks with one query
+func (s *sqlDB) loadTags(ctx context.Context, tasks ...*model.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	byID := make(map[string]*model.Task, len(tasks))
+	args := make([]any, len(tasks))
+	for i, t := range tasks {
+		t.Tags = []string{}
+		byID[t.ID] = t
+		args[i] = t.ID
+	}
+	rows, err := s.query(ctx,
+		"SELECT tt.task_id, g.name FROM task_tags tt JOIN tags g ON g.id = tt.tag_id WHERE tt.task_id IN ("+placeholders(len(args))+")",
+		args...,
+	)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return ErrTaskNotFound
+	defer rows.Close()
+	for rows.Next() {
+		var taskID, name string
+		if err := rows.Scan(&taskID, &name); err != nil {
+			return err
+		}
+		byID[taskID].Tags = append(byID[taskID].Tags, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// Sort in Go so the order does not depend on the database collation
+	for _, t := range tasks {
+		slices.Sort(t.Tags)
 	}
 	return nil
 }
 
+// pointers returns a pointer to each element of items
+func pointers[T any](items []T) []*T {
+	ptrs := make([]*T, len(items))
+	for i := range items {
+		ptrs[i] = &items[i]
+	}
+	return ptrs
+}
+
+// Tag methods
+
+const tagColumns = "id, user_id, name, created_at"
+
+func scanTag(row scanner) (model.Tag, error) {
+	var t model.Tag
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt)
+	return t, err
+}
+
+// sortTags orders tags by name, like the tag names of a task
+func sortTags(tags []model.Tag) {
+	slices.SortFunc(tags, func(a, b model.Tag) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+func (s *sqlDB) CreateTag(ctx context.Context, tag *model.Tag) error {
+	tag.ID = uuid.New().String()
+	tag.CreatedAt = now()
+	_, err := s.exec(ctx,
+		"INSERT INTO tags ("+tagColumns+") VALUES (?, ?, ?, ?)",
+		tag.ID, tag.UserID, tag.Name, tag.CreatedAt,
+	)
+	switch {
+	case s.dialect.isUniqueViolation(err):
+		return ErrTagExists
+	case s.dialect.isForeignKeyViolation(err):
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (s *sqlDB) ListTags(ctx context.Context, userID string) ([]model.Tag, error) {
+	rows, err := s.query(ctx, "SELECT "+tagColumns+" FROM tags WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []model.Tag{}
+	for rows.Next() {
+		t, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+func (s *sqlDB) RenameTag(ctx context.Context, tag *model.Tag) error {
+	return s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		renamed, err := scanTag(t.queryRow(ctx,
+			"UPDATE tags SET name = ? WHERE id = ? AND user_id = ? RETURNING "+tagColumns,
+			tag.Name, tag.ID, tag.UserID,
+		))
+		switch {
+		case err == sql.ErrNoRows:
+			return ErrTagNotFound
+		case t.dialect.isUniqueViolation(err):
+			return ErrTagExists
+		case err != nil:
+			return err
+		}
+		*tag = renamed
+		return t.touchTagged(ctx, tag.ID)
+	})
+}
+
+func (s *sqlDB) DeleteTag(ctx context.Context, id string, userID string) error {
+	return s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		var exists int
+		err := t.queryRow(ctx, "SELECT 1 FROM tags WHERE id = ? AND user_id = ?", id, userID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return ErrTagNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := t.touchTagged(ctx, id); err != nil {
+			return err
+		}
+		if _, err := t.exec(ctx, "DELETE FROM task_tags WHERE tag_id = ?", id); err != nil {
+			return err
+		}
+		_, err = t.exec(ctx, "DELETE FROM tags WHERE id = ?", id)
+		return err
+	})
+}
+
+// touchTagged records a change to every task carrying the tag, so that
+// clients syncing by updated_at or holding an ETag see the new tag names
+func (s *sqlDB) touchTagged(ctx context.Context, tagID string) error {
+	_, err := s.exec(ctx,
+		"UPDATE tasks SET updated_at = ?, version = version + 1 WHERE id IN (SELECT task_id FROM task_tags WHERE tag_id = ?)",
+		now(), tagID,
+	)
+	return err
+}
+
 // User methods
 
-func (s *SQLiteDB) CreateUser(user *model.User) error {
+const userColumns = "id, name, email, role, password_hash, created_at, updated_at"
+
+func scanUser(row scanner) (model.User, error) {
+	var u model.User
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Role, &u.PasswordHash, &u.CreatedAt, &u.UpdatedAt)
+	return u, err
+}
+
+func (s *sqlDB) CreateUser(ctx context.Context, user *model.User) error {
 	user.ID = uuid.New().String()
-	_, err := s.conn.Exec(
-		"INSERT INTO users (id, name, email) VALUES (?, ?, ?)",
-		user.ID, user.Name, user.Email,
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+	if user.Role == "" {
+		user.Role = model.RoleMember
+	}
+	_, err := s.exec(ctx,
+		"INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		user.ID, user.Name, user.Email, user.Role, user.PasswordHash, user.CreatedAt, user.UpdatedAt,
 	)
+	if s.dialect.isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
 	return err
 }
 
-func (s *SQLiteDB) GetUser(id string) (*model.User, error) {
-	row := s.conn.QueryRow("SELECT id, name, email FROM users WHERE id = ?", id)
-	var user model.User
-	err := row.Scan(&user.ID, &user.Name, &user.Email)
+func (s *sqlDB) GetUser(ctx context.Context, id string) (*model.User, error) {
+	user, err := scanUser(s.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -205,27 +741,177 @@ func (s *SQLiteDB) GetUser(id string) (*model.User, error) {
 	return &user, nil
 }
 
-func (s *SQLiteDB) ListUsers() ([]model.User, error) {
-	rows, err := s.conn.Query("SELECT id, name, email FROM users")
+// GetUserByEmail ignores case and surrounding space, as emails are stored
+// lower-cased but may have been registered before they were
+func (s *sqlDB) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	user, err := scanUser(s.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE LOWER(email) = ?", email))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
+	return &user, nil
+}
+
+func (s *sqlDB) UpdateUserRole(ctx context.Context, id string, role string) error {
+	res, err := s.exec(ctx, "UPDATE users SET role = ?, updated_at = ? WHERE id = ?", role, now(), id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *sqlDB) CountUsersWithRole(ctx context.Context, role string) (int, error) {
+	var count int
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM users WHERE role = ?", role).Scan(&count)
+	return count, err
+}
+
+func (s *sqlDB) ListUsers(ctx context.Context, p Page) ([]model.User, string, error) {
+	page, after, err := p.normalize(UserSortFields)
+	if err != nil {
+		return nil, "", err
+	}
+	clause, args := pageClause(page, after, nil, nil)
+	rows, err := s.query(ctx, "SELECT "+userColumns+" FROM users"+clause, args...)
+	if err != nil {
+		return nil, "", err
+	}
 	defer rows.Close()
 
-	var users []model.User
+	users := []model.User{}
 	for rows.Next() {
-		var u model.User
-		err := rows.Scan(&u.ID, &u.Name, &u.Email)
+		u, err := scanUser(rows)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		users = append(users, u)
 	}
-	return users, nil
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	users, next := nextPage(page, users, userSortKey)
+	return users, next, nil
+}
+
+func (s *sqlDB) DeleteUser(ctx context.Context, id string, cascade bool) error {
+	return s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		var taskCount int
+		err := t.queryRow(ctx, "SELECT COUNT(*) FROM tasks WHERE user_id = ?", id).Scan(&taskCount)
+		if err != nil {
+			return err
+		}
+		if taskCount > 0 {
+			if !cascade {
+				return &UserHasTasksError{TaskCount: taskCount}
+			}
+			if _, err := t.exec(ctx, "DELETE FROM task_tags WHERE task_id IN (SELECT id FROM tasks WHERE user_id = ?)", id); err != nil {
+				return err
+			}
+			_, err := t.exec(ctx,
+				"DELETE FROM task_dependencies WHERE task_id IN (SELECT id FROM tasks WHERE user_id = ?) OR blocker_id IN (SELECT id FROM tasks WHERE user_id = ?)",
+				id, id,
+			)
+			if err != nil {
+				return err
+			}
+			if _, err := t.exec(ctx, "DELETE FROM tasks WHERE user_id = ?", id); err != nil {
+				return err
+			}
+		}
+		if _, err := t.exec(ctx, "DELETE FROM tags WHERE user_id = ?", id); err != nil {
+			return err
+		}
+		if _, err := t.exec(ctx, "DELETE FROM api_tokens WHERE user_id = ?", id); err != nil {
+			return err
+		}
+		// Pending deliveries stay queued so the user's last events, such as
+		// user.deleted, still go out
+		_, err = t.exec(ctx,
+			"DELETE FROM webhook_deliveries WHERE status != ? AND webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)",
+			model.DeliveryPending, id,
+		)
+		if err != nil {
+			return err
+		}
+		if _, err := t.exec(ctx, "DELETE FROM webhooks WHERE user_id = ?", id); err != nil {
+			return err
+		}
+		res, err := t.exec(ctx, "DELETE FROM users WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		return nil
+	})
+}
+
+// API token methods
+
+const tokenColumns = "id, user_id, name, created_at"
+
+func (s *sqlDB) CreateAPIToken(ctx context.Context, token *model.APIToken, hash string) error {
+	token.ID = uuid.New().String()
+	token.CreatedAt = now()
+	_, err := s.exec(ctx,
+		"INSERT INTO api_tokens ("+tokenColumns+", token_hash) VALUES (?, ?, ?, ?, ?)",
+		token.ID, token.UserID, token.Name, token.CreatedAt, hash,
+	)
+	if s.dialect.isForeignKeyViolation(err) {
+		return ErrUserNotFound
+	}
+	return err
 }
 
-func (s *SQLiteDB) DeleteUser(id string) error {
-	res, err := s.conn.Exec("DELETE FROM users WHERE id = ?", id)
+func (s *sqlDB) GetUserByTokenHash(ctx context.Context, hash string) (*model.User, error) {
+	user, err := scanUser(s.queryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = (SELECT user_id FROM api_tokens WHERE token_hash = ?)", hash,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *sqlDB) ListAPITokens(ctx context.Context, userID string) ([]model.APIToken, error) {
+	rows, err := s.query(ctx, "SELECT "+tokenColumns+" FROM api_tokens WHERE user_id = ? ORDER BY created_at, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []model.APIToken{}
+	for rows.Next() {
+		var t model.APIToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlDB) DeleteAPIToken(ctx context.Context, id string, userID string) error {
+	res, err := s.exec(ctx, "DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
 	if err != nil {
 		return err
 	}
@@ -234,7 +920,179 @@ func (s *SQLiteDB) DeleteUser(id string) error {
 		return err
 	}
 	if rowsAffected == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+func (s *sqlDB) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	var revoked bool
+	err := s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		if _, err := t.exec(ctx, "DELETE FROM revoked_tokens WHERE expires_at < ?", now()); err != nil {
+			return err
+		}
+		res, err := t.exec(ctx,
+			"INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT (jti) DO NOTHING",
+			jti, expiresAt.UTC().Format(timestampLayout),
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		revoked = rowsAffected > 0
+		return err
+	})
+	return revoked, err
+}
+
+func (s *sqlDB) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?", jti).Scan(&count)
+	return count > 0, err
+}
+
+// Webhook methods
+
+const webhookColumns = "id, user_id, url, events, secret, created_at"
+
+func scanWebhook(row scanner) (model.Webhook, error) {
+	var h model.Webhook
+	var events string
+	err := row.Scan(&h.ID, &h.UserID, &h.URL, &events, &h.Secret, &h.CreatedAt)
+	h.Events = strings.Split(events, ",")
+	return h, err
+}
+
+func (s *sqlDB) CreateWebhook(ctx context.Context, hook *model.Webhook) error {
+	hook.ID = uuid.New().String()
+	hook.CreatedAt = now()
+	_, err := s.exec(ctx,
+		"INSERT INTO webhooks ("+webhookColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		hook.ID, hook.UserID, hook.URL, strings.Join(hook.Events, ","), hook.Secret, hook.CreatedAt,
+	)
+	if s.dialect.isForeignKeyViolation(err) {
 		return ErrUserNotFound
 	}
 	return err
 }
+
+func (s *sqlDB) GetWebhook(ctx context.Context, id string, userID string) (*model.Webhook, error) {
+	hook, err := scanWebhook(s.queryRow(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = ? AND user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (s *sqlDB) ListWebhooks(ctx context.Context, userID string) ([]model.Webhook, error) {
+	rows, err := s.query(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE user_id = ? ORDER BY created_at, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []model.Webhook{}
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
+
+func (s *sqlDB) DeleteWebhook(ctx context.Context, id string, userID string) error {
+	return s.WithTx(ctx, func(tx DB) error {
+		t := tx.(*sqlDB)
+		res, err := t.exec(ctx, "DELETE FROM webhooks WHERE id = ? AND user_id = ?", id, userID)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+		_, err = t.exec(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id = ?", id)
+		return err
+	})
+}
+
+const deliveryColumns = "id, webhook_id, event_id, event, url, payload, signature, status, attempts, next_attempt_at, response_status, error, created_at, updated_at"
+
+func scanDelivery(row scanner) (model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var payload string
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.URL, &payload, &d.Signature, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.ResponseStatus, &d.Error, &d.CreatedAt, &d.UpdatedAt)
+	d.Payload = []byte(payload)
+	return d, err
+}
+
+func (s *sqlDB) CreateDelivery(ctx context.Context, d *model.WebhookDelivery) error {
+	d.ID = uuid.New().String()
+	d.CreatedAt = now()
+	d.UpdatedAt = d.CreatedAt
+	_, err := s.exec(ctx,
+		"INSERT INTO webhook_deliveries ("+deliveryColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		d.ID, d.WebhookID, d.EventID, d.Event, d.URL, string(d.Payload), d.Signature, d.Status, d.Attempts,
+		d.NextAttemptAt, d.ResponseStatus, d.Error, d.CreatedAt, d.UpdatedAt,
+	)
+	return err
+}
+
+func (s *sqlDB) ListDeliveries(ctx context.Context, webhookID string, p Page) ([]model.WebhookDelivery, string, error) {
+	page, after, err := p.normalize(DeliverySortFields)
+	if err != nil {
+		return nil, "", err
+	}
+	clause, args := pageClause(page, after, []string{"webhook_id = ?"}, []any{webhookID})
+	deliveries, err := s.listDeliveries(ctx, clause, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	deliveries, next := nextPage(page, deliveries, deliverySortKey)
+	return deliveries, next, nil
+}
+
+func (s *sqlDB) ListPendingDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	return s.listDeliveries(ctx,
+		" WHERE status = ? AND next_attempt_at <= ? ORDER BY created_at, id LIMIT ?",
+		model.DeliveryPending, now.UTC().Format(dueDateLayout), limit,
+	)
+}
+
+// listDeliveries returns the deliveries selected by clause
+func (s *sqlDB) listDeliveries(ctx context.Context, clause string, args ...any) ([]model.WebhookDelivery, error) {
+	rows, err := s.query(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries"+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *sqlDB) UpdateDelivery(ctx context.Context, d *model.WebhookDelivery) error {
+	d.UpdatedAt = now()
+	_, err := s.exec(ctx,
+		"UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, response_status = ?, error = ?, updated_at = ? WHERE id = ?",
+		d.Status, d.Attempts, d.NextAttemptAt, d.ResponseStatus, d.Error, d.UpdatedAt, d.ID,
+	)
+	return err
+}
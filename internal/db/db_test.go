@@ -1,9 +1,19 @@
 package db_test
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
 	"task-manager/internal/db"
 	"task-manager/internal/model"
 	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -14,140 +24,294 @@ func TestDB(t *testing.T) {
 	RunSpecs(t, "API Suite")
 }
 
-var _ = Describe("DB CRUD Operations", func() {
-	var testDB db.DB
-	var testUser *model.User
+var _ = describeConformance("SQLiteDB", func() db.DB {
+	testDB, err := db.NewSQLiteDB(":memory:")
+	Expect(err).To(BeNil())
+	return testDB
+})
+
+var _ = describeConformance("MemoryDB", func() db.DB {
+	return db.NewMemoryDB()
+})
+
+// The Postgres suite runs against the server at TEST_POSTGRES_DSN, e.g.
+// postgres://postgres@localhost/tasks_test?sslmode=disable, and otherwise
+// against an embedded one started on first use, whose binaries are
+// downloaded once into the Go build cache. SKIP_POSTGRES_TESTS=1 skips it
+// on machines that can do neither.
+var _ = describeConformance("PostgresDB", func() db.DB {
+	dsn := postgresDSN()
+	testDB, err := db.NewPostgresDB(dsn)
+	Expect(err).To(BeNil())
+	conn, err := sql.Open("postgres", dsn)
+	Expect(err).To(BeNil())
+	defer conn.Close()
+	_, err = conn.Exec(`TRUNCATE users, tasks, api_tokens, revoked_tokens, tags, task_tags,
+		task_dependencies, webhooks, webhook_deliveries, scheduler_state`)
+	Expect(err).To(BeNil())
+	return testDB
+})
+
+// embedded is the Postgres server started for the suite, if any
+var embedded struct {
+	once   sync.Once
+	server *embeddedpostgres.EmbeddedPostgres
+	dir    string
+	dsn    string
+	err    error
+}
+
+// postgresDSN returns the DSN of the server the Postgres suite runs
+// against, starting the embedded one if needed
+func postgresDSN() string {
+	if os.Getenv("SKIP_POSTGRES_TESTS") != "" {
+		Skip("SKIP_POSTGRES_TESTS set")
+	}
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		return dsn
+	}
+	embedded.once.Do(func() {
+		embedded.dsn, embedded.err = startEmbeddedPostgres()
+	})
+	Expect(embedded.err).To(BeNil(), "starting the embedded Postgres server failed; "+
+		"set TEST_POSTGRES_DSN to use another server, or SKIP_POSTGRES_TESTS=1")
+	return embedded.dsn
+}
+
+func startEmbeddedPostgres() (string, error) {
+	// The server needs a port of its own, so it takes one that is free now
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	embedded.dir, err = os.MkdirTemp("", "tasks-postgres-")
+	if err != nil {
+		return "", err
+	}
+	config := embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V16).
+		Port(uint32(port)).
+		Database("tasks_test").
+		RuntimePath(embedded.dir).
+		CachePath(filepath.Join(cache, "go-build", "embedded-postgres")).
+		StartTimeout(time.Minute).
+		Logger(GinkgoWriter)
+	embedded.server = embeddedpostgres.NewDatabase(config)
+	if err := embedded.server.Start(); err != nil {
+		embedded.server = nil
+		return "", err
+	}
+	return config.GetConnectionURL() + "?sslmode=disable", nil
+}
+
+var _ = AfterSuite(func() {
+	if embedded.server != nil {
+		Expect(embedded.server.Stop()).To(Succeed())
+	}
+	if embedded.dir != "" {
+		os.RemoveAll(embedded.dir)
+	}
+})
+
+var _ = Describe("Migrations", func() {
+	var dsn string
 
 	BeforeEach(func() {
-		var err error
-		testDB, err = db.NewSQLiteDB(":memory:")
+		dsn = filepath.Join(GinkgoT().TempDir(), "tasks.db")
+	})
+
+	It("should apply every migration when opening a new database", func() {
+		testDB, err := db.NewSQLiteDB(dsn)
 		Expect(err).To(BeNil())
+		testDB.Close()
 
-		testUser = &model.User{Name: "Test User", Email: "test@example.com"}
-		err = testDB.CreateUser(testUser)
+		migrator, err := db.OpenSQLiteMigrator(dsn)
+		Expect(err).To(BeNil())
+		defer migrator.Close()
+		statuses, err := migrator.Status()
 		Expect(err).To(BeNil())
+		Expect(statuses).NotTo(BeEmpty())
+		for _, s := range statuses {
+			Expect(s.Applied).To(BeTrue())
+			Expect(s.Modified).To(BeFalse())
+		}
 	})
 
-	AfterEach(func() {
-		if testDB != nil {
-			testDB.Close()
+	It("should revert and reapply migrations", func() {
+		migrator, err := db.OpenSQLiteMigrator(dsn)
+		Expect(err).To(BeNil())
+		defer migrator.Close()
+
+		applied, err := migrator.Up()
+		Expect(err).To(BeNil())
+		Expect(applied).To(BeNumerically(">", 2))
+
+		// Migration 2 deletes orphaned tasks, which cannot be brought back
+		reverted, err := migrator.Down(applied)
+		Expect(errors.Is(err, db.ErrIrreversible)).To(BeTrue())
+		Expect(reverted).To(Equal(applied - 2))
+		statuses, err := migrator.Status()
+		Expect(err).To(BeNil())
+		for _, s := range statuses {
+			Expect(s.Applied).To(Equal(s.Version <= 2))
 		}
+
+		reapplied, err := migrator.Up()
+		Expect(err).To(BeNil())
+		Expect(reapplied).To(Equal(reverted))
 	})
 
-	Describe("User CRUD", func() {
-		It("should create a user", func() {
-			user := &model.User{Name: "Alice", Email: "alice@example.com"}
-			err := testDB.CreateUser(user)
-			Expect(err).To(BeNil())
-			Expect(user.ID).NotTo(BeEmpty())
-		})
+	It("should adopt a database created before migrations existed", func() {
+		conn, err := sql.Open("sqlite3", dsn)
+		Expect(err).To(BeNil())
+		_, err = conn.Exec(`CREATE TABLE users (id TEXT PRIMARY KEY, name TEXT NOT NULL, email TEXT NOT NULL UNIQUE)`)
+		Expect(err).To(BeNil())
+		_, err = conn.Exec(`INSERT INTO users (id, name, email) VALUES ('u1', 'Legacy', 'legacy@example.com')`)
+		Expect(err).To(BeNil())
+		conn.Close()
 
-		It("should get a user", func() {
-			got, err := testDB.GetUser(testUser.ID)
-			Expect(err).To(BeNil())
-			Expect(got.Name).To(Equal("Test User"))
-			Expect(got.Email).To(Equal("test@example.com"))
-		})
+		testDB, err := db.NewSQLiteDB(dsn)
+		Expect(err).To(BeNil())
+		defer testDB.Close()
+		got, err := testDB.GetUser(context.Background(), "u1")
+		Expect(err).To(BeNil())
+		Expect(got.Name).To(Equal("Legacy"))
+	})
 
-		It("should list users", func() {
-			users, err := testDB.ListUsers()
-			Expect(err).To(BeNil())
-			Expect(users).NotTo(BeEmpty())
-		})
+	It("should keep the search index on tasks when VACUUM renumbers rows", func() {
+		ctx := context.Background()
+		testDB, err := db.NewSQLiteDB(dsn)
+		Expect(err).To(BeNil())
+		user := &model.User{Name: "Test User", Email: "test@example.com"}
+		Expect(testDB.CreateUser(ctx, user)).To(Succeed())
+		var tasks []*model.Task
+		for _, title := range []string{"Write report", "Review budget", "Plan offsite"} {
+			task := &model.Task{Title: title, Status: "pending", UserID: user.ID}
+			Expect(testDB.CreateTask(ctx, task)).To(Succeed())
+			tasks = append(tasks, task)
+		}
+		Expect(testDB.DeleteTask(ctx, tasks[0].ID, user.ID)).To(Succeed())
+		testDB.Close()
 
-		It("should delete a user", func() {
-			err := testDB.DeleteUser(testUser.ID)
-			Expect(err).To(BeNil())
-			users, err := testDB.ListUsers()
+		conn, err := sql.Open("sqlite3", dsn)
+		Expect(err).To(BeNil())
+		_, err = conn.Exec("VACUUM")
+		Expect(err).To(BeNil())
+		conn.Close()
+
+		testDB, err = db.NewSQLiteDB(dsn)
+		Expect(err).To(BeNil())
+		defer testDB.Close()
+		for _, task := range tasks[1:] {
+			results, err := testDB.SearchTasks(ctx, user.ID, task.Title, 0)
 			Expect(err).To(BeNil())
-			found := false
-			for _, u := range users {
-				if u.ID == testUser.ID {
-					found = true
-				}
-			}
-			Expect(found).To(BeFalse())
-		})
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].ID).To(Equal(task.ID))
+		}
 	})
 
-	Describe("Task CRUD", func() {
-		var task *model.Task
-
-		BeforeEach(func() {
-			task = &model.Task{
-				Title:       "Test Task",
-				Description: "This is a test task",
-				DueDate:     "2023-12-31T10:00:00Z",
-				Status:      "pending",
-				UserID:      testUser.ID,
-			}
-			err := testDB.CreateTask(task)
-			Expect(err).To(BeNil())
-		})
+	It("should rebuild a search index that went stale", func() {
+		ctx := context.Background()
+		testDB, err := db.NewSQLiteDB(dsn)
+		Expect(err).To(BeNil())
+		user := &model.User{Name: "Test User", Email: "test@example.com"}
+		Expect(testDB.CreateUser(ctx, user)).To(Succeed())
+		task := &model.Task{Title: "Write report", Status: "pending", UserID: user.ID}
+		Expect(testDB.CreateTask(ctx, task)).To(Succeed())
+		testDB.Close()
 
-		It("should create a task", func() {
-			Expect(task.ID).NotTo(BeEmpty())
-		})
+		// As a build without FTS5 leaves it
+		conn, err := sql.Open("sqlite3", dsn)
+		Expect(err).To(BeNil())
+		_, err = conn.Exec(`DROP TRIGGER IF EXISTS tasks_fts_insert; DROP TRIGGER IF EXISTS tasks_fts_delete; DROP TRIGGER IF EXISTS tasks_fts_update;
+			UPDATE tasks SET title = 'Plan offsite'`)
+		Expect(err).To(BeNil())
+		conn.Close()
 
-		It("should list tasks", func() {
-			tasks, err := testDB.ListTasks(testUser.ID, "")
-			Expect(err).To(BeNil())
-			Expect(tasks).To(HaveLen(1))
-		})
+		testDB, err = db.NewSQLiteDB(dsn)
+		Expect(err).To(BeNil())
+		defer testDB.Close()
+		results, err := testDB.SearchTasks(ctx, user.ID, "offsite", 0)
+		Expect(err).To(BeNil())
+		Expect(results).To(HaveLen(1))
+		results, err = testDB.SearchTasks(ctx, user.ID, "report", 0)
+		Expect(err).To(BeNil())
+		Expect(results).To(BeEmpty())
+	})
 
-		It("should get a task by ID", func() {
-			got, err := testDB.GetTask(task.ID)
-			Expect(err).To(BeNil())
-			Expect(got.Title).To(Equal("Test Task"))
-			Expect(got.Description).To(Equal("This is a test task"))
-			Expect(got.DueDate).To(Equal("2023-12-31T10:00:00Z"))
-			Expect(got.Status).To(Equal("pending"))
-			Expect(got.UserID).To(Equal(testUser.ID))
-		})
-
-		It("should get task based on status filter", func() {
-			tasks, err := testDB.ListTasks(testUser.ID, "pending")
-			Expect(err).To(BeNil())
-			Expect(tasks).To(HaveLen(1))
-			Expect(tasks[0].Title).To(Equal("Test Task"))
-		})
+	It("should refuse to run when an applied migration was modified", func() {
+		conn, err := sql.Open("sqlite3", dsn)
+		Expect(err).To(BeNil())
+		defer conn.Close()
 
-		It("should update a task", func() {
-			task.Title = "Updated Task"
-			err := testDB.UpdateTask(task)
-			Expect(err).To(BeNil())
+		migrations := []db.Migration{{
+			Version: 1,
+			Name:    "create_notes",
+			Up:      "CREATE TABLE notes (id TEXT PRIMARY KEY)",
+			Down:    "DROP TABLE notes",
+		}}
+		_, err = db.NewMigrator(conn, migrations).Up()
+		Expect(err).To(BeNil())
 
-			updatedTask, err := testDB.GetTask(task.ID)
-			Expect(err).To(BeNil())
-			Expect(updatedTask.Title).To(Equal("Updated Task"))
-		})
+		migrations[0].Up = "CREATE TABLE notes (id TEXT PRIMARY KEY, body TEXT)"
+		_, err = db.NewMigrator(conn, migrations).Up()
+		Expect(errors.Is(err, db.ErrMigrationChecksum)).To(BeTrue())
+	})
+})
 
-		It("should delete a task", func() {
-			err := testDB.DeleteTask(task.ID, testUser.ID)
-			Expect(err).To(BeNil())
+var _ = Describe("SQLite connections", func() {
+	It("should let concurrent transactions wait for each other", func() {
+		ctx := context.Background()
+		testDB, err := db.NewSQLiteDB(filepath.Join(GinkgoT().TempDir(), "tasks.db"))
+		Expect(err).To(BeNil())
+		defer testDB.Close()
+		user := &model.User{Name: "Test User", Email: "test@example.com"}
+		Expect(testDB.CreateUser(ctx, user)).To(Succeed())
+		task := &model.Task{Title: "Count", Status: "pending", UserID: user.ID}
+		Expect(testDB.CreateTask(ctx, task)).To(Succeed())
 
-			tasks, err := testDB.ListTasks(testUser.ID, "")
+		// Each transaction reads the task before writing it, which deadlocks
+		// unless the write lock is taken up front
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- testDB.WithTx(ctx, func(tx db.DB) error {
+					current, err := tx.GetTask(ctx, task.ID)
+					if err != nil {
+						return err
+					}
+					current.Description += "x"
+					return tx.UpdateTask(ctx, current)
+				})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
 			Expect(err).To(BeNil())
-			Expect(tasks).To(HaveLen(0))
-		})
-
-		It("should not delete a task with wrong user ID", func() {
-			err := testDB.DeleteTask(task.ID, "wrong_user_id")
-			Expect(err).ToNot(BeNil())
-			Expect(err.Error()).To(ContainSubstring("task not found"))
-		})
-
-		It("should not get a non-existent task", func() {
-			_, err := testDB.GetTask("non_existent_id")
-			Expect(err).ToNot(BeNil())
-			Expect(err.Error()).To(ContainSubstring("task not found"))
-		})
-
-		It("should not update a non-existent task", func() {
-			task.ID = "non_existent_id"
-			err := testDB.UpdateTask(task)
-			Expect(err).ToNot(BeNil())
-			Expect(err.Error()).To(ContainSubstring("task not found"))
-		})
+		}
+		got, err := testDB.GetTask(ctx, task.ID)
+		Expect(err).To(BeNil())
+		Expect(got.Description).To(HaveLen(20))
 	})
 })
+
+var _ = DescribeTable("Rebinding placeholders for Postgres",
+	func(query, expected string) {
+		Expect(db.RebindDollar(query)).To(Equal(expected))
+	},
+	Entry("numbers them in order", "SELECT * FROM tasks WHERE id = ? AND user_id = ?", "SELECT * FROM tasks WHERE id = $1 AND user_id = $2"),
+	Entry("leaves string literals alone", "SELECT '?', ? WHERE title <> 'why?'", "SELECT '?', $1 WHERE title <> 'why?'"),
+	Entry("handles escaped quotes", "SELECT 'it''s ?', ?", "SELECT 'it''s ?', $1"),
+	Entry("leaves quoted identifiers alone", `SELECT "odd?name" FROM t WHERE a = ?`, `SELECT "odd?name" FROM t WHERE a = $1`),
+)
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"task-manager/internal/model"
+)
+
+// dialect captures the differences between the SQL databases sqlDB runs on
+type dialect interface {
+	// rebind rewrites a query written with ? placeholders into the dialect's form
+	rebind(query string) string
+	// isUniqueViolation reports whether err was caused by a UNIQUE constraint
+	isUniqueViolation(err error) bool
+	// isForeignKeyViolation reports whether err was caused by a FOREIGN KEY constraint
+	isForeignKeyViolation(err error) bool
+	// lower returns an expression for expr in lower case, with every letter
+	// folded as strings.ToLower folds it rather than only ASCII ones
+	lower(expr string) string
+	// searchTasks ranks a user's tasks against the search terms, best first
+	searchTasks(ctx context.Context, s *sqlDB, userID string, terms []string, limit int) ([]model.TaskSearchResult, error)
+}
+
+// rebindDollar replaces each ? placeholder with $1, $2, ... in order. A ?
+// inside a quoted string or identifier is left as it is. A doubled quote,
+// which stands for the quote itself, ends the quoted part and starts it
+// again, which comes to the same.
+func rebindDollar(query string) string {
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -1,8 +1,43 @@
 package db
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrUserNotFound = errors.New("user not found")
-	ErrTaskNotFound = errors.New("task not found")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrTaskNotFound    = errors.New("task not found")
+	ErrEmailTaken      = errors.New("email already in use")
+	ErrUserHasTasks    = errors.New("user still owns tasks")
+	ErrTokenNotFound   = errors.New("token not found")
+	ErrVersionConflict = errors.New("task has been modified")
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrTagExists       = errors.New("tag already exists")
+
+	ErrDependencyNotFound = errors.New("dependency not found")
+	ErrDependencyExists   = errors.New("dependency already exists")
+
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	ErrInvalidSort   = errors.New("invalid sort field")
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	ErrMigrationChecksum = errors.New("applied migration has been modified")
+	ErrUnknownMigration  = errors.New("unknown migration")
+	ErrIrreversible      = errors.New("migration cannot be reverted")
 )
+
+// UserHasTasksError is returned when deleting a user who still owns tasks
+// without asking for them to be deleted too
+type UserHasTasksError struct {
+	TaskCount int
+}
+
+func (e *UserHasTasksError) Error() string {
+	return fmt.Sprintf("%s: %d task(s)", ErrUserHasTasks, e.TaskCount)
+}
+
+func (e *UserHasTasksError) Is(target error) bool {
+	return target == ErrUserHasTasks
+}
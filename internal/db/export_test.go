@@ -0,0 +1,4 @@
+package db
+
+// RebindDollar exposes rebindDollar to the tests
+var RebindDollar = rebindDollar
@@ -1,22 +1,130 @@
 package db
 
-import "task-manager/internal/model"
+import (
+	"context"
+	"time"
+
+	"task-manager/internal/model"
+)
 
 type DB interface {
 	// User methods
-	CreateUser(user *model.User) error
-	GetUser(id string) (*model.User, error)
-	ListUsers() ([]model.User, error)
-	DeleteUser(id string) error
+	CreateUser(ctx context.Context, user *model.User) error
+	GetUser(ctx context.Context, id string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	UpdateUserRole(ctx context.Context, id string, role string) error
+	CountUsersWithRole(ctx context.Context, role string) (int, error)
+	// ListUsers returns one page of users and the cursor for the next page,
+	// which is empty on the last page
+	ListUsers(ctx context.Context, p Page) ([]model.User, string, error)
+	// DeleteUser removes a user and their API tokens; their tasks are deleted
+	// with them when cascade is set, otherwise a *UserHasTasksError is
+	// returned if any remain
+	DeleteUser(ctx context.Context, id string, cascade bool) error
+
+	// API token methods. Tokens are looked up by the hash of their secret,
+	// which is all that is stored.
+	CreateAPIToken(ctx context.Context, token *model.APIToken, hash string) error
+	// GetUserByTokenHash returns the owner of the token with the given hash
+	GetUserByTokenHash(ctx context.Context, hash string) (*model.User, error)
+	ListAPITokens(ctx context.Context, userID string) ([]model.APIToken, error)
+	DeleteAPIToken(ctx context.Context, id string, userID string) error
+
+	// RevokeToken records that the session token with the given ID may no
+	// longer be used. It reports false if the token was already revoked.
+	// Records are dropped once the token would have expired anyway.
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
 
 	// Task methods (always under user context)
-	CreateTask(task *model.Task) error
-	GetTask(id string) (*model.Task, error)
-	ListTasks(userID string, status string) ([]model.Task, error)
-	UpdateTask(task *model.Task) error
-	DeleteTask(id string, userID string) error
+	CreateTask(ctx context.Context, task *model.Task) error
+	GetTask(ctx context.Context, id string) (*model.Task, error)
+	// ListTasks returns one page of a user's tasks and the cursor for the next
+	// page, which is empty on the last page
+	ListTasks(ctx context.Context, userID string, q TaskQuery) ([]model.Task, string, error)
+	// SearchTasks ranks a user's tasks by how well their title and description
+	// match the words of query, each of which may be a prefix
+	SearchTasks(ctx context.Context, userID string, query string, limit int) ([]model.TaskSearchResult, error)
+	// UpdateTask replaces the editable fields of a task owned by task.UserID,
+	// bumps its version and fills task with the stored row. A non-zero
+	// task.Version must equal the stored one or ErrVersionConflict is returned.
+	UpdateTask(ctx context.Context, task *model.Task) error
+	// DeleteTask removes a task and its dependencies; its subtasks become
+	// top-level tasks
+	DeleteTask(ctx context.Context, id string, userID string) error
+	// CountSubtasks returns the progress of each of the given tasks that has
+	// subtasks, counting those in one of doneStatuses as done
+	CountSubtasks(ctx context.Context, parentIDs []string, doneStatuses []string) (map[string]model.Progress, error)
+
+	// Scheduler methods. They look at the tasks of every user, leave out
+	// those in one of doneStatuses and return at most limit tasks.
+	// ListDueReminders returns the tasks whose next reminder is due at or
+	// before now, earliest first
+	ListDueReminders(ctx context.Context, now time.Time, doneStatuses []string, limit int) ([]model.Task, error)
+	// ListNewlyOverdue returns the tasks due at or after since and before now
+	// that are not flagged overdue yet, earliest due first
+	ListNewlyOverdue(ctx context.Context, since, now time.Time, doneStatuses []string, limit int) ([]model.Task, error)
+	// SetTaskSchedule stores task.NextReminderAt and task.OverdueAt. Unlike
+	// UpdateTask it leaves the version and updated_at alone, as the user
+	// changed nothing, but task.Version must still equal the stored one or
+	// ErrVersionConflict is returned.
+	SetTaskSchedule(ctx context.Context, task *model.Task) error
+	// SchedulerStart returns when the scheduler first ran, recording start if
+	// it never has
+	SchedulerStart(ctx context.Context, start time.Time) (time.Time, error)
+
+	// Dependency methods. Adding or removing a dependency counts as a change
+	// to the dependent task.
+	AddDependency(ctx context.Context, dep *model.Dependency) error
+	DeleteDependency(ctx context.Context, taskID string, blockerID string) error
+	// ListDependencies returns the dependencies a task is on either side of,
+	// oldest first
+	ListDependencies(ctx context.Context, taskID string) ([]model.Dependency, error)
+	// CountOpenBlockers returns, for each of the given tasks that is blocked,
+	// how many of its blockers are not in one of doneStatuses
+	CountOpenBlockers(ctx context.Context, taskIDs []string, doneStatuses []string) (map[string]int, error)
+
+	// Tag methods. CreateTask and UpdateTask store task.Tags, creating the
+	// tags that do not exist yet; renaming or deleting a tag changes every
+	// task it is attached to.
+	CreateTag(ctx context.Context, tag *model.Tag) error
+	// ListTags returns a user's tags ordered by name
+	ListTags(ctx context.Context, userID string) ([]model.Tag, error)
+	// RenameTag sets the name of the tag tag.ID owned by tag.UserID and fills
+	// tag with the stored row
+	RenameTag(ctx context.Context, tag *model.Tag) error
+	DeleteTag(ctx context.Context, id string, userID string) error
+
+	// Webhook methods. Deleting a webhook deletes its deliveries. Deleting a
+	// user deletes their webhooks and finished deliveries but keeps the
+	// pending ones, so that user.deleted is still sent.
+	CreateWebhook(ctx context.Context, hook *model.Webhook) error
+	GetWebhook(ctx context.Context, id string, userID string) (*model.Webhook, error)
+	// ListWebhooks returns a user's webhooks, oldest first
+	ListWebhooks(ctx context.Context, userID string) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string, userID string) error
+	// CreateDelivery queues an event for a webhook
+	CreateDelivery(ctx context.Context, d *model.WebhookDelivery) error
+	// ListDeliveries returns one page of a webhook's deliveries and the
+	// cursor for the next page, which is empty on the last page
+	ListDeliveries(ctx context.Context, webhookID string, p Page) ([]model.WebhookDelivery, string, error)
+	// ListPendingDeliveries returns the pending deliveries of every webhook
+	// whose next attempt is due at or before now, oldest first
+	ListPendingDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error)
+	// UpdateDelivery stores the outcome of an attempt: the status, attempts,
+	// next attempt, response status and error of d
+	UpdateDelivery(ctx context.Context, d *model.WebhookDelivery) error
+
+	// WithTx runs fn atomically: the transaction is committed if fn returns
+	// nil and rolled back if it returns an error or panics. fn must only use
+	// the tx it is given; calling back into the outer DB may deadlock.
+	WithTx(ctx context.Context, fn func(tx DB) error) error
 
 	Close() error
 }
 
-var _ DB = (*SQLiteDB)(nil)
+var (
+	_ DB = (*SQLiteDB)(nil)
+	_ DB = (*PostgresDB)(nil)
+	_ DB = (*MemoryDB)(nil)
+)
@@ -0,0 +1,978 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"task-manager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// MemoryDB is a thread-safe, non-persistent DB implementation for tests and
+// throwaway servers. It mirrors the semantics of the SQL implementations.
+type MemoryDB struct {
+	*memoryData
+	// inTx is set on the handles given to WithTx callbacks, which run while
+	// the transaction already holds the write lock
+	inTx bool
+}
+
+type memoryData struct {
+	mu sync.RWMutex
+	memoryTables
+}
+
+// memoryTables holds the stored rows; the *Order slices keep insertion order
+type memoryTables struct {
+	users     map[string]model.User
+	userOrder []string
+	tasks     map[string]model.Task
+	taskOrder []string
+	tags      map[string]model.Tag
+	// taskTags maps task IDs to the IDs of their tags. The slices are
+	// replaced, never modified in place, so clones may share them.
+	taskTags map[string][]string
+	// dependencies are kept in the order they were added
+	dependencies []model.Dependency
+	// tokens is keyed by token hash
+	tokens map[string]model.APIToken
+	// revoked maps revoked session token IDs to their expiry
+	revoked map[string]string
+	// webhooks and deliveries are keyed by ID
+	webhooks   map[string]model.Webhook
+	deliveries map[string]model.WebhookDelivery
+	// schedulerStart is when the scheduler first ran, see SchedulerStart
+	schedulerStart string
+}
+
+// clone copies the tables deeply enough for a transaction to restore them
+func (t memoryTables) clone() memoryTables {
+	return memoryTables{
+		users:          maps.Clone(t.users),
+		userOrder:      slices.Clone(t.userOrder),
+		tasks:          maps.Clone(t.tasks),
+		taskOrder:      slices.Clone(t.taskOrder),
+		tags:           maps.Clone(t.tags),
+		taskTags:       maps.Clone(t.taskTags),
+		tokens:         maps.Clone(t.tokens),
+		revoked:        maps.Clone(t.revoked),
+		dependencies:   slices.Clone(t.dependencies),
+		webhooks:       maps.Clone(t.webhooks),
+		deliveries:     maps.Clone(t.deliveries),
+		schedulerStart: t.schedulerStart,
+	}
+}
+
+// NewMemoryDB returns an empty MemoryDB
+func NewMemoryDB() DB {
+	return &MemoryDB{memoryData: &memoryData{memoryTables: memoryTables{
+		users:    make(map[string]model.User),
+		tasks:    make(map[string]model.Task),
+		tags:     make(map[string]model.Tag),
+		taskTags: make(map[string][]string),
+		tokens:   make(map[string]model.APIToken),
+		revoked:  make(map[string]string),
+
+		webhooks:   make(map[string]model.Webhook),
+		deliveries: make(map[string]model.WebhookDelivery),
+	}}}
+}
+
+// Close is a no-op; the data is discarded with the MemoryDB
+func (m *MemoryDB) Close() error {
+	return nil
+}
+
+func (m *MemoryDB) lock() {
+	if !m.inTx {
+		m.mu.Lock()
+	}
+}
+
+func (m *MemoryDB) unlock() {
+	if !m.inTx {
+		m.mu.Unlock()
+	}
+}
+
+func (m *MemoryDB) rlock() {
+	if !m.inTx {
+		m.mu.RLock()
+	}
+}
+
+func (m *MemoryDB) runlock() {
+	if !m.inTx {
+		m.mu.RUnlock()
+	}
+}
+
+// WithTx runs fn while holding the write lock, restoring a snapshot of the
+// data if fn fails or panics
+func (m *MemoryDB) WithTx(ctx context.Context, fn func(tx DB) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	snapshot := m.memoryTables.clone()
+	restore := func() {
+		m.memoryTables = snapshot
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			restore()
+			panic(p)
+		}
+	}()
+	if err := fn(&MemoryDB{memoryData: m.memoryData, inTx: true}); err != nil {
+		restore()
+		return err
+	}
+	return nil
+}
+
+// Task methods
+
+func (m *MemoryDB) CreateTask(ctx context.Context, task *model.Task) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	if _, ok := m.users[task.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	task.ID = uuid.New().String()
+	task.CreatedAt = now()
+	task.UpdatedAt = task.CreatedAt
+	task.Version = 1
+	task.DueDate = normalizeDueDate(task.DueDate)
+	task.Priority = normalizePriority(task.Priority)
+	task.Reminders = normalizeReminders(task.Reminders)
+	m.setTaskTags(task)
+	m.tasks[task.ID] = *task
+	m.taskOrder = append(m.taskOrder, task.ID)
+	return nil
+}
+
+func (m *MemoryDB) GetTask(ctx context.Context, id string) (*model.Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	task, ok := m.tasks[id]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	task = m.withTags(task)
+	return &task, nil
+}
+
+func (m *MemoryDB) ListTasks(ctx context.Context, userID string, q TaskQuery) ([]model.Task, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	page, after, err := q.Page.normalize(TaskSortFields)
+	if err != nil {
+		return nil, "", err
+	}
+	m.rlock()
+	defer m.runlock()
+	var tasks []model.Task
+	for _, id := range m.taskOrder {
+		t := m.withTags(m.tasks[id])
+		if !q.matches(userID, t) {
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	tasks, next := paginate(page, after, tasks, taskSortKey)
+	return tasks, next, nil
+}
+
+func (m *MemoryDB) SearchTasks(ctx context.Context, userID string, query string, limit int) ([]model.TaskSearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return []model.TaskSearchResult{}, nil
+	}
+	m.rlock()
+	defer m.runlock()
+	var tasks []model.Task
+	for _, id := range m.taskOrder {
+		if t := m.tasks[id]; t.UserID == userID {
+			tasks = append(tasks, m.withTags(t))
+		}
+	}
+	return rankTasks(tasks, terms, searchLimit(limit)), nil
+}
+
+func (m *MemoryDB) UpdateTask(ctx context.Context, task *model.Task) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	existing, ok := m.tasks[task.ID]
+	if !ok || existing.UserID != task.UserID {
+		return ErrTaskNotFound
+	}
+	if task.Version != 0 && task.Version != existing.Version {
+		return ErrVersionConflict
+	}
+	existing.Title = task.Title
+	existing.Description = task.Description
+	existing.DueDate = normalizeDueDate(task.DueDate)
+	existing.Status = task.Status
+	existing.Priority = normalizePriority(task.Priority)
+	existing.ParentID = task.ParentID
+	existing.Recurrence = task.Recurrence
+	existing.SeriesID = task.SeriesID
+	existing.Occurrence = task.Occurrence
+	existing.Reminders = normalizeReminders(task.Reminders)
+	existing.NextReminderAt = task.NextReminderAt
+	existing.OverdueAt = task.OverdueAt
+	existing.Tags = task.Tags
+	existing.UpdatedAt = now()
+	existing.Version++
+	m.setTaskTags(&existing)
+	m.tasks[task.ID] = existing
+	*task = existing
+	return nil
+}
+
+func (m *MemoryDB) DeleteTask(ctx context.Context, id string, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	task, ok := m.tasks[id]
+	if !ok || task.UserID != userID {
+		return ErrTaskNotFound
+	}
+	delete(m.tasks, id)
+	delete(m.taskTags, id)
+	m.taskOrder = slices.DeleteFunc(m.taskOrder, func(tid string) bool { return tid == id })
+	for tid, t := range m.tasks {
+		if t.ParentID == id && t.UserID == userID {
+			t.ParentID = ""
+			t.UpdatedAt = now()
+			t.Version++
+			m.tasks[tid] = t
+		}
+	}
+	for _, d := range m.dependencies {
+		if d.BlockerID == id {
+			m.touchTask(d.TaskID)
+		}
+	}
+	m.dependencies = slices.DeleteFunc(m.dependencies, func(d model.Dependency) bool {
+		return d.TaskID == id || d.BlockerID == id
+	})
+	return nil
+}
+
+func (m *MemoryDB) CountSubtasks(ctx context.Context, parentIDs []string, doneStatuses []string) (map[string]model.Progress, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	counts := make(map[string]model.Progress, len(parentIDs))
+	for _, t := range m.tasks {
+		if t.ParentID == "" || !slices.Contains(parentIDs, t.ParentID) {
+			continue
+		}
+		p := counts[t.ParentID]
+		p.Total++
+		if slices.Contains(doneStatuses, t.Status) {
+			p.Done++
+		}
+		counts[t.ParentID] = p
+	}
+	for id, p := range counts {
+		counts[id] = newProgress(p.Total, p.Done)
+	}
+	return counts, nil
+}
+
+// Scheduler methods
+
+func (m *MemoryDB) ListDueReminders(ctx context.Context, now time.Time, doneStatuses []string, limit int) ([]model.Task, error) {
+	at := now.UTC().Format(dueDateLayout)
+	return m.listScheduled(ctx, doneStatuses, limit, func(t model.Task) (string, bool) {
+		return t.NextReminderAt, t.NextReminderAt != "" && t.NextReminderAt <= at
+	})
+}
+
+func (m *MemoryDB) ListNewlyOverdue(ctx context.Context, since, now time.Time, doneStatuses []string, limit int) ([]model.Task, error) {
+	from, at := since.UTC().Format(dueDateLayout), now.UTC().Format(dueDateLayout)
+	return m.listScheduled(ctx, doneStatuses, limit, func(t model.Task) (string, bool) {
+		return t.DueDate, t.OverdueAt == "" && t.DueDate != "" && t.DueDate >= from && t.DueDate < at
+	})
+}
+
+func (m *MemoryDB) SetTaskSchedule(ctx context.Context, task *model.Task) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	existing, ok := m.tasks[task.ID]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	if task.Version != existing.Version {
+		return ErrVersionConflict
+	}
+	existing.NextReminderAt = task.NextReminderAt
+	existing.OverdueAt = task.OverdueAt
+	m.tasks[task.ID] = existing
+	return nil
+}
+
+func (m *MemoryDB) SchedulerStart(ctx context.Context, start time.Time) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	m.lock()
+	defer m.unlock()
+	if m.schedulerStart == "" {
+		m.schedulerStart = start.UTC().Format(dueDateLayout)
+	}
+	return time.Parse(dueDateLayout, m.schedulerStart)
+}
+
+// listScheduled returns up to limit tasks of every user that are not in one
+// of doneStatuses and that match reports, ordered by the key it returns
+func (m *MemoryDB) listScheduled(ctx context.Context, doneStatuses []string, limit int, match func(t model.Task) (string, bool)) ([]model.Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	type keyed struct {
+		key  string
+		task model.Task
+	}
+	var found []keyed
+	for _, t := range m.tasks {
+		if key, ok := match(t); ok && !slices.Contains(doneStatuses, t.Status) {
+			found = append(found, keyed{key, m.withTags(t)})
+		}
+	}
+	slices.SortFunc(found, func(a, b keyed) int {
+		return cmp.Or(cmp.Compare(a.key, b.key), cmp.Compare(a.task.ID, b.task.ID))
+	})
+	tasks := []model.Task{}
+	for _, f := range found[:min(limit, len(found))] {
+		tasks = append(tasks, f.task)
+	}
+	return tasks, nil
+}
+
+// Dependency methods
+
+func (m *MemoryDB) AddDependency(ctx context.Context, dep *model.Dependency) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	if _, ok := m.tasks[dep.TaskID]; !ok {
+		return ErrTaskNotFound
+	}
+	if _, ok := m.tasks[dep.BlockerID]; !ok {
+		return ErrTaskNotFound
+	}
+	if slices.ContainsFunc(m.dependencies, func(d model.Dependency) bool {
+		return d.TaskID == dep.TaskID && d.BlockerID == dep.BlockerID
+	}) {
+		return ErrDependencyExists
+	}
+	dep.CreatedAt = now()
+	m.dependencies = append(m.dependencies, *dep)
+	m.touchTask(dep.TaskID)
+	return nil
+}
+
+func (m *MemoryDB) DeleteDependency(ctx context.Context, taskID string, blockerID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	i := slices.IndexFunc(m.dependencies, func(d model.Dependency) bool {
+		return d.TaskID == taskID && d.BlockerID == blockerID
+	})
+	if i < 0 {
+		return ErrDependencyNotFound
+	}
+	m.dependencies = slices.Delete(m.dependencies, i, i+1)
+	m.touchTask(taskID)
+	return nil
+}
+
+func (m *MemoryDB) ListDependencies(ctx context.Context, taskID string) ([]model.Dependency, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	deps := []model.Dependency{}
+	for _, d := range m.dependencies {
+		if d.TaskID == taskID || d.BlockerID == taskID {
+			deps = append(deps, d)
+		}
+	}
+	slices.SortStableFunc(deps, func(a, b model.Dependency) int {
+		return cmp.Or(
+			strings.Compare(a.CreatedAt, b.CreatedAt),
+			strings.Compare(a.TaskID, b.TaskID),
+			strings.Compare(a.BlockerID, b.BlockerID),
+		)
+	})
+	return deps, nil
+}
+
+func (m *MemoryDB) CountOpenBlockers(ctx context.Context, taskIDs []string, doneStatuses []string) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	counts := make(map[string]int, len(taskIDs))
+	for _, d := range m.dependencies {
+		if slices.Contains(taskIDs, d.TaskID) && !slices.Contains(doneStatuses, m.tasks[d.BlockerID].Status) {
+			counts[d.TaskID]++
+		}
+	}
+	return counts, nil
+}
+
+// touchTask records a change to a task whose computed fields changed
+func (m *MemoryDB) touchTask(id string) {
+	if task, ok := m.tasks[id]; ok {
+		task.UpdatedAt = now()
+		task.Version++
+		m.tasks[id] = task
+	}
+}
+
+// setTaskTags attaches the tags named in task.Tags to the task in place of
+// its current ones, creating the tags its owner does not have yet
+func (m *MemoryDB) setTaskTags(task *model.Task) {
+	task.Tags = normalizeTags(task.Tags)
+	ids := make([]string, 0, len(task.Tags))
+	for _, name := range task.Tags {
+		tag, ok := m.tagNamed(task.UserID, name)
+		if !ok {
+			tag = model.Tag{ID: uuid.New().String(), UserID: task.UserID, Name: name, CreatedAt: now()}
+			m.tags[tag.ID] = tag
+		}
+		ids = append(ids, tag.ID)
+	}
+	m.taskTags[task.ID] = ids
+}
+
+// withTags fills in the tag names of a stored task. It also copies the
+// reminders, so callers cannot change the stored ones.
+func (m *MemoryDB) withTags(task model.Task) model.Task {
+	task.Reminders = slices.Clone(task.Reminders)
+	task.Tags = []string{}
+	for _, id := range m.taskTags[task.ID] {
+		task.Tags = append(task.Tags, m.tags[id].Name)
+	}
+	slices.Sort(task.Tags)
+	return task
+}
+
+func (m *MemoryDB) tagNamed(userID, name string) (model.Tag, bool) {
+	for _, t := range m.tags {
+		if t.UserID == userID && t.Name == name {
+			return t, true
+		}
+	}
+	return model.Tag{}, false
+}
+
+// touchTagged records a change to every task carrying the tag
+func (m *MemoryDB) touchTagged(tagID string) {
+	for taskID, ids := range m.taskTags {
+		if slices.Contains(ids, tagID) {
+			task := m.tasks[taskID]
+			task.UpdatedAt = now()
+			task.Version++
+			m.tasks[taskID] = task
+		}
+	}
+}
+
+// Tag methods
+
+func (m *MemoryDB) CreateTag(ctx context.Context, tag *model.Tag) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	if _, ok := m.users[tag.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	if _, ok := m.tagNamed(tag.UserID, tag.Name); ok {
+		return ErrTagExists
+	}
+	tag.ID = uuid.New().String()
+	tag.CreatedAt = now()
+	m.tags[tag.ID] = *tag
+	return nil
+}
+
+func (m *MemoryDB) ListTags(ctx context.Context, userID string) ([]model.Tag, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	tags := []model.Tag{}
+	for _, t := range m.tags {
+		if t.UserID == userID {
+			tags = append(tags, t)
+		}
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+func (m *MemoryDB) RenameTag(ctx context.Context, tag *model.Tag) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	existing, ok := m.tags[tag.ID]
+	if !ok || existing.UserID != tag.UserID {
+		return ErrTagNotFound
+	}
+	if other, ok := m.tagNamed(tag.UserID, tag.Name); ok && other.ID != tag.ID {
+		return ErrTagExists
+	}
+	existing.Name = tag.Name
+	m.tags[tag.ID] = existing
+	m.touchTagged(tag.ID)
+	*tag = existing
+	return nil
+}
+
+func (m *MemoryDB) DeleteTag(ctx context.Context, id string, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	tag, ok := m.tags[id]
+	if !ok || tag.UserID != userID {
+		return ErrTagNotFound
+	}
+	m.touchTagged(id)
+	for taskID, ids := range m.taskTags {
+		if slices.Contains(ids, id) {
+			m.taskTags[taskID] = slices.DeleteFunc(slices.Clone(ids), func(tid string) bool { return tid == id })
+		}
+	}
+	delete(m.tags, id)
+	return nil
+}
+
+// User methods
+
+func (m *MemoryDB) CreateUser(ctx context.Context, user *model.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, user.Email) {
+			return ErrEmailTaken
+		}
+	}
+	user.ID = uuid.New().String()
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+	if user.Role == "" {
+		user.Role = model.RoleMember
+	}
+	m.users[user.ID] = *user
+	m.userOrder = append(m.userOrder, user.ID)
+	return nil
+}
+
+func (m *MemoryDB) GetUser(ctx context.Context, id string) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (m *MemoryDB) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	email = strings.TrimSpace(email)
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) {
+			return &u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (m *MemoryDB) UpdateUserRole(ctx context.Context, id string, role string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	user.UpdatedAt = now()
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryDB) CountUsersWithRole(ctx context.Context, role string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.rlock()
+	defer m.runlock()
+	count := 0
+	for _, u := range m.users {
+		if u.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryDB) ListUsers(ctx context.Context, p Page) ([]model.User, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	page, after, err := p.normalize(UserSortFields)
+	if err != nil {
+		return nil, "", err
+	}
+	m.rlock()
+	defer m.runlock()
+	var users []model.User
+	for _, id := range m.userOrder {
+		users = append(users, m.users[id])
+	}
+	users, next := paginate(page, after, users, userSortKey)
+	return users, next, nil
+}
+
+func (m *MemoryDB) DeleteUser(ctx context.Context, id string, cascade bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	if _, ok := m.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	var owned []string
+	for _, tid := range m.taskOrder {
+		if m.tasks[tid].UserID == id {
+			owned = append(owned, tid)
+		}
+	}
+	if len(owned) > 0 {
+		if !cascade {
+			return &UserHasTasksError{TaskCount: len(owned)}
+		}
+		for _, tid := range owned {
+			delete(m.tasks, tid)
+			delete(m.taskTags, tid)
+		}
+		m.dependencies = slices.DeleteFunc(m.dependencies, func(d model.Dependency) bool {
+			return slices.Contains(owned, d.TaskID) || slices.Contains(owned, d.BlockerID)
+		})
+		m.taskOrder = slices.DeleteFunc(m.taskOrder, func(tid string) bool { return slices.Contains(owned, tid) })
+	}
+	maps.DeleteFunc(m.tags, func(_ string, t model.Tag) bool { return t.UserID == id })
+	maps.DeleteFunc(m.tokens, func(_ string, t model.APIToken) bool { return t.UserID == id })
+	maps.DeleteFunc(m.deliveries, func(_ string, d model.WebhookDelivery) bool {
+		return d.Status != model.DeliveryPending && m.webhooks[d.WebhookID].UserID == id
+	})
+	maps.DeleteFunc(m.webhooks, func(_ string, h model.Webhook) bool { return h.UserID == id })
+	delete(m.users, id)
+	m.userOrder = slices.DeleteFunc(m.userOrder, func(uid string) bool { return uid == id })
+	return nil
+}
+
+// API token methods
+
+func (m *MemoryDB) CreateAPIToken(ctx context.Context, token *model.APIToken, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	if _, ok := m.users[token.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	token.ID = uuid.New().String()
+	token.CreatedAt = now()
+	m.tokens[hash] = *token
+	return nil
+}
+
+func (m *MemoryDB) GetUserByTokenHash(ctx context.Context, hash string) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	token, ok := m.tokens[hash]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	user := m.users[token.UserID]
+	return &user, nil
+}
+
+func (m *MemoryDB) ListAPITokens(ctx context.Context, userID string) ([]model.APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	tokens := []model.APIToken{}
+	for _, t := range m.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t)
+		}
+	}
+	slices.SortFunc(tokens, func(a, b model.APIToken) int {
+		if c := strings.Compare(a.CreatedAt, b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return tokens, nil
+}
+
+func (m *MemoryDB) DeleteAPIToken(ctx context.Context, id string, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	for hash, t := range m.tokens {
+		if t.ID == id && t.UserID == userID {
+			delete(m.tokens, hash)
+			return nil
+		}
+	}
+	return ErrTokenNotFound
+}
+
+func (m *MemoryDB) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.lock()
+	defer m.unlock()
+	cutoff := now()
+	maps.DeleteFunc(m.revoked, func(_ string, expiry string) bool { return expiry < cutoff })
+	if _, ok := m.revoked[jti]; ok {
+		return false, nil
+	}
+	m.revoked[jti] = expiresAt.UTC().Format(timestampLayout)
+	return true, nil
+}
+
+func (m *MemoryDB) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.rlock()
+	defer m.runlock()
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
+// Webhook methods
+
+func (m *MemoryDB) CreateWebhook(ctx context.Context, hook *model.Webhook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	if _, ok := m.users[hook.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	hook.ID = uuid.New().String()
+	hook.CreatedAt = now()
+	hook.Events = slices.Clone(hook.Events)
+	m.webhooks[hook.ID] = *hook
+	return nil
+}
+
+func (m *MemoryDB) GetWebhook(ctx context.Context, id string, userID string) (*model.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	hook, ok := m.webhooks[id]
+	if !ok || hook.UserID != userID {
+		return nil, ErrWebhookNotFound
+	}
+	hook.Events = slices.Clone(hook.Events)
+	return &hook, nil
+}
+
+func (m *MemoryDB) ListWebhooks(ctx context.Context, userID string) ([]model.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	hooks := []model.Webhook{}
+	for _, h := range m.webhooks {
+		if h.UserID == userID {
+			h.Events = slices.Clone(h.Events)
+			hooks = append(hooks, h)
+		}
+	}
+	slices.SortFunc(hooks, func(a, b model.Webhook) int {
+		if c := strings.Compare(a.CreatedAt, b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return hooks, nil
+}
+
+func (m *MemoryDB) DeleteWebhook(ctx context.Context, id string, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	if hook, ok := m.webhooks[id]; !ok || hook.UserID != userID {
+		return ErrWebhookNotFound
+	}
+	delete(m.webhooks, id)
+	maps.DeleteFunc(m.deliveries, func(_ string, d model.WebhookDelivery) bool { return d.WebhookID == id })
+	return nil
+}
+
+func (m *MemoryDB) CreateDelivery(ctx context.Context, d *model.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	d.ID = uuid.New().String()
+	d.CreatedAt = now()
+	d.UpdatedAt = d.CreatedAt
+	m.deliveries[d.ID] = *d
+	return nil
+}
+
+func (m *MemoryDB) ListDeliveries(ctx context.Context, webhookID string, p Page) ([]model.WebhookDelivery, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	page, after, err := p.normalize(DeliverySortFields)
+	if err != nil {
+		return nil, "", err
+	}
+	m.rlock()
+	defer m.runlock()
+	var deliveries []model.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	deliveries, next := paginate(page, after, deliveries, deliverySortKey)
+	return deliveries, next, nil
+}
+
+func (m *MemoryDB) ListPendingDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.rlock()
+	defer m.runlock()
+	cutoff := now.UTC().Format(dueDateLayout)
+	deliveries := []model.WebhookDelivery{}
+	for _, d := range m.deliveries {
+		if d.Status == model.DeliveryPending && d.NextAttemptAt <= cutoff {
+			deliveries = append(deliveries, d)
+		}
+	}
+	slices.SortFunc(deliveries, func(a, b model.WebhookDelivery) int {
+		if c := strings.Compare(a.CreatedAt, b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (m *MemoryDB) UpdateDelivery(ctx context.Context, d *model.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	stored, ok := m.deliveries[d.ID]
+	if !ok {
+		return nil
+	}
+	d.UpdatedAt = now()
+	stored.Status = d.Status
+	stored.Attempts = d.Attempts
+	stored.NextAttemptAt = d.NextAttemptAt
+	stored.ResponseStatus = d.ResponseStatus
+	stored.Error = d.Error
+	stored.UpdatedAt = d.UpdatedAt
+	m.deliveries[d.ID] = stored
+	return nil
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migration is a single numbered schema change with its forward and reverse
+// SQL. Down is empty for migrations that cannot be undone, such as ones that
+// delete data; rolling back stops at them.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum returns a digest of the migration's Up SQL, used to detect
+// migrations that were edited after being applied
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationStatus describes whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt string
+	Modified  bool
+}
+
+// Migrator applies and reverts migrations, recording progress in the
+// schema_migrations table
+type Migrator struct {
+	conn       *sql.DB
+	migrations []Migration
+	dialect    dialect
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt string
+}
+
+// NewMigrator creates a Migrator for the given SQLite connection and migration set
+func NewMigrator(conn *sql.DB, migrations []Migration) *Migrator {
+	return newMigrator(conn, migrations, sqliteDialect{})
+}
+
+func newMigrator(conn *sql.DB, migrations []Migration, d dialect) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{conn: conn, migrations: sorted, dialect: d}
+}
+
+func (m *Migrator) ensureTable() error {
+	_, err := m.conn.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied() (map[int]appliedMigration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	rows, err := m.conn.Query("SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// verify checks that every applied migration is still known and unchanged
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	known := make(map[int]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	for version, a := range applied {
+		mig, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: version %d is applied but unknown", ErrUnknownMigration, version)
+		}
+		if mig.Checksum() != a.checksum {
+			return fmt.Errorf("%w: version %d (%s)", ErrMigrationChecksum, version, mig.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies all pending migrations in order and returns how many were applied
+func (m *Migrator) Up() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	if err := m.verify(applied); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		err := m.run(mig.Up,
+			"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+			mig.Version, mig.Name, mig.Checksum(), time.Now().UTC().Format(time.RFC3339),
+		)
+		if err != nil {
+			return count, fmt.Errorf("error applying migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Down reverts up to steps of the most recently applied migrations and
+// returns how many were reverted. It fails with ErrIrreversible on reaching a
+// migration without a Down script, leaving it and the ones before it applied.
+func (m *Migrator) Down(steps int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	if err := m.verify(applied); err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if strings.TrimSpace(mig.Down) == "" {
+			return count, fmt.Errorf("%w: version %d (%s)", ErrIrreversible, mig.Version, mig.Name)
+		}
+		err := m.run(mig.Down, "DELETE FROM schema_migrations WHERE version = ?", mig.Version)
+		if err != nil {
+			return count, fmt.Errorf("error reverting migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status reports every known migration and whether it has been applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.appliedAt
+			status.Modified = a.checksum != mig.Checksum()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// run executes a migration script and its bookkeeping statement in one transaction
+func (m *Migrator) run(script string, bookkeeping string, args ...any) error {
+	tx, err := m.conn.Begin()
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(script) != "" {
+		if _, err := tx.Exec(script); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(m.dialect.rebind(bookkeeping), args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the connection the Migrator was created with
+func (m *Migrator) Close() error {
+	return m.conn.Close()
+}
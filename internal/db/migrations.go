@@ -0,0 +1,640 @@
+package db
+
+// sqliteMigrations is the ordered schema history for SQLite databases.
+// Applied migrations must never be edited; add a new version instead.
+var sqliteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_users_and_tasks",
+		Up: `
+			CREATE TABLE IF NOT EXISTS users (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				email TEXT NOT NULL UNIQUE
+			);
+			CREATE TABLE IF NOT EXISTS tasks (
+				id TEXT PRIMARY KEY,
+				title TEXT NOT NULL,
+				description TEXT,
+				due_date TEXT,
+				status TEXT NOT NULL DEFAULT 'pending',
+				user_id TEXT NOT NULL,
+				FOREIGN KEY(user_id) REFERENCES users(id)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS tasks;
+			DROP TABLE IF EXISTS users;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "delete_orphaned_tasks",
+		Up: `
+			DELETE FROM tasks WHERE user_id NOT IN (SELECT id FROM users);
+		`,
+		// Orphaned tasks cannot be restored, so rolling back stops here
+	},
+	{
+		Version: 3,
+		Name:    "add_created_at",
+		Up: `
+			ALTER TABLE users ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+			UPDATE users SET created_at = strftime('%Y-%m-%dT%H:%M:%f', 'now') || '000Z';
+			UPDATE tasks SET created_at = strftime('%Y-%m-%dT%H:%M:%f', 'now') || '000Z';
+			CREATE INDEX idx_users_created_at ON users(created_at, id);
+			CREATE INDEX idx_tasks_user_created_at ON tasks(user_id, created_at, id);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_user_created_at;
+			DROP INDEX idx_users_created_at;
+			ALTER TABLE tasks DROP COLUMN created_at;
+			ALTER TABLE users DROP COLUMN created_at;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "normalize_due_dates",
+		Up: `
+			UPDATE tasks SET due_date = strftime('%Y-%m-%dT%H:%M:%SZ', due_date)
+				WHERE strftime('%Y-%m-%dT%H:%M:%SZ', due_date) IS NOT NULL;
+			UPDATE tasks SET due_date = '' WHERE due_date IS NULL;
+			CREATE INDEX idx_tasks_user_due_date ON tasks(user_id, due_date, id);
+		`,
+		// Original time zone offsets are not kept, so only the index is dropped
+		Down: `
+			DROP INDEX idx_tasks_user_due_date;
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "add_task_search",
+		// The implicit rowid of tasks may change on VACUUM, as its primary key
+		// is TEXT, so the search index is keyed on the stable INTEGER PRIMARY
+		// KEY of task_search_ids instead. The FTS5 index itself is set up by
+		// syncSearchIndex, as builds without FTS5 cannot create it.
+		Up: `
+			CREATE TABLE task_search_ids (
+				id INTEGER PRIMARY KEY,
+				task_id TEXT NOT NULL UNIQUE
+			);
+		`,
+		Down: `
+			DROP TRIGGER IF EXISTS tasks_fts_update;
+			DROP TRIGGER IF EXISTS tasks_fts_delete;
+			DROP TRIGGER IF EXISTS tasks_fts_insert;
+			DROP TABLE IF EXISTS tasks_fts;
+			DROP TABLE task_search_ids;
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "add_updated_at",
+		Up: `
+			ALTER TABLE users ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+			UPDATE users SET updated_at = created_at;
+			UPDATE tasks SET updated_at = created_at;
+			CREATE INDEX idx_users_updated_at ON users(updated_at, id);
+			CREATE INDEX idx_tasks_user_updated_at ON tasks(user_id, updated_at, id);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_user_updated_at;
+			DROP INDEX idx_users_updated_at;
+			ALTER TABLE tasks DROP COLUMN updated_at;
+			ALTER TABLE users DROP COLUMN updated_at;
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "add_roles_and_api_tokens",
+		// Existing users become members, whoever registered first; the first
+		// admin is set up with the token command's -admin flag
+		Up: `
+			ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+			CREATE TABLE api_tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id),
+				name TEXT NOT NULL,
+				token_hash TEXT NOT NULL UNIQUE,
+				created_at TEXT NOT NULL
+			);
+			CREATE INDEX idx_api_tokens_user ON api_tokens(user_id, created_at, id);
+		`,
+		Down: `
+			DROP TABLE api_tokens;
+			ALTER TABLE users DROP COLUMN role;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "add_passwords_and_revoked_tokens",
+		Up: `
+			ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+			CREATE TABLE revoked_tokens (
+				jti TEXT PRIMARY KEY,
+				expires_at TEXT NOT NULL
+			);
+			CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+		`,
+		Down: `
+			DROP TABLE revoked_tokens;
+			ALTER TABLE users DROP COLUMN password_hash;
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "add_task_version",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+		`,
+		Down: `
+			ALTER TABLE tasks DROP COLUMN version;
+		`,
+	},
+	{
+		Version: 10,
+		Name:    "add_task_priority",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN priority INTEGER NOT NULL DEFAULT 2;
+			CREATE INDEX idx_tasks_user_priority ON tasks(user_id, priority, id);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_user_priority;
+			ALTER TABLE tasks DROP COLUMN priority;
+		`,
+	},
+	{
+		Version: 11,
+		Name:    "create_tags",
+		Up: `
+			CREATE TABLE tags (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id),
+				name TEXT NOT NULL,
+				created_at TEXT NOT NULL,
+				UNIQUE (user_id, name)
+			);
+			CREATE TABLE task_tags (
+				task_id TEXT NOT NULL REFERENCES tasks(id),
+				tag_id TEXT NOT NULL REFERENCES tags(id),
+				PRIMARY KEY (task_id, tag_id)
+			);
+			CREATE INDEX idx_task_tags_tag ON task_tags(tag_id, task_id);
+		`,
+		Down: `
+			DROP TABLE task_tags;
+			DROP TABLE tags;
+		`,
+	},
+	{
+		Version: 12,
+		Name:    "add_task_parent",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+			CREATE INDEX idx_tasks_parent ON tasks(parent_id);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_parent;
+			ALTER TABLE tasks DROP COLUMN parent_id;
+		`,
+	},
+	{
+		Version: 13,
+		Name:    "create_task_dependencies",
+		Up: `
+			CREATE TABLE task_dependencies (
+				task_id TEXT NOT NULL REFERENCES tasks(id),
+				blocker_id TEXT NOT NULL REFERENCES tasks(id),
+				created_at TEXT NOT NULL,
+				PRIMARY KEY (task_id, blocker_id)
+			);
+			CREATE INDEX idx_task_dependencies_blocker ON task_dependencies(blocker_id, task_id);
+		`,
+		Down: `
+			DROP TABLE task_dependencies;
+		`,
+	},
+	{
+		Version: 14,
+		Name:    "add_task_recurrence",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN series_id TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN occurrence INTEGER NOT NULL DEFAULT 0;
+			CREATE INDEX idx_tasks_series ON tasks(series_id, occurrence);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_series;
+			ALTER TABLE tasks DROP COLUMN occurrence;
+			ALTER TABLE tasks DROP COLUMN series_id;
+			ALTER TABLE tasks DROP COLUMN recurrence;
+		`,
+	},
+	{
+		Version: 15,
+		Name:    "add_task_reminders",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN reminders TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN next_reminder_at TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN overdue_at TEXT NOT NULL DEFAULT '';
+			CREATE INDEX idx_tasks_next_reminder ON tasks(next_reminder_at);
+			CREATE INDEX idx_tasks_overdue ON tasks(overdue_at, due_date);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_overdue;
+			DROP INDEX idx_tasks_next_reminder;
+			ALTER TABLE tasks DROP COLUMN overdue_at;
+			ALTER TABLE tasks DROP COLUMN next_reminder_at;
+			ALTER TABLE tasks DROP COLUMN reminders;
+		`,
+	},
+	{
+		Version: 16,
+		Name:    "create_webhooks",
+		Up: `
+			CREATE TABLE webhooks (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id),
+				url TEXT NOT NULL,
+				events TEXT NOT NULL,
+				secret TEXT NOT NULL,
+				created_at TEXT NOT NULL
+			);
+			CREATE INDEX idx_webhooks_user ON webhooks(user_id, created_at, id);
+			CREATE TABLE webhook_deliveries (
+				id TEXT PRIMARY KEY,
+				webhook_id TEXT NOT NULL,
+				event_id TEXT NOT NULL,
+				event TEXT NOT NULL,
+				url TEXT NOT NULL,
+				payload TEXT NOT NULL,
+				signature TEXT NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt_at TEXT NOT NULL DEFAULT '',
+				response_status INTEGER NOT NULL DEFAULT 0,
+				error TEXT NOT NULL DEFAULT '',
+				created_at TEXT NOT NULL,
+				updated_at TEXT NOT NULL
+			);
+			CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at, id);
+			CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries(status, next_attempt_at);
+		`,
+		Down: `
+			DROP TABLE webhook_deliveries;
+			DROP TABLE webhooks;
+		`,
+	},
+	{
+		Version: 17,
+		Name:    "add_users_email_lower_index",
+		// Emails are unique regardless of case; fails if the table already
+		// holds two that differ only in case
+		Up: `
+			CREATE UNIQUE INDEX idx_users_email_lower ON users(LOWER(email));
+		`,
+		Down: `
+			DROP INDEX idx_users_email_lower;
+		`,
+	},
+	{
+		Version: 18,
+		Name:    "create_scheduler_state",
+		// started_at is recorded on the first scan, so tasks that were
+		// already past due before the scheduler ran are not flagged
+		Up: `
+			CREATE TABLE scheduler_state (
+				name TEXT PRIMARY KEY,
+				value TEXT NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE scheduler_state;
+		`,
+	},
+}
+
+// postgresMigrations is the ordered schema history for PostgreSQL databases.
+// Keep versions in step with sqliteMigrations.
+var postgresMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_users_and_tasks",
+		Up: `
+			CREATE TABLE IF NOT EXISTS users (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				email TEXT NOT NULL UNIQUE
+			);
+			CREATE TABLE IF NOT EXISTS tasks (
+				id TEXT PRIMARY KEY,
+				title TEXT NOT NULL,
+				description TEXT,
+				due_date TEXT,
+				status TEXT NOT NULL DEFAULT 'pending',
+				user_id TEXT NOT NULL REFERENCES users(id)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS tasks;
+			DROP TABLE IF EXISTS users;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "delete_orphaned_tasks",
+		Up: `
+			DELETE FROM tasks WHERE user_id NOT IN (SELECT id FROM users);
+		`,
+		// Orphaned tasks cannot be restored, so rolling back stops here
+	},
+	{
+		Version: 3,
+		Name:    "add_created_at",
+		Up: `
+			ALTER TABLE users ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+			UPDATE users SET created_at = to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"');
+			UPDATE tasks SET created_at = to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"');
+			CREATE INDEX idx_users_created_at ON users(created_at, id);
+			CREATE INDEX idx_tasks_user_created_at ON tasks(user_id, created_at, id);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_user_created_at;
+			DROP INDEX idx_users_created_at;
+			ALTER TABLE tasks DROP COLUMN created_at;
+			ALTER TABLE users DROP COLUMN created_at;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "normalize_due_dates",
+		// Like strftime in SQLite, values that are not dates are left alone
+		// and dates without an offset are taken to be in UTC
+		Up: `
+			SET LOCAL TIME ZONE 'UTC';
+			DO $$
+			DECLARE
+				t RECORD;
+			BEGIN
+				FOR t IN SELECT id, due_date FROM tasks WHERE due_date <> '' LOOP
+					BEGIN
+						UPDATE tasks SET due_date = to_char(t.due_date::timestamptz AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+							WHERE id = t.id;
+					EXCEPTION WHEN data_exception THEN
+						NULL;
+					END;
+				END LOOP;
+			END $$;
+			UPDATE tasks SET due_date = '' WHERE due_date IS NULL;
+			CREATE INDEX idx_tasks_user_due_date ON tasks(user_id, due_date, id);
+		`,
+		// Original time zone offsets are not kept, so only the index is dropped
+		Down: `
+			DROP INDEX idx_tasks_user_due_date;
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "add_task_search",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN search tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('simple', title), 'A') ||
+				setweight(to_tsvector('simple', COALESCE(description, '')), 'B')
+			) STORED;
+			CREATE INDEX idx_tasks_search ON tasks USING GIN (search);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_search;
+			ALTER TABLE tasks DROP COLUMN search;
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "add_updated_at",
+		Up: `
+			ALTER TABLE users ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+			UPDATE users SET updated_at = created_at;
+			UPDATE tasks SET updated_at = created_at;
+			CREATE INDEX idx_users_updated_at ON users(updated_at, id);
+			CREATE INDEX idx_tasks_user_updated_at ON tasks(user_id, updated_at, id);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_user_updated_at;
+			DROP INDEX idx_users_updated_at;
+			ALTER TABLE tasks DROP COLUMN updated_at;
+			ALTER TABLE users DROP COLUMN updated_at;
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "add_roles_and_api_tokens",
+		// Existing users become members, whoever registered first; the first
+		// admin is set up with the token command's -admin flag
+		Up: `
+			ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+			CREATE TABLE api_tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id),
+				name TEXT NOT NULL,
+				token_hash TEXT NOT NULL UNIQUE,
+				created_at TEXT NOT NULL
+			);
+			CREATE INDEX idx_api_tokens_user ON api_tokens(user_id, created_at, id);
+		`,
+		Down: `
+			DROP TABLE api_tokens;
+			ALTER TABLE users DROP COLUMN role;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "add_passwords_and_revoked_tokens",
+		Up: `
+			ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+			CREATE TABLE revoked_tokens (
+				jti TEXT PRIMARY KEY,
+				expires_at TEXT NOT NULL
+			);
+			CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+		`,
+		Down: `
+			DROP TABLE revoked_tokens;
+			ALTER TABLE users DROP COLUMN password_hash;
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "add_task_version",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+		`,
+		Down: `
+			ALTER TABLE tasks DROP COLUMN version;
+		`,
+	},
+	{
+		Version: 10,
+		Name:    "add_task_priority",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN priority INTEGER NOT NULL DEFAULT 2;
+			CREATE INDEX idx_tasks_user_priority ON tasks(user_id, priority, id);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_user_priority;
+			ALTER TABLE tasks DROP COLUMN priority;
+		`,
+	},
+	{
+		Version: 11,
+		Name:    "create_tags",
+		Up: `
+			CREATE TABLE tags (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id),
+				name TEXT NOT NULL,
+				created_at TEXT NOT NULL,
+				UNIQUE (user_id, name)
+			);
+			CREATE TABLE task_tags (
+				task_id TEXT NOT NULL REFERENCES tasks(id),
+				tag_id TEXT NOT NULL REFERENCES tags(id),
+				PRIMARY KEY (task_id, tag_id)
+			);
+			CREATE INDEX idx_task_tags_tag ON task_tags(tag_id, task_id);
+		`,
+		Down: `
+			DROP TABLE task_tags;
+			DROP TABLE tags;
+		`,
+	},
+	{
+		Version: 12,
+		Name:    "add_task_parent",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+			CREATE INDEX idx_tasks_parent ON tasks(parent_id);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_parent;
+			ALTER TABLE tasks DROP COLUMN parent_id;
+		`,
+	},
+	{
+		Version: 13,
+		Name:    "create_task_dependencies",
+		Up: `
+			CREATE TABLE task_dependencies (
+				task_id TEXT NOT NULL REFERENCES tasks(id),
+				blocker_id TEXT NOT NULL REFERENCES tasks(id),
+				created_at TEXT NOT NULL,
+				PRIMARY KEY (task_id, blocker_id)
+			);
+			CREATE INDEX idx_task_dependencies_blocker ON task_dependencies(blocker_id, task_id);
+		`,
+		Down: `
+			DROP TABLE task_dependencies;
+		`,
+	},
+	{
+		Version: 14,
+		Name:    "add_task_recurrence",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN series_id TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN occurrence INTEGER NOT NULL DEFAULT 0;
+			CREATE INDEX idx_tasks_series ON tasks(series_id, occurrence);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_series;
+			ALTER TABLE tasks DROP COLUMN occurrence;
+			ALTER TABLE tasks DROP COLUMN series_id;
+			ALTER TABLE tasks DROP COLUMN recurrence;
+		`,
+	},
+	{
+		Version: 15,
+		Name:    "add_task_reminders",
+		Up: `
+			ALTER TABLE tasks ADD COLUMN reminders TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN next_reminder_at TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tasks ADD COLUMN overdue_at TEXT NOT NULL DEFAULT '';
+			CREATE INDEX idx_tasks_next_reminder ON tasks(next_reminder_at);
+			CREATE INDEX idx_tasks_overdue ON tasks(overdue_at, due_date);
+		`,
+		Down: `
+			DROP INDEX idx_tasks_overdue;
+			DROP INDEX idx_tasks_next_reminder;
+			ALTER TABLE tasks DROP COLUMN overdue_at;
+			ALTER TABLE tasks DROP COLUMN next_reminder_at;
+			ALTER TABLE tasks DROP COLUMN reminders;
+		`,
+	},
+	{
+		Version: 16,
+		Name:    "create_webhooks",
+		Up: `
+			CREATE TABLE webhooks (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id),
+				url TEXT NOT NULL,
+				events TEXT NOT NULL,
+				secret TEXT NOT NULL,
+				created_at TEXT NOT NULL
+			);
+			CREATE INDEX idx_webhooks_user ON webhooks(user_id, created_at, id);
+			CREATE TABLE webhook_deliveries (
+				id TEXT PRIMARY KEY,
+				webhook_id TEXT NOT NULL,
+				event_id TEXT NOT NULL,
+				event TEXT NOT NULL,
+				url TEXT NOT NULL,
+				payload TEXT NOT NULL,
+				signature TEXT NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt_at TEXT NOT NULL DEFAULT '',
+				response_status INTEGER NOT NULL DEFAULT 0,
+				error TEXT NOT NULL DEFAULT '',
+				created_at TEXT NOT NULL,
+				updated_at TEXT NOT NULL
+			);
+			CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at, id);
+			CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries(status, next_attempt_at);
+		`,
+		Down: `
+			DROP TABLE webhook_deliveries;
+			DROP TABLE webhooks;
+		`,
+	},
+	{
+		Version: 17,
+		Name:    "add_users_email_lower_index",
+		// Emails are unique regardless of case; fails if the table already
+		// holds two that differ only in case
+		Up: `
+			CREATE UNIQUE INDEX idx_users_email_lower ON users(LOWER(email));
+		`,
+		Down: `
+			DROP INDEX idx_users_email_lower;
+		`,
+	},
+	{
+		Version: 18,
+		Name:    "create_scheduler_state",
+		// started_at is recorded on the first scan, so tasks that were
+		// already past due before the scheduler ran are not flagged
+		Up: `
+			CREATE TABLE scheduler_state (
+				name TEXT PRIMARY KEY,
+				value TEXT NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE scheduler_state;
+		`,
+	},
+}
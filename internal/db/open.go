@@ -0,0 +1,37 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+func isPostgresDSN(dataSourceName string) bool {
+	return strings.HasPrefix(dataSourceName, "postgres://") || strings.HasPrefix(dataSourceName, "postgresql://")
+}
+
+// MemoryDSN selects the non-persistent MemoryDB in Open
+const MemoryDSN = "memory://"
+
+// Open picks the DB implementation from the data source name: postgres:// and
+// postgresql:// URLs connect to PostgreSQL, memory:// keeps everything in
+// process memory, and anything else is a SQLite file
+func Open(dataSourceName string) (DB, error) {
+	if dataSourceName == MemoryDSN {
+		return NewMemoryDB(), nil
+	}
+	if isPostgresDSN(dataSourceName) {
+		return NewPostgresDB(dataSourceName)
+	}
+	return NewSQLiteDB(dataSourceName)
+}
+
+// OpenMigrator is like Open but returns a Migrator for the database instead
+func OpenMigrator(dataSourceName string) (*Migrator, error) {
+	if dataSourceName == MemoryDSN {
+		return nil, fmt.Errorf("memory databases have no schema to migrate")
+	}
+	if isPostgresDSN(dataSourceName) {
+		return OpenPostgresMigrator(dataSourceName)
+	}
+	return OpenSQLiteMigrator(dataSourceName)
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"time"
+
+	"task-manager/internal/model"
+)
+
+const (
+	// DefaultPageSize is used when a query does not set a limit
+	DefaultPageSize = 50
+	// MaxPageSize caps the limit a query may ask for
+	MaxPageSize = 200
+)
+
+// timestampLayout has a fixed width so that stored timestamps sort correctly as text
+const timestampLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+func now() string {
+	return time.Now().UTC().Format(timestampLayout)
+}
+
+// TaskSortFields lists the columns tasks can be ordered by
+var TaskSortFields = []string{"created_at", "updated_at", "due_date", "title", "status", "priority"}
+
+// UserSortFields lists the columns users can be ordered by
+var UserSortFields = []string{"created_at", "updated_at", "name", "email"}
+
+// DeliverySortFields lists the columns webhook deliveries can be ordered by
+var DeliverySortFields = []string{"created_at", "updated_at"}
+
+// Page selects the order and window of a list query. Results are ordered by
+// Sort, then by id, and NextCursor values continue from where the previous
+// page ended.
+type Page struct {
+	Sort   string
+	Desc   bool
+	Limit  int
+	Cursor string
+}
+
+// cursor is the decoded form of the opaque pagination token: the sort key and
+// id of the last row on the previous page
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// normalize fills in defaults and decodes the cursor, checking that it was
+// issued for the same ordering
+func (p Page) normalize(sortFields []string) (Page, *cursor, error) {
+	if p.Sort == "" {
+		p.Sort = "created_at"
+	}
+	if !slices.Contains(sortFields, p.Sort) {
+		return p, nil, ErrInvalidSort
+	}
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageSize
+	}
+	if p.Limit > MaxPageSize {
+		p.Limit = MaxPageSize
+	}
+	if p.Cursor == "" {
+		return p, nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return p, nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != p.Sort || c.Desc != p.Desc {
+		return p, nil, ErrInvalidCursor
+	}
+	return p, &c, nil
+}
+
+// after reports whether a row with the given sort value and id comes after
+// the cursor in the page's order
+func (p Page) after(c *cursor, value, id string) bool {
+	if c == nil {
+		return true
+	}
+	if value == c.Value {
+		return id > c.ID
+	}
+	return (value > c.Value) != p.Desc
+}
+
+// less orders two rows by sort value, then id
+func (p Page) less(valueA, idA, valueB, idB string) bool {
+	if valueA == valueB {
+		return idA < idB
+	}
+	return (valueA < valueB) != p.Desc
+}
+
+// nextPage trims the extra row fetched beyond the limit and, if there was
+// one, returns the cursor that continues after the last row kept
+func nextPage[T any](p Page, items []T, key func(item T, sort string) (value, id string)) ([]T, string) {
+	if len(items) <= p.Limit {
+		return items, ""
+	}
+	items = items[:p.Limit]
+	value, id := key(items[len(items)-1], p.Sort)
+	return items, encodeCursor(cursor{Sort: p.Sort, Desc: p.Desc, Value: value, ID: id})
+}
+
+// paginate applies a page to rows held in memory, mirroring what
+// pageClause and nextPage do in SQL
+func paginate[T any](p Page, after *cursor, items []T, key func(item T, sort string) (value, id string)) ([]T, string) {
+	slices.SortFunc(items, func(a, b T) int {
+		va, ida := key(a, p.Sort)
+		vb, idb := key(b, p.Sort)
+		if p.less(va, ida, vb, idb) {
+			return -1
+		}
+		if p.less(vb, idb, va, ida) {
+			return 1
+		}
+		return 0
+	})
+	kept := []T{}
+	for _, item := range items {
+		value, id := key(item, p.Sort)
+		if !p.after(after, value, id) {
+			continue
+		}
+		kept = append(kept, item)
+		if len(kept) > p.Limit {
+			break
+		}
+	}
+	return nextPage(p, kept, key)
+}
+
+func taskSortKey(t model.Task, sort string) (string, string) {
+	switch sort {
+	case "updated_at":
+		return t.UpdatedAt, t.ID
+	case "due_date":
+		return t.DueDate, t.ID
+	case "title":
+		return t.Title, t.ID
+	case "status":
+		return t.Status, t.ID
+	case "priority":
+		return strconv.Itoa(priorityRank(t.Priority)), t.ID
+	default:
+		return t.CreatedAt, t.ID
+	}
+}
+
+func userSortKey(u model.User, sort string) (string, string) {
+	switch sort {
+	case "updated_at":
+		return u.UpdatedAt, u.ID
+	case "name":
+		return u.Name, u.ID
+	case "email":
+		return u.Email, u.ID
+	default:
+		return u.CreatedAt, u.ID
+	}
+}
+
+func deliverySortKey(d model.WebhookDelivery, sort string) (string, string) {
+	if sort == "updated_at" {
+		return d.UpdatedAt, d.ID
+	}
+	return d.CreatedAt, d.ID
+}
@@ -0,0 +1,270 @@
+package db
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"task-manager/internal/model"
+)
+
+// TaskQuery filters and pages the tasks returned by ListTasks. Zero-valued
+// fields do not filter; all set fields must match.
+type TaskQuery struct {
+	// Statuses keeps tasks whose status is any of the given values
+	Statuses []string
+	// ExcludeStatuses drops tasks whose status is any of the given values
+	ExcludeStatuses []string
+	// Priorities keeps tasks whose priority is any of the given values
+	Priorities []string
+	// Tags keeps tasks with any of the given tags, or with all of them if
+	// AllTags is set
+	Tags    []string
+	AllTags bool
+	// ParentID keeps the subtasks of the given task
+	ParentID string
+	// SeriesID keeps the occurrences of the given recurring task
+	SeriesID string
+	// DueBefore and DueAfter are exclusive RFC3339 bounds on the due date;
+	// tasks without a due date never match them
+	DueBefore string
+	DueAfter  string
+	// Text is matched case-insensitively against the title and description
+	Text string
+	// UpdatedSince is an inclusive RFC3339 lower bound on the last update
+	UpdatedSince string
+	Page
+}
+
+// dueDateLayout is how due dates are stored: RFC3339 in UTC, so that they
+// compare correctly as text
+const dueDateLayout = "2006-01-02T15:04:05Z"
+
+// normalizeDueDate converts an RFC3339 time to dueDateLayout, leaving values
+// that do not parse untouched
+func normalizeDueDate(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.UTC().Format(dueDateLayout)
+}
+
+// normalizeTimestamp converts an RFC3339 time to timestampLayout, leaving
+// values that do not parse untouched
+func normalizeTimestamp(value string) string {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return value
+	}
+	return t.UTC().Format(timestampLayout)
+}
+
+// likePattern turns text into a LIKE pattern matching it as a substring
+func likePattern(text string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(text))
+	return "%" + escaped + "%"
+}
+
+// normalizePriority gives tasks without a priority the default one
+func normalizePriority(priority string) string {
+	if priority == "" {
+		return model.DefaultPriority
+	}
+	return priority
+}
+
+// newProgress computes the share of done subtasks
+func newProgress(total, done int) model.Progress {
+	return model.Progress{Total: total, Done: done, Percent: done * 100 / total}
+}
+
+// normalizeTags sorts tag names and drops duplicates; the result is never nil
+func normalizeTags(names []string) []string {
+	names = append([]string{}, names...)
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// normalizeReminders sorts reminder offsets from the largest down and drops
+// duplicates; the result is never nil
+func normalizeReminders(minutes []int) []int {
+	minutes = append([]int{}, minutes...)
+	slices.SortFunc(minutes, func(a, b int) int { return cmp.Compare(b, a) })
+	return slices.Compact(minutes)
+}
+
+// formatReminders is how reminder offsets are stored: comma-separated minutes
+func formatReminders(minutes []int) string {
+	fields := make([]string, len(minutes))
+	for i, m := range minutes {
+		fields[i] = strconv.Itoa(m)
+	}
+	return strings.Join(fields, ",")
+}
+
+// remindersColumn scans stored reminder offsets back into minutes
+type remindersColumn []int
+
+func (r *remindersColumn) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("invalid reminders %v", src)
+	}
+	minutes := []int{}
+	if text != "" {
+		for _, field := range strings.Split(text, ",") {
+			m, err := strconv.Atoi(field)
+			if err != nil {
+				return fmt.Errorf("invalid reminders %q", text)
+			}
+			minutes = append(minutes, m)
+		}
+	}
+	*r = minutes
+	return nil
+}
+
+// priorityRank is how a priority is stored: its position in
+// model.Priorities counting from 1, so that priorities sort by urgency.
+// Unknown priorities get 0 and match nothing.
+func priorityRank(priority string) int {
+	return slices.Index(model.Priorities, priority) + 1
+}
+
+// priorityColumn scans a stored priority rank back into its name
+type priorityColumn string
+
+func (p *priorityColumn) Scan(src any) error {
+	rank, ok := src.(int64)
+	if !ok || rank < 1 || rank > int64(len(model.Priorities)) {
+		return fmt.Errorf("invalid priority %v", src)
+	}
+	*p = priorityColumn(model.Priorities[rank-1])
+	return nil
+}
+
+// placeholders returns n comma-separated ? placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// where builds the SQL conditions and arguments selecting q's tasks for userID
+func (q TaskQuery) where(d dialect, userID string) ([]string, []any) {
+	where := []string{"user_id = ?"}
+	args := []any{userID}
+	if len(q.Statuses) > 0 {
+		where = append(where, "status IN ("+placeholders(len(q.Statuses))+")")
+		for _, status := range q.Statuses {
+			args = append(args, status)
+		}
+	}
+	if len(q.ExcludeStatuses) > 0 {
+		where = append(where, "status NOT IN ("+placeholders(len(q.ExcludeStatuses))+")")
+		for _, status := range q.ExcludeStatuses {
+			args = append(args, status)
+		}
+	}
+	if len(q.Priorities) > 0 {
+		where = append(where, "priority IN ("+placeholders(len(q.Priorities))+")")
+		for _, priority := range q.Priorities {
+			args = append(args, priorityRank(priority))
+		}
+	}
+	if q.ParentID != "" {
+		where = append(where, "parent_id = ?")
+		args = append(args, q.ParentID)
+	}
+	if q.SeriesID != "" {
+		where = append(where, "series_id = ?")
+		args = append(args, q.SeriesID)
+	}
+	if len(q.Tags) > 0 {
+		tags := normalizeTags(q.Tags)
+		cond := "id IN (SELECT tt.task_id FROM task_tags tt JOIN tags g ON g.id = tt.tag_id WHERE g.name IN (" + placeholders(len(tags)) + ")"
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+		if q.AllTags {
+			cond += " GROUP BY tt.task_id HAVING COUNT(*) = ?"
+			args = append(args, len(tags))
+		}
+		where = append(where, cond+")")
+	}
+	if q.DueBefore != "" {
+		where = append(where, "due_date <> '' AND due_date < ?")
+		args = append(args, normalizeDueDate(q.DueBefore))
+	}
+	if q.DueAfter != "" {
+		where = append(where, "due_date <> '' AND due_date > ?")
+		args = append(args, normalizeDueDate(q.DueAfter))
+	}
+	if q.UpdatedSince != "" {
+		where = append(where, "updated_at >= ?")
+		args = append(args, normalizeTimestamp(q.UpdatedSince))
+	}
+	if q.Text != "" {
+		where = append(where, "("+d.lower("title")+` LIKE ? ESCAPE '\' OR `+d.lower("COALESCE(description, '')")+` LIKE ? ESCAPE '\')`)
+		pattern := likePattern(q.Text)
+		args = append(args, pattern, pattern)
+	}
+	return where, args
+}
+
+// matches is the in-memory equivalent of where
+func (q TaskQuery) matches(userID string, t model.Task) bool {
+	if t.UserID != userID {
+		return false
+	}
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, t.Status) {
+		return false
+	}
+	if slices.Contains(q.ExcludeStatuses, t.Status) {
+		return false
+	}
+	if len(q.Priorities) > 0 && !slices.Contains(q.Priorities, t.Priority) {
+		return false
+	}
+	if q.ParentID != "" && t.ParentID != q.ParentID {
+		return false
+	}
+	if q.SeriesID != "" && t.SeriesID != q.SeriesID {
+		return false
+	}
+	if len(q.Tags) > 0 {
+		tags := normalizeTags(q.Tags)
+		matched := 0
+		for _, tag := range tags {
+			if slices.Contains(t.Tags, tag) {
+				matched++
+			}
+		}
+		if matched == 0 || q.AllTags && matched < len(tags) {
+			return false
+		}
+	}
+	if q.DueBefore != "" && (t.DueDate == "" || t.DueDate >= normalizeDueDate(q.DueBefore)) {
+		return false
+	}
+	if q.DueAfter != "" && (t.DueDate == "" || t.DueDate <= normalizeDueDate(q.DueAfter)) {
+		return false
+	}
+	if q.UpdatedSince != "" && t.UpdatedAt < normalizeTimestamp(q.UpdatedSince) {
+		return false
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(t.Title), text) && !strings.Contains(strings.ToLower(t.Description), text) {
+			return false
+		}
+	}
+	return true
+}
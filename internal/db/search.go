@@ -0,0 +1,192 @@
+package db
+
+import (
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+
+	"task-manager/internal/model"
+)
+
+const (
+	// highlightStart and highlightEnd surround matched terms in search snippets
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+	// markStart and markEnd are what the databases surround matched terms
+	// with; markup turns them into the tags once the text is escaped
+	markStart = "\x02"
+	markEnd   = "\x03"
+	// snippetWords is roughly how many words of a description a snippet shows
+	snippetWords = 12
+	// titleWeight makes title matches count more than description matches
+	titleWeight = 10.0
+)
+
+// DefaultSearchLimit is the number of search results returned when no limit is given
+const DefaultSearchLimit = 20
+
+func searchLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultSearchLimit
+	}
+	return min(limit, MaxPageSize)
+}
+
+// SearchTerms splits a free-text query into lower-cased words; each word
+// matches any word it is a prefix of
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+type word struct {
+	start, end int
+}
+
+func splitWords(text string) []word {
+	var words []word
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			words = append(words, word{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{start, len(text)})
+	}
+	return words
+}
+
+func matchesTerm(w string, terms []string) bool {
+	w = strings.ToLower(w)
+	return slices.ContainsFunc(terms, func(term string) bool { return strings.HasPrefix(w, term) })
+}
+
+func allTermsMatch(words, terms []string) bool {
+	for _, term := range terms {
+		if !slices.ContainsFunc(words, func(w string) bool { return strings.HasPrefix(w, term) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// markup HTML-escapes a snippet marked with markStart and markEnd and turns
+// the marks into highlightStart and highlightEnd, leaving out any that would
+// not pair up
+func markup(snippet string) string {
+	var b strings.Builder
+	open := false
+	for {
+		i := strings.IndexAny(snippet, markStart+markEnd)
+		if i < 0 {
+			break
+		}
+		b.WriteString(html.EscapeString(snippet[:i]))
+		switch {
+		case snippet[i:i+1] == markStart && !open:
+			b.WriteString(highlightStart)
+			open = true
+		case snippet[i:i+1] == markEnd && open:
+			b.WriteString(highlightEnd)
+			open = false
+		}
+		snippet = snippet[i+1:]
+	}
+	b.WriteString(html.EscapeString(snippet))
+	if open {
+		b.WriteString(highlightEnd)
+	}
+	return b.String()
+}
+
+// highlight HTML-escapes text and marks the matched words in it. When
+// maxWords is positive only a window of that many words around the first
+// match is kept.
+func highlight(text string, terms []string, maxWords int) (string, int) {
+	words := splitWords(text)
+	first, hits := -1, 0
+	for i, w := range words {
+		if matchesTerm(text[w.start:w.end], terms) {
+			hits++
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	lo, hi := 0, len(words)
+	if maxWords > 0 && len(words) > maxWords {
+		lo = max(0, first-maxWords/2)
+		hi = min(len(words), lo+maxWords)
+		lo = max(0, hi-maxWords)
+	}
+	if len(words) == 0 {
+		return html.EscapeString(text), 0
+	}
+
+	var b strings.Builder
+	start := 0
+	if lo > 0 {
+		b.WriteString("…")
+		start = words[lo].start
+	}
+	end := len(text)
+	if hi < len(words) {
+		end = words[hi-1].end
+	}
+	pos := start
+	for _, w := range words[lo:hi] {
+		b.WriteString(html.EscapeString(text[pos:w.start]))
+		if matchesTerm(text[w.start:w.end], terms) {
+			b.WriteString(highlightStart + html.EscapeString(text[w.start:w.end]) + highlightEnd)
+		} else {
+			b.WriteString(html.EscapeString(text[w.start:w.end]))
+		}
+		pos = w.end
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if hi < len(words) {
+		b.WriteString("…")
+	}
+	return b.String(), hits
+}
+
+// rankTasks is the portable search implementation used by MemoryDB. Every
+// term must prefix-match a word in the title or description; title matches
+// weigh more.
+func rankTasks(tasks []model.Task, terms []string, limit int) []model.TaskSearchResult {
+	results := []model.TaskSearchResult{}
+	for _, t := range tasks {
+		if !allTermsMatch(SearchTerms(t.Title+" "+t.Description), terms) {
+			continue
+		}
+		title, titleHits := highlight(t.Title, terms, 0)
+		description, descriptionHits := highlight(t.Description, terms, snippetWords)
+		results = append(results, model.TaskSearchResult{
+			Task:               t,
+			Score:              titleWeight*float64(titleHits) + float64(descriptionHits),
+			TitleSnippet:       title,
+			DescriptionSnippet: description,
+		})
+	}
+	slices.SortStableFunc(results, func(a, b model.TaskSearchResult) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
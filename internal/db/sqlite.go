@@ -0,0 +1,102 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLiteDB is the DB implementation backed by a SQLite database file
+type SQLiteDB struct {
+	*sqlDB
+}
+
+type sqliteDialect struct {
+	// fts5 is set when the driver has FTS5, which search uses if it can
+	fts5 bool
+}
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+// lower uses lower_unicode, as the built-in LOWER only folds ASCII letters
+func (sqliteDialect) lower(expr string) string { return "lower_unicode(" + expr + ")" }
+
+func (sqliteDialect) isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (sqliteDialect) isForeignKeyViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+}
+
+// sqliteOptions are set on every connection. WAL lets reads go on while a
+// transaction writes, the busy timeout makes a connection wait up to 5s for
+// a lock instead of failing with "database is locked", and immediate
+// transactions take the write lock when they begin, so two transactions
+// cannot both read and then deadlock on upgrading to write.
+const sqliteOptions = "_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+
+// sqliteDriver is the driver NewSQLiteDB opens databases with. It adds
+// lower_unicode, a LOWER that folds every letter, to each connection; the
+// built-in one is left alone so the expression index on users' emails keeps
+// matching what other SQLite clients compute.
+const sqliteDriver = "sqlite3_tasks"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("lower_unicode", strings.ToLower, true)
+		},
+	})
+}
+
+// withOptions adds go-sqlite3 connection options to a data source name
+func withOptions(dataSourceName, options string) string {
+	if strings.Contains(dataSourceName, "?") {
+		return dataSourceName + "&" + options
+	}
+	return dataSourceName + "?" + options
+}
+
+// NewSQLiteDB initializes a new SQLiteDB instance
+func NewSQLiteDB(dataSourceName string) (DB, error) {
+	// Foreign keys are enforced too, which SQLite leaves off by default
+	conn, err := sql.Open(sqliteDriver, withOptions(dataSourceName, sqliteOptions+"&_foreign_keys=on"))
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to ":memory:" is a separate database, so keep exactly one
+	if strings.Contains(dataSourceName, ":memory:") {
+		conn.SetMaxOpenConns(1)
+	}
+	if _, err := NewMigrator(conn, sqliteMigrations).Up(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error migrating database: %w", err)
+	}
+	fts5, err := hasFTS5(conn)
+	if err == nil {
+		err = syncSearchIndex(conn, fts5)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error setting up the search index: %w", err)
+	}
+
+	return &SQLiteDB{&sqlDB{conn: conn, dialect: sqliteDialect{fts5: fts5}}}, nil
+}
+
+// OpenSQLiteMigrator opens a SQLite database for schema management without
+// applying any pending migrations
+func OpenSQLiteMigrator(dataSourceName string) (*Migrator, error) {
+	conn, err := sql.Open("sqlite3", withOptions(dataSourceName, sqliteOptions))
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(conn, sqliteMigrations), nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"unicode"
+
+	"task-manager/internal/model"
+)
+
+// hasFTS5 reports whether FTS5 is compiled into the SQLite driver, which
+// go-sqlite3 only does with the sqlite_fts5 build tag
+func hasFTS5(conn *sql.DB) (bool, error) {
+	var enabled bool
+	err := conn.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	return enabled, err
+}
+
+const (
+	// dropSearchTriggers stops tasks_fts from being kept up to date
+	dropSearchTriggers = `
+		DROP TRIGGER IF EXISTS tasks_fts_update;
+		DROP TRIGGER IF EXISTS tasks_fts_delete;
+		DROP TRIGGER IF EXISTS tasks_fts_insert;
+	`
+	// buildSearchIndex fills tasks_fts from scratch and adds the triggers
+	// that keep it up to date
+	buildSearchIndex = `
+		CREATE VIRTUAL TABLE IF NOT EXISTS tasks_fts USING fts5(title, description, prefix = '2 3');
+		DELETE FROM tasks_fts;
+		DELETE FROM task_search_ids;
+		CREATE TRIGGER tasks_fts_insert AFTER INSERT ON tasks BEGIN
+			INSERT INTO task_search_ids (task_id) VALUES (new.id);
+			INSERT INTO tasks_fts (rowid, title, description)
+				SELECT id, new.title, new.description FROM task_search_ids WHERE task_id = new.id;
+		END;
+		CREATE TRIGGER tasks_fts_delete AFTER DELETE ON tasks BEGIN
+			DELETE FROM tasks_fts WHERE rowid = (SELECT id FROM task_search_ids WHERE task_id = old.id);
+			DELETE FROM task_search_ids WHERE task_id = old.id;
+		END;
+		CREATE TRIGGER tasks_fts_update AFTER UPDATE OF title, description ON tasks BEGIN
+			UPDATE tasks_fts SET title = new.title, description = new.description
+				WHERE rowid = (SELECT id FROM task_search_ids WHERE task_id = new.id);
+		END;
+		INSERT INTO task_search_ids (task_id) SELECT id FROM tasks;
+		INSERT INTO tasks_fts (rowid, title, description)
+			SELECT k.id, t.title, t.description FROM tasks t JOIN task_search_ids k ON k.task_id = t.id;
+	`
+)
+
+// syncSearchIndex sets up the tasks_fts index, which is not part of the
+// migrations as builds without FTS5 cannot create it. With FTS5 the index
+// is built unless its triggers already keep it up to date. Without FTS5 the
+// triggers are dropped, so that changing tasks does not need FTS5; the
+// index goes stale and is built afresh once FTS5 is back.
+func syncSearchIndex(conn *sql.DB, fts5 bool) error {
+	var triggers int
+	err := conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'trigger' AND name IN ('tasks_fts_insert', 'tasks_fts_delete', 'tasks_fts_update')`).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+	if (fts5 && triggers == 3) || (!fts5 && triggers == 0) {
+		return nil
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	statements := dropSearchTriggers
+	if fts5 {
+		statements += buildSearchIndex
+	}
+	if _, err := tx.Exec(statements); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ftsQuery turns search terms into an FTS5 query requiring every term as a prefix
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (d sqliteDialect) searchTasks(ctx context.Context, s *sqlDB, userID string, terms []string, limit int) ([]model.TaskSearchResult, error) {
+	if !d.fts5 {
+		return searchWithoutFTS5(ctx, s, userID, terms, limit)
+	}
+	rows, err := s.query(ctx, `
+		SELECT t.id, t.title, t.description, t.due_date, t.status, t.priority, t.parent_id, t.recurrence, t.series_id, t.occurrence, t.reminders, t.next_reminder_at, t.overdue_at, t.user_id, t.created_at, t.updated_at, t.version,
+			-bm25(tasks_fts, ?, 1.0),
+			highlight(tasks_fts, 0, ?, ?),
+			snippet(tasks_fts, 1, ?, ?, '…', ?)
+		FROM tasks_fts
+			JOIN task_search_ids k ON k.id = tasks_fts.rowid
+			JOIN tasks t ON t.id = k.task_id
+		WHERE tasks_fts MATCH ? AND t.user_id = ?
+		ORDER BY bm25(tasks_fts, ?, 1.0), t.id
+		LIMIT ?`,
+		titleWeight, markStart, markEnd, markStart, markEnd, snippetWords,
+		ftsQuery(terms), userID, titleWeight, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []model.TaskSearchResult{}
+	for rows.Next() {
+		var r model.TaskSearchResult
+		var description sql.NullString
+		err := rows.Scan(append(taskFields(&r.Task), &r.Score, &r.TitleSnippet, &description)...)
+		if err != nil {
+			return nil, err
+		}
+		r.TitleSnippet, r.DescriptionSnippet = markup(r.TitleSnippet), markup(description.String)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// searchWithoutFTS5 narrows a user's tasks down with LIKE and ranks them as
+// MemoryDB does. SQLite only folds the case of ASCII letters, so terms with
+// other letters are left to rankTasks.
+func searchWithoutFTS5(ctx context.Context, s *sqlDB, userID string, terms []string, limit int) ([]model.TaskSearchResult, error) {
+	where := []string{"user_id = ?"}
+	args := []any{userID}
+	for _, term := range terms {
+		if strings.IndexFunc(term, func(r rune) bool { return r > unicode.MaxASCII }) >= 0 {
+			continue
+		}
+		// Terms are letters and digits only, so they hold no LIKE wildcards
+		where = append(where, "(title LIKE ? OR COALESCE(description, '') LIKE ?)")
+		args = append(args, "%"+term+"%", "%"+term+"%")
+	}
+	rows, err := s.query(ctx, "SELECT "+taskColumns+" FROM tasks WHERE "+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []model.Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rankTasks(tasks, terms, limit), nil
+}
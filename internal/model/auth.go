@@ -0,0 +1,37 @@
+package model
+
+// Roles a user can have. Admins may act on behalf of any user and manage
+// accounts; everyone registers as a member, who manages their own tasks.
+// Read-only users can only view them.
+const (
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleReadOnly = "read_only"
+)
+
+// IsValidRole reports whether role is one of the roles above
+func IsValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleMember || role == RoleReadOnly
+}
+
+// APIToken is a long-lived credential that authenticates requests as its
+// user. Only a hash of the secret is stored, so the secret itself is shown
+// once, when the token is created.
+type APIToken struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Session is the pair of signed tokens issued on login. The access token
+// authenticates requests until it expires; the refresh token is exchanged
+// for a new pair.
+type Session struct {
+	UserID       string `json:"user_id"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int `json:"expires_in"`
+}
@@ -1,16 +1,110 @@
 package model
 
+// Statuses of the default workflow; deployments may configure others
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusDone       = "done"
+)
+
+// Task priorities, from least to most pressing
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// Priorities lists every priority from least to most pressing
+var Priorities = []string{PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+// DefaultPriority is given to tasks that do not set one
+const DefaultPriority = PriorityMedium
+
 type Task struct {
 	ID          string `json:"id"`
 	Title       string `json:"title"`
 	Description string `json:"description"`
 	DueDate     string `json:"due_date"`
 	Status      string `json:"status"`
-	UserID      string `json:"user_id"`
+	Priority    string `json:"priority"`
+	// Tags are the names of the owner's tags attached to the task, sorted
+	Tags []string `json:"tags"`
+	// ParentID is the task this one is a subtask of, or empty for top-level tasks
+	ParentID string `json:"parent_id"`
+	// Recurrence is an iCalendar RRULE such as "FREQ=WEEKLY;BYDAY=MO", or
+	// empty for one-off tasks. Finishing a recurring task creates its next
+	// occurrence.
+	Recurrence string `json:"recurrence"`
+	// SeriesID is shared by the occurrences of a recurring task, which are
+	// numbered from 1 by Occurrence
+	SeriesID   string `json:"series_id"`
+	Occurrence int    `json:"occurrence"`
+	// Reminders are how many minutes before the due date reminders are sent,
+	// largest first
+	Reminders []int `json:"reminders"`
+	// NextReminderAt is when the next reminder is due, or empty once every
+	// reminder has been sent. It is reset when the due date or the reminders
+	// change.
+	NextReminderAt string `json:"next_reminder_at"`
+	// OverdueAt is when the task was found past its due date without being
+	// finished, or empty. Changing the due date clears it.
+	OverdueAt string `json:"overdue_at"`
+	UserID    string `json:"user_id"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	// Version starts at 1 and goes up by one with every update
+	Version int `json:"version"`
+	// Progress sums up the subtasks of the task; it is computed on read and
+	// only present for tasks that have subtasks
+	Progress *Progress `json:"progress,omitempty"`
+	// Blocked is computed on read: it is set while a task the task depends on
+	// is not finished
+	Blocked bool `json:"blocked"`
+}
+
+// Progress counts the subtasks of a task and how many of them are finished
+type Progress struct {
+	Total int `json:"total"`
+	Done  int `json:"done"`
+	// Percent is the share of finished subtasks, rounded down
+	Percent int `json:"percent"`
+}
+
+// Dependency records that a task cannot start until its blocker is finished.
+// Both tasks belong to the same user.
+type Dependency struct {
+	TaskID    string `json:"task_id"`
+	BlockerID string `json:"blocker_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Tag is a label a user can attach to any number of their tasks. Names are
+// unique per user.
+type Tag struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+// TaskSearchResult is a task matched by a full-text search. The snippets
+// wrap matched words in <mark> tags.
+type TaskSearchResult struct {
+	Task
+	Score              float64 `json:"score"`
+	TitleSnippet       string  `json:"title_snippet"`
+	DescriptionSnippet string  `json:"description_snippet"`
 }
 
 type User struct {
 	ID    string `json:"id"`
 	Name  string `json:"name"`
 	Email string `json:"email"`
+	Role  string `json:"role"`
+	// PasswordHash is never serialized; users without one cannot log in
+	// with a password
+	PasswordHash string `json:"-"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
 }
@@ -0,0 +1,61 @@
+package model
+
+import "encoding/json"
+
+// Types of the events webhooks can subscribe to
+const (
+	EventTaskCreated  = "task.created"
+	EventTaskUpdated  = "task.updated"
+	EventTaskDeleted  = "task.deleted"
+	EventTaskReminder = "task.reminder"
+	EventTaskOverdue  = "task.overdue"
+	EventUserDeleted  = "user.deleted"
+)
+
+// WebhookEvents lists every event type
+var WebhookEvents = []string{EventTaskCreated, EventTaskUpdated, EventTaskDeleted, EventTaskReminder, EventTaskOverdue, EventUserDeleted}
+
+// Webhook sends the events of one user's account to a URL. The secret signs
+// the deliveries; it is only shown when the webhook is created.
+type Webhook struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	URL    string `json:"url"`
+	// Events are the event types the webhook receives, sorted
+	Events    []string `json:"events"`
+	Secret    string   `json:"-"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// Statuses of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event on its way to one webhook. Pending
+// deliveries are retried until they succeed or run out of attempts.
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	// EventID is shared by the deliveries of the same event to different
+	// webhooks
+	EventID string `json:"event_id"`
+	Event   string `json:"event"`
+	URL     string `json:"url"`
+	// Payload is the request body, and Signature its HMAC-SHA256 under the
+	// webhook's secret
+	Payload   json.RawMessage `json:"payload"`
+	Signature string          `json:"-"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is tried next
+	NextAttemptAt string `json:"next_attempt_at"`
+	// ResponseStatus is the HTTP status of the last attempt, or 0 if the
+	// receiver could not be reached
+	ResponseStatus int    `json:"response_status"`
+	Error          string `json:"error"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
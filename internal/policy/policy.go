@@ -0,0 +1,48 @@
+// Package policy decides which actions a user may take on which resources.
+// Handlers consult it after authentication; it does no I/O of its own.
+package policy
+
+import (
+	"slices"
+
+	"task-manager/internal/model"
+)
+
+// Action is something a user can attempt through the API
+type Action string
+
+const (
+	// ReadUser and ReadTasks view a user's profile and tasks
+	ReadUser  Action = "user:read"
+	ReadTasks Action = "tasks:read"
+	// WriteTasks creates, changes and deletes a user's tasks and tags
+	WriteTasks Action = "tasks:write"
+	// ManageTokens creates, lists and revokes a user's API tokens
+	ManageTokens Action = "tokens:manage"
+	// ManageWebhooks creates, lists and deletes a user's webhooks and reads
+	// their deliveries
+	ManageWebhooks Action = "webhooks:manage"
+	// ListUsers, DeleteUser and ChangeRole manage accounts
+	ListUsers  Action = "users:list"
+	DeleteUser Action = "users:delete"
+	ChangeRole Action = "users:role"
+)
+
+// ownActions lists what each non-admin role may do to their own account.
+// Admins may do everything to every account.
+var ownActions = map[string][]Action{
+	model.RoleMember:   {ReadUser, ReadTasks, WriteTasks, ManageTokens, ManageWebhooks},
+	model.RoleReadOnly: {ReadUser, ReadTasks, ManageTokens},
+}
+
+// Allowed reports whether actor may perform action on the account ownerID,
+// which is empty for actions that are not about a single account
+func Allowed(actor *model.User, action Action, ownerID string) bool {
+	if actor.Role == model.RoleAdmin {
+		return true
+	}
+	if ownerID == "" || ownerID != actor.ID {
+		return false
+	}
+	return slices.Contains(ownActions[actor.Role], action)
+}
@@ -0,0 +1,253 @@
+// Package recurrence computes the occurrences of recurring tasks from
+// iCalendar recurrence rules (RFC 5545, section 3.3.10). It supports the
+// parts chores need: FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL.
+// Occurrences are computed in UTC, like task due dates.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies a rule can repeat at
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxSteps bounds the search for the next occurrence of rules that never
+// match, such as the 31st of every other February
+const maxSteps = 1000
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Rule is a parsed recurrence rule
+type Rule struct {
+	Freq     string
+	Interval int
+	// ByDay limits daily and weekly rules to these days of the week
+	ByDay []time.Weekday
+	// ByMonthDay lists the days of the month of a monthly rule; negative
+	// days count from the end of the month, so -1 is its last day
+	ByMonthDay []int
+	// Count is the number of occurrences, or 0 for no limit
+	Count int
+	// Until is the last time an occurrence may fall on, or zero for no limit
+	Until time.Time
+}
+
+// Normalize turns a rule as users write it into the form it is stored in:
+// trimmed, upper case and without the optional "RRULE:" prefix
+func Normalize(rule string) string {
+	rule = strings.ToUpper(strings.TrimSpace(rule))
+	return strings.TrimSpace(strings.TrimPrefix(rule, "RRULE:"))
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=MO,TH"
+func Parse(rule string) (*Rule, error) {
+	r := &Rule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(Normalize(rule), ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: %q is not NAME=VALUE", ErrInvalidRule, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s is given twice", ErrInvalidRule, name)
+		}
+		seen[name] = true
+		var err error
+		switch name {
+		case "FREQ":
+			if !slices.Contains([]string{Daily, Weekly, Monthly, Yearly}, value) {
+				return nil, fmt.Errorf("%w: FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY", ErrInvalidRule)
+			}
+			r.Freq = value
+		case "INTERVAL":
+			r.Interval, err = parseNumber(name, value, 1, 1000)
+		case "COUNT":
+			r.Count, err = parseNumber(name, value, 1, 10000)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseWeekdays(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseMonthDays(value)
+		default:
+			return nil, fmt.Errorf("%w: %s is not supported", ErrInvalidRule, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case r.Freq == "":
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	case r.Count > 0 && !r.Until.IsZero():
+		return nil, fmt.Errorf("%w: COUNT and UNTIL cannot be combined", ErrInvalidRule)
+	case len(r.ByDay) > 0 && r.Freq != Daily && r.Freq != Weekly:
+		return nil, fmt.Errorf("%w: BYDAY needs FREQ=DAILY or FREQ=WEEKLY", ErrInvalidRule)
+	case len(r.ByMonthDay) > 0 && r.Freq != Monthly:
+		return nil, fmt.Errorf("%w: BYMONTHDAY needs FREQ=MONTHLY", ErrInvalidRule)
+	}
+	return r, nil
+}
+
+func parseNumber(name, value string, lowest, highest int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lowest || n > highest {
+		return 0, fmt.Errorf("%w: %s must be a number from %d to %d", ErrInvalidRule, name, lowest, highest)
+	}
+	return n, nil
+}
+
+// parseUntil accepts a date (20251231), which includes the whole day, or a
+// UTC date-time (20251231T170000Z)
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: UNTIL must be a date like 20251231 or a UTC time like 20251231T170000Z", ErrInvalidRule)
+}
+
+func parseWeekdays(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, name := range strings.Split(value, ",") {
+		day, ok := weekdays[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: BYDAY takes days such as MO,WE,FR", ErrInvalidRule)
+		}
+		if !slices.Contains(days, day) {
+			days = append(days, day)
+		}
+	}
+	// Weeks start on Monday
+	slices.SortFunc(days, func(a, b time.Weekday) int { return mondayFirst(a) - mondayFirst(b) })
+	return days, nil
+}
+
+func parseMonthDays(value string) ([]int, error) {
+	var days []int
+	for _, field := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(field)
+		if err != nil || day == 0 || day < -31 || day > 31 {
+			return nil, fmt.Errorf("%w: BYMONTHDAY takes days from 1 to 31 or -1 to -31", ErrInvalidRule)
+		}
+		if !slices.Contains(days, day) {
+			days = append(days, day)
+		}
+	}
+	return days, nil
+}
+
+// mondayFirst numbers the days of the week from Monday (0) to Sunday (6)
+func mondayFirst(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// Next returns the occurrence that follows prev, which is occurrence number
+// n (counting from 1) of the series. It reports false once the series has
+// ended.
+func (r *Rule) Next(prev time.Time, n int) (time.Time, bool) {
+	if r.Count > 0 && n >= r.Count {
+		return time.Time{}, false
+	}
+	prev = prev.UTC()
+	var next time.Time
+	var ok bool
+	switch r.Freq {
+	case Daily:
+		next, ok = r.nextDaily(prev)
+	case Weekly:
+		next, ok = r.nextWeekly(prev)
+	case Monthly:
+		next, ok = r.nextMonthly(prev)
+	case Yearly:
+		next, ok = r.nextYearly(prev)
+	}
+	if !ok || (!r.Until.IsZero() && next.After(r.Until)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func (r *Rule) nextDaily(prev time.Time) (time.Time, bool) {
+	next := prev
+	for range maxSteps {
+		next = next.AddDate(0, 0, r.Interval)
+		if len(r.ByDay) == 0 || slices.Contains(r.ByDay, next.Weekday()) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *Rule) nextWeekly(prev time.Time) (time.Time, bool) {
+	if len(r.ByDay) == 0 {
+		return prev.AddDate(0, 0, 7*r.Interval), true
+	}
+	// A later day of the same week, else the first day of the next week
+	// the rule is active in
+	today := mondayFirst(prev.Weekday())
+	for _, day := range r.ByDay {
+		if d := mondayFirst(day); d > today {
+			return prev.AddDate(0, 0, d-today), true
+		}
+	}
+	monday := prev.AddDate(0, 0, -today)
+	return monday.AddDate(0, 0, 7*r.Interval+mondayFirst(r.ByDay[0])), true
+}
+
+func (r *Rule) nextMonthly(prev time.Time) (time.Time, bool) {
+	days := r.ByMonthDay
+	if len(days) == 0 {
+		days = []int{prev.Day()}
+	}
+	hour, minute, second := prev.Clock()
+	for step := range maxSteps {
+		first := time.Date(prev.Year(), prev.Month()+time.Month(step*r.Interval), 1, hour, minute, second, prev.Nanosecond(), time.UTC)
+		length := first.AddDate(0, 1, -1).Day()
+		var candidates []time.Time
+		for _, day := range days {
+			if day < 0 {
+				day += length + 1
+			}
+			if day >= 1 && day <= length {
+				candidates = append(candidates, first.AddDate(0, 0, day-1))
+			}
+		}
+		slices.SortFunc(candidates, time.Time.Compare)
+		for _, c := range candidates {
+			if c.After(prev) {
+				return c, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *Rule) nextYearly(prev time.Time) (time.Time, bool) {
+	hour, minute, second := prev.Clock()
+	for step := 1; step <= maxSteps; step++ {
+		next := time.Date(prev.Year()+step*r.Interval, prev.Month(), prev.Day(), hour, minute, second, prev.Nanosecond(), time.UTC)
+		// Skip years without the date, such as February 29th in common years
+		if next.Day() == prev.Day() {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
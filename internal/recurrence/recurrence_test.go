@@ -0,0 +1,105 @@
+package recurrence_test
+
+import (
+	"testing"
+	"time"
+
+	"task-manager/internal/recurrence"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRecurrence(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Recurrence Suite")
+}
+
+func at(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	Expect(err).To(BeNil())
+	return t
+}
+
+var _ = Describe("Recurrence rules", func() {
+	It("should parse rules as users write them", func() {
+		rule, err := recurrence.Parse(" rrule:freq=weekly;interval=2;byday=fr,mo,fr ")
+		Expect(err).To(BeNil())
+		Expect(rule.Freq).To(Equal(recurrence.Weekly))
+		Expect(rule.Interval).To(Equal(2))
+		Expect(rule.ByDay).To(Equal([]time.Weekday{time.Monday, time.Friday}))
+	})
+
+	// Each occurrence is computed from the one before, starting at start,
+	// which is occurrence 1. ended says whether the series stops after the
+	// expected occurrences.
+	DescribeTable("Next",
+		func(rule, start string, ended bool, expected ...string) {
+			r, err := recurrence.Parse(rule)
+			Expect(err).To(BeNil())
+			prev := at(start)
+			for n, want := range expected {
+				next, ok := r.Next(prev, n+1)
+				Expect(ok).To(BeTrue(), want)
+				Expect(next).To(Equal(at(want)))
+				prev = next
+			}
+			_, ok := r.Next(prev, len(expected)+1)
+			Expect(ok).To(Equal(!ended))
+		},
+		Entry("daily", "FREQ=DAILY;INTERVAL=3", "2025-01-30T09:00:00Z", false,
+			"2025-02-02T09:00:00Z", "2025-02-05T09:00:00Z"),
+		Entry("daily on weekdays", "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", "2025-01-03T09:00:00Z", false,
+			"2025-01-06T09:00:00Z", "2025-01-07T09:00:00Z"),
+		Entry("weekly", "FREQ=WEEKLY", "2025-12-29T09:00:00Z", false,
+			"2026-01-05T09:00:00Z"),
+		Entry("weekly BYDAY wrapping into the next active week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "2025-01-06T09:00:00Z", false,
+			"2025-01-10T09:00:00Z", "2025-01-20T09:00:00Z", "2025-01-24T09:00:00Z", "2025-02-03T09:00:00Z"),
+		Entry("weekly BYDAY with Sunday as the last day of the week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,TU", "2025-01-07T09:00:00Z", false,
+			"2025-01-12T09:00:00Z", "2025-01-21T09:00:00Z", "2025-01-26T09:00:00Z"),
+		Entry("BYMONTHDAY=31 skipping short months", "FREQ=MONTHLY;BYMONTHDAY=31", "2025-01-31T09:00:00Z", false,
+			"2025-03-31T09:00:00Z", "2025-05-31T09:00:00Z", "2025-07-31T09:00:00Z", "2025-08-31T09:00:00Z"),
+		Entry("monthly on the 31st without BYMONTHDAY", "FREQ=MONTHLY", "2025-08-31T09:00:00Z", false,
+			"2025-10-31T09:00:00Z", "2025-12-31T09:00:00Z"),
+		Entry("BYMONTHDAY=-1 on the last day of every month", "FREQ=MONTHLY;BYMONTHDAY=-1", "2025-01-31T09:00:00Z", false,
+			"2025-02-28T09:00:00Z", "2025-03-31T09:00:00Z", "2025-04-30T09:00:00Z"),
+		Entry("BYMONTHDAY=-1 in a leap year", "FREQ=MONTHLY;BYMONTHDAY=-1", "2024-01-31T09:00:00Z", false,
+			"2024-02-29T09:00:00Z"),
+		Entry("several BYMONTHDAYs in order", "FREQ=MONTHLY;BYMONTHDAY=-1,15", "2025-02-15T09:00:00Z", false,
+			"2025-02-28T09:00:00Z", "2025-03-15T09:00:00Z"),
+		Entry("yearly from February 29th", "FREQ=YEARLY", "2024-02-29T09:00:00Z", false,
+			"2028-02-29T09:00:00Z", "2032-02-29T09:00:00Z"),
+		Entry("yearly from February 29th every third year", "FREQ=YEARLY;INTERVAL=3", "2024-02-29T09:00:00Z", false,
+			"2036-02-29T09:00:00Z"),
+		Entry("COUNT", "FREQ=DAILY;COUNT=3", "2025-01-01T09:00:00Z", true,
+			"2025-01-02T09:00:00Z", "2025-01-03T09:00:00Z"),
+		Entry("COUNT=1", "FREQ=WEEKLY;COUNT=1", "2025-01-01T09:00:00Z", true),
+		Entry("UNTIL a date, which includes that day", "FREQ=DAILY;INTERVAL=2;UNTIL=20250105", "2025-01-01T09:00:00Z", true,
+			"2025-01-03T09:00:00Z", "2025-01-05T09:00:00Z"),
+		Entry("UNTIL a time", "FREQ=DAILY;UNTIL=20250105T080000Z", "2025-01-01T09:00:00Z", true,
+			"2025-01-02T09:00:00Z", "2025-01-03T09:00:00Z", "2025-01-04T09:00:00Z"),
+	)
+
+	DescribeTable("rejecting rules",
+		func(rule string) {
+			_, err := recurrence.Parse(rule)
+			Expect(err).To(MatchError(recurrence.ErrInvalidRule))
+		},
+		Entry("without FREQ", "INTERVAL=2"),
+		Entry("with an unknown FREQ", "FREQ=HOURLY"),
+		Entry("with BYHOUR", "FREQ=DAILY;BYHOUR=9"),
+		Entry("with BYSETPOS", "FREQ=MONTHLY;BYSETPOS=1"),
+		Entry("with WKST", "FREQ=WEEKLY;WKST=SU"),
+		Entry("with BYMONTH", "FREQ=YEARLY;BYMONTH=2"),
+		Entry("with ordinal weekdays", "FREQ=MONTHLY;BYDAY=1MO"),
+		Entry("with BYDAY on a monthly rule", "FREQ=MONTHLY;BYDAY=MO"),
+		Entry("with BYMONTHDAY on a weekly rule", "FREQ=WEEKLY;BYMONTHDAY=1"),
+		Entry("with BYMONTHDAY out of range", "FREQ=MONTHLY;BYMONTHDAY=32"),
+		Entry("with BYMONTHDAY=0", "FREQ=MONTHLY;BYMONTHDAY=0"),
+		Entry("with INTERVAL=0", "FREQ=DAILY;INTERVAL=0"),
+		Entry("with COUNT and UNTIL", "FREQ=DAILY;COUNT=2;UNTIL=20250101"),
+		Entry("with UNTIL in another format", "FREQ=DAILY;UNTIL=2025-01-01"),
+		Entry("with a part given twice", "FREQ=DAILY;FREQ=WEEKLY"),
+		Entry("with a part without a value", "FREQ=DAILY;COUNT="),
+	)
+})
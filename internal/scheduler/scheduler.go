@@ -0,0 +1,239 @@
+// Package scheduler watches due dates in the background: it flags tasks that
+// pass their due date without being finished and sends the reminders users
+// set up before due dates.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"task-manager/internal/clock"
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+	"task-manager/internal/workflow"
+)
+
+// Types of the events the scheduler emits
+const (
+	EventReminder = model.EventTaskReminder
+	EventOverdue  = model.EventTaskOverdue
+)
+
+// DefaultInterval is how often tasks are scanned unless WithInterval says otherwise
+const DefaultInterval = time.Minute
+
+// batchSize is how many tasks are loaded at a time
+const batchSize = 100
+
+// Event reports a task that needs attention
+type Event struct {
+	Type string     `json:"type"`
+	Task model.Task `json:"task"`
+	// Minutes is the reminder that is due, in minutes before the due date;
+	// it is only set on reminder events
+	Minutes int `json:"minutes,omitempty"`
+	// At is when the scheduler noticed, in RFC3339
+	At string `json:"at"`
+}
+
+// Notifier receives the events of the scheduler. It is called in the
+// transaction tx that stores the change to the task, so a task is never
+// reported twice for the same reason; returning an error rolls the change
+// back, and the task is looked at again by the next scan.
+type Notifier func(ctx context.Context, tx db.DB, e Event) error
+
+// LogNotifier writes events to the standard logger
+func LogNotifier(ctx context.Context, tx db.DB, e Event) error {
+	switch e.Type {
+	case EventReminder:
+		log.Printf("Reminder: task %s of user %s is due in %d minutes", e.Task.ID, e.Task.UserID, e.Minutes)
+	case EventOverdue:
+		log.Printf("Task %s of user %s is overdue", e.Task.ID, e.Task.UserID)
+	}
+	return nil
+}
+
+// Scheduler scans the tasks of every user at regular intervals
+type Scheduler struct {
+	db       db.DB
+	workflow *workflow.Workflow
+	clock    clock.Clock
+	interval time.Duration
+	notify   Notifier
+	// since is when the scheduler first ran, loaded by the first scan.
+	// Tasks that were due before then are not flagged overdue.
+	since time.Time
+}
+
+// Option customizes New
+type Option func(*Scheduler)
+
+// WithClock sets the clock scans are timed by; clock.System is used otherwise
+func WithClock(c clock.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// WithInterval sets the time between scans
+func WithInterval(d time.Duration) Option {
+	return func(s *Scheduler) {
+		s.interval = d
+	}
+}
+
+// WithWorkflow sets the workflow whose terminal statuses mark finished
+// tasks; workflow.Default is used otherwise
+func WithWorkflow(wf *workflow.Workflow) Option {
+	return func(s *Scheduler) {
+		s.workflow = wf
+	}
+}
+
+// WithNotifier sets where events go; LogNotifier is used otherwise
+func WithNotifier(notify Notifier) Option {
+	return func(s *Scheduler) {
+		s.notify = notify
+	}
+}
+
+// New returns a scheduler for the tasks in database
+func New(database db.DB, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		db:       database,
+		workflow: workflow.Default,
+		clock:    clock.System,
+		interval: DefaultInterval,
+		notify:   LogNotifier,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run scans right away and then once every interval until ctx is done.
+// Failed scans are logged and retried at the next interval.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		if err := s.Scan(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Scheduled scan failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(s.interval):
+		}
+	}
+}
+
+// Scan flags the unfinished tasks that are past their due date and sends the
+// reminders that are due
+func (s *Scheduler) Scan(ctx context.Context) error {
+	now := s.clock.Now().UTC().Truncate(time.Second)
+	if s.since.IsZero() {
+		since, err := s.db.SchedulerStart(ctx, now)
+		if err != nil {
+			return err
+		}
+		s.since = since
+	}
+	if err := s.flagOverdue(ctx, now); err != nil {
+		return err
+	}
+	return s.sendReminders(ctx, now)
+}
+
+func (s *Scheduler) flagOverdue(ctx context.Context, now time.Time) error {
+	for {
+		tasks, err := s.db.ListNewlyOverdue(ctx, s.since, now, s.workflow.Terminal(), batchSize)
+		if err != nil {
+			return err
+		}
+		flagged := 0
+		for _, task := range tasks {
+			task.OverdueAt = now.Format(time.RFC3339)
+			stored, err := s.store(ctx, &task, &Event{Type: EventOverdue, Task: task, At: task.OverdueAt})
+			if err != nil {
+				return err
+			}
+			if stored {
+				flagged++
+			}
+		}
+		if len(tasks) < batchSize || flagged == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *Scheduler) sendReminders(ctx context.Context, now time.Time) error {
+	for {
+		tasks, err := s.db.ListDueReminders(ctx, now, s.workflow.Terminal(), batchSize)
+		if err != nil {
+			return err
+		}
+		sent := 0
+		for _, task := range tasks {
+			var minutes int
+			minutes, task.NextReminderAt = dueReminder(task, now)
+			var event *Event
+			if minutes > 0 {
+				event = &Event{Type: EventReminder, Task: task, Minutes: minutes, At: now.Format(time.RFC3339)}
+			}
+			stored, err := s.store(ctx, &task, event)
+			if err != nil {
+				return err
+			}
+			if stored {
+				sent++
+			}
+		}
+		if len(tasks) < batchSize || sent == 0 {
+			return nil
+		}
+	}
+}
+
+// dueReminder picks the reminder to send for a task at now and when the
+// one after it is due. Of several reminders that have passed only the last
+// is sent, as the others are stale by now, and none are sent once the task
+// is due.
+func dueReminder(task model.Task, now time.Time) (minutes int, next string) {
+	due, err := time.Parse(time.RFC3339, task.DueDate)
+	if err != nil || !due.After(now) {
+		return 0, ""
+	}
+	// Reminders are sorted largest first, so they come up in order
+	for _, m := range task.Reminders {
+		at := due.Add(-time.Duration(m) * time.Minute)
+		if at.After(now) {
+			return minutes, at.UTC().Format(time.RFC3339)
+		}
+		minutes = m
+	}
+	return minutes, ""
+}
+
+// store saves a change the scheduler made to a task and reports the event
+// it causes, if any, in the same transaction. Neither the version nor the
+// update time of the task changes, as its owner did not change it. It
+// reports false if the task was changed or deleted since it was loaded; the
+// next scan looks at it again.
+func (s *Scheduler) store(ctx context.Context, task *model.Task, e *Event) (bool, error) {
+	err := s.db.WithTx(ctx, func(tx db.DB) error {
+		if err := tx.SetTaskSchedule(ctx, task); err != nil {
+			return err
+		}
+		if e == nil {
+			return nil
+		}
+		return s.notify(ctx, tx, *e)
+	})
+	if errors.Is(err, db.ErrVersionConflict) || errors.Is(err, db.ErrTaskNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,287 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+	"task-manager/internal/scheduler"
+	"task-manager/internal/service"
+	"task-manager/internal/workflow"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestScheduler(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Scheduler Suite")
+}
+
+// fakeClock only moves when told to
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, waiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock on and wakes whoever waited for that long
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var waiting []waiter
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = waiting
+}
+
+func (c *fakeClock) Waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+var _ = Describe("Scheduler", func() {
+	var (
+		ctx      context.Context
+		database db.DB
+		clock    *fakeClock
+		tasks    *service.TaskService
+		sched    *scheduler.Scheduler
+		mu       sync.Mutex
+		events   []scheduler.Event
+	)
+
+	received := func() []scheduler.Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]scheduler.Event{}, events...)
+	}
+
+	create := func(title, due string, reminders ...int) *model.Task {
+		task := &model.Task{Title: title, DueDate: due, Status: model.StatusPending, Reminders: reminders}
+		Expect(tasks.Create(ctx, task)).To(Succeed())
+		return task
+	}
+
+	get := func(id string) *model.Task {
+		task, err := tasks.Get(ctx, id)
+		Expect(err).To(BeNil())
+		return task
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		database = db.NewMemoryDB()
+		user := &model.User{Name: "Test User", Email: "test@example.com"}
+		Expect(database.CreateUser(ctx, user)).To(Succeed())
+		tasks = service.NewTaskService(database, workflow.Default, user.ID)
+		clock = &fakeClock{now: time.Date(2025, 3, 10, 6, 0, 0, 0, time.UTC)}
+		events = nil
+		sched = scheduler.New(database,
+			scheduler.WithClock(clock),
+			scheduler.WithInterval(time.Minute),
+			scheduler.WithNotifier(func(ctx context.Context, tx db.DB, e scheduler.Event) error {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, e)
+				return nil
+			}),
+		)
+		// The scheduler has been running for a while
+		Expect(sched.Scan(ctx)).To(Succeed())
+		clock.Advance(2 * time.Hour)
+	})
+
+	It("should flag unfinished tasks once they are overdue", func() {
+		late := create("Late", "2025-03-10T07:30:00Z")
+		create("Later", "2025-03-10T09:00:00Z")
+		done := create("Done", "2025-03-09T12:00:00Z")
+		_, err := tasks.Modify(ctx, done.ID, func(task *model.Task) error {
+			task.Status = model.StatusDone
+			return nil
+		})
+		Expect(err).To(BeNil())
+
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+		Expect(received()[0].Type).To(Equal(scheduler.EventOverdue))
+		Expect(received()[0].Task.ID).To(Equal(late.ID))
+		// Flagging is not a change of the user's
+		Expect(get(late.ID).OverdueAt).To(Equal("2025-03-10T08:00:00Z"))
+		Expect(get(late.ID).Version).To(Equal(late.Version))
+		Expect(get(late.ID).UpdatedAt).To(Equal(late.UpdatedAt))
+
+		// Flagged tasks are not reported again
+		clock.Advance(2 * time.Hour)
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(2))
+		Expect(received()[1].Task.Title).To(Equal("Later"))
+	})
+
+	It("should not flag tasks that were overdue before it first ran", func() {
+		create("Long overdue", "2025-03-10T05:00:00Z")
+		create("Late", "2025-03-10T07:30:00Z")
+
+		// A restart does not move the start
+		sched = scheduler.New(database, scheduler.WithClock(clock), scheduler.WithNotifier(func(ctx context.Context, tx db.DB, e scheduler.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+			return nil
+		}))
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+		Expect(received()[0].Task.Title).To(Equal("Late"))
+	})
+
+	It("should store nothing when the event cannot be queued", func() {
+		late := create("Late", "2025-03-10T07:30:00Z")
+		failing := scheduler.New(database, scheduler.WithClock(clock), scheduler.WithNotifier(func(ctx context.Context, tx db.DB, e scheduler.Event) error {
+			return errors.New("queue unavailable")
+		}))
+		Expect(failing.Scan(ctx)).To(MatchError("queue unavailable"))
+		Expect(get(late.ID).OverdueAt).To(BeEmpty())
+
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+		Expect(get(late.ID).OverdueAt).To(Equal("2025-03-10T08:00:00Z"))
+	})
+
+	It("should clear the overdue flag when the due date moves", func() {
+		late := create("Late", "2025-03-10T07:30:00Z")
+		Expect(sched.Scan(ctx)).To(Succeed())
+
+		moved, err := tasks.Modify(ctx, late.ID, func(task *model.Task) error {
+			task.DueDate = "2025-03-10T12:00:00Z"
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(moved.OverdueAt).To(BeEmpty())
+
+		// Other changes keep it
+		_, err = tasks.Modify(ctx, late.ID, func(task *model.Task) error {
+			task.DueDate = "2025-03-10T07:00:00Z"
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(sched.Scan(ctx)).To(Succeed())
+		kept, err := tasks.Modify(ctx, late.ID, func(task *model.Task) error {
+			task.Title = "Very late"
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(kept.OverdueAt).To(Equal("2025-03-10T08:00:00Z"))
+		Expect(received()).To(HaveLen(2))
+	})
+
+	It("should send each reminder once, when it is due", func() {
+		task := create("Standup", "2025-03-10T10:00:00Z", 30, 120, 60)
+		Expect(task.Reminders).To(Equal([]int{120, 60, 30}))
+		Expect(task.NextReminderAt).To(Equal("2025-03-10T08:00:00Z"))
+
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+		Expect(received()[0].Type).To(Equal(scheduler.EventReminder))
+		Expect(received()[0].Minutes).To(Equal(120))
+		Expect(get(task.ID).NextReminderAt).To(Equal("2025-03-10T09:00:00Z"))
+
+		clock.Advance(59 * time.Minute)
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+
+		// Only the latest of the reminders that passed meanwhile is sent
+		clock.Advance(31 * time.Minute)
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(2))
+		Expect(received()[1].Minutes).To(Equal(30))
+		Expect(get(task.ID).NextReminderAt).To(BeEmpty())
+
+		clock.Advance(time.Hour)
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(3))
+		Expect(received()[2].Type).To(Equal(scheduler.EventOverdue))
+	})
+
+	It("should start the reminders again when the due date changes", func() {
+		task := create("Review", "2025-03-10T08:30:00Z", 60)
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+
+		moved, err := tasks.Modify(ctx, task.ID, func(task *model.Task) error {
+			task.DueDate = "2025-03-11T08:30:00Z"
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(moved.NextReminderAt).To(Equal("2025-03-11T07:30:00Z"))
+
+		clock.Advance(24 * time.Hour)
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(2))
+		Expect(received()[1].Task.DueDate).To(Equal("2025-03-11T08:30:00Z"))
+	})
+
+	It("should skip reminders of finished tasks and tasks that are already due", func() {
+		done := create("Done", "2025-03-10T09:00:00Z", 90)
+		_, err := tasks.Modify(ctx, done.ID, func(task *model.Task) error {
+			task.Status = model.StatusDone
+			return nil
+		})
+		Expect(err).To(BeNil())
+		late := create("Late", "2025-03-10T07:00:00Z", 30)
+
+		Expect(sched.Scan(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+		Expect(received()[0].Type).To(Equal(scheduler.EventOverdue))
+		Expect(get(late.ID).NextReminderAt).To(BeEmpty())
+	})
+
+	It("should scan at every interval until stopped", func() {
+		create("Standup", "2025-03-10T10:00:00Z", 90)
+		runCtx, stop := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		go func() {
+			sched.Run(runCtx)
+			close(stopped)
+		}()
+
+		Eventually(clock.Waiting).Should(Equal(1))
+		Expect(received()).To(BeEmpty())
+		clock.Advance(30 * time.Minute)
+		Eventually(received).Should(HaveLen(1))
+		Expect(received()[0].Minutes).To(Equal(90))
+
+		Eventually(clock.Waiting).Should(Equal(1))
+		stop()
+		Eventually(stopped).Should(BeClosed())
+	})
+})
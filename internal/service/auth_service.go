@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidToken is returned for credentials that are malformed, unknown,
+	// expired or revoked
+	ErrInvalidToken = errors.New("invalid or revoked token")
+	// ErrInvalidCredentials is returned by Login for an unknown email or a
+	// wrong password, without saying which
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+// apiTokenPrefix marks API token secrets so they are easy to recognize, e.g. in leaked logs
+const apiTokenPrefix = "tm_"
+
+// Session token lifetimes
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type AuthService struct {
+	db db.DB
+	// jwtSecret signs session tokens; it may be nil if sessions are not used
+	jwtSecret []byte
+}
+
+func NewAuthService(db db.DB, jwtSecret []byte) *AuthService {
+	return &AuthService{db: db, jwtSecret: jwtSecret}
+}
+
+// HashPassword returns the bcrypt hash stored for a password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// dummyHash is compared against when a login names an unknown user, so that
+// the response takes as long as for a wrong password
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Login checks a user's password and starts a session
+func (s *AuthService) Login(ctx context.Context, email, password string) (*model.Session, error) {
+	user, err := s.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, db.ErrUserNotFound) || (err == nil && user.PasswordHash == "") {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return s.issueSession(user.ID)
+}
+
+// Refresh exchanges a refresh token for a new session. Each refresh token
+// can only be used once.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*model.Session, error) {
+	c, err := parseJWT(s.jwtSecret, refreshToken, refreshTokenType, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.GetUser(ctx, c.Subject); err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	fresh, err := s.db.RevokeToken(ctx, c.ID, c.expiry())
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrInvalidToken
+	}
+	return s.issueSession(c.Subject)
+}
+
+// Logout revokes the session's access token and, if given, its refresh
+// token. API tokens are revoked by deleting them instead.
+func (s *AuthService) Logout(ctx context.Context, accessToken, refreshToken string) error {
+	access, err := parseJWT(s.jwtSecret, accessToken, accessTokenType, time.Now())
+	if err != nil {
+		return err
+	}
+	if refreshToken != "" {
+		refresh, err := parseJWT(s.jwtSecret, refreshToken, refreshTokenType, time.Now())
+		if err != nil || refresh.Subject != access.Subject {
+			return ErrInvalidToken
+		}
+		if _, err := s.db.RevokeToken(ctx, refresh.ID, refresh.expiry()); err != nil {
+			return err
+		}
+	}
+	_, err = s.db.RevokeToken(ctx, access.ID, access.expiry())
+	return err
+}
+
+func (s *AuthService) issueSession(userID string) (*model.Session, error) {
+	if len(s.jwtSecret) == 0 {
+		return nil, errors.New("session tokens are not configured")
+	}
+	issued := time.Now()
+	token := func(tokenType string, ttl time.Duration) string {
+		return signJWT(s.jwtSecret, claims{
+			Subject:   userID,
+			ID:        uuid.New().String(),
+			Type:      tokenType,
+			IssuedAt:  issued.Unix(),
+			ExpiresAt: issued.Add(ttl).Unix(),
+		})
+	}
+	return &model.Session{
+		UserID:       userID,
+		AccessToken:  token(accessTokenType, AccessTokenTTL),
+		RefreshToken: token(refreshTokenType, RefreshTokenTTL),
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// hashToken is how API token secrets are stored. The secrets are random, so
+// a fast hash is enough to make a leaked table useless.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken issues a new API token for userID and returns it together with
+// its secret, which cannot be recovered later
+func (s *AuthService) CreateToken(ctx context.Context, userID, name string) (*model.APIToken, string, error) {
+	return createToken(ctx, s.db, userID, name)
+}
+
+// createToken stores a new API token in tx and returns it with its secret
+func createToken(ctx context.Context, tx db.DB, userID, name string) (*model.APIToken, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	secret := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	token := &model.APIToken{UserID: userID, Name: name}
+	if err := tx.CreateAPIToken(ctx, token, hashToken(secret)); err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+// Authenticate returns the user a bearer token belongs to, which is either
+// an API token secret or a session access token
+func (s *AuthService) Authenticate(ctx context.Context, bearer string) (*model.User, error) {
+	if strings.HasPrefix(bearer, apiTokenPrefix) {
+		user, err := s.db.GetUserByTokenHash(ctx, hashToken(bearer))
+		if errors.Is(err, db.ErrTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return user, err
+	}
+	c, err := parseJWT(s.jwtSecret, bearer, accessTokenType, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := s.db.IsTokenRevoked(ctx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.db.GetUser(ctx, c.Subject)
+	if errors.Is(err, db.ErrUserNotFound) {
+		return nil, ErrInvalidToken
+	}
+	return user, err
+}
+
+func (s *AuthService) ListTokens(ctx context.Context, userID string) ([]model.APIToken, error) {
+	return s.db.ListAPITokens(ctx, userID)
+}
+
+// DeleteToken revokes one of the user's API tokens
+func (s *AuthService) DeleteToken(ctx context.Context, userID, tokenID string) error {
+	return s.db.DeleteAPIToken(ctx, tokenID, userID)
+}
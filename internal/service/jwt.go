@@ -0,0 +1,69 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Session token types, carried in the typ claim so that a refresh token
+// cannot be used as an access token or the other way round
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+)
+
+// jwtHeader is the only header issued and accepted: HMAC-SHA256 signatures
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type claims struct {
+	Subject   string `json:"sub"`
+	ID        string `json:"jti"`
+	Type      string `json:"typ"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (c claims) expiry() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signJWT encodes c as a compact HS256 JWT
+func signJWT(secret []byte, c claims) string {
+	body, _ := json.Marshal(c)
+	payload := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(body)
+	return payload + "." + sign(secret, payload)
+}
+
+// parseJWT verifies the signature, type and expiry of a JWT issued by signJWT
+func parseJWT(secret []byte, token, tokenType string, now time.Time) (claims, error) {
+	var c claims
+	if len(secret) == 0 {
+		return c, ErrInvalidToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return c, ErrInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(sign(secret, payload))) {
+		return c, ErrInvalidToken
+	}
+	body, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(body, &c) != nil {
+		return c, ErrInvalidToken
+	}
+	if c.Type != tokenType || c.Subject == "" || c.ID == "" || !now.Before(c.expiry()) {
+		return c, ErrInvalidToken
+	}
+	return c, nil
+}
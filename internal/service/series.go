@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+	"task-manager/internal/recurrence"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotRecurring is returned for series operations on one-off tasks
+	ErrNotRecurring = errors.New("task does not recur")
+	// ErrSeriesEnded is returned when skipping the last occurrence of a series
+	ErrSeriesEnded = errors.New("the series has no further occurrences")
+	// ErrOccurrenceFinished is returned when skipping an occurrence that is
+	// already finished
+	ErrOccurrenceFinished = errors.New("only unfinished occurrences can be skipped")
+)
+
+// startSeries makes a task that has just become recurring the first
+// occurrence of a new series
+func startSeries(task *model.Task) {
+	if task.Recurrence != "" && task.SeriesID == "" {
+		task.SeriesID = uuid.New().String()
+		task.Occurrence = 1
+	}
+}
+
+// nextDue computes the due date of the occurrence after task. It reports
+// false if the series ends with task.
+func nextDue(task *model.Task) (string, bool, error) {
+	rule, err := recurrence.Parse(task.Recurrence)
+	if err != nil {
+		return "", false, err
+	}
+	due, err := time.Parse(time.RFC3339, task.DueDate)
+	if err != nil {
+		return "", false, err
+	}
+	next, ok := rule.Next(due, task.Occurrence)
+	if !ok {
+		return "", false, nil
+	}
+	return next.Format(time.RFC3339), true, nil
+}
+
+// spawnNext creates the occurrence that follows a finished one, unless the
+// series ends with it or the next occurrence exists already, which happens
+// when an occurrence is reopened and finished again
+func (s *TaskService) spawnNext(ctx context.Context, finished *model.Task) error {
+	due, ok, err := nextDue(finished)
+	if err != nil || !ok {
+		return err
+	}
+	occurrences, err := s.series(ctx, finished.SeriesID, false)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(occurrences, func(t model.Task) bool { return t.Occurrence > finished.Occurrence }) {
+		return nil
+	}
+	next := &model.Task{
+		Title:       finished.Title,
+		Description: finished.Description,
+		DueDate:     due,
+		Status:      s.workflow.Initial(),
+		Priority:    finished.Priority,
+		Tags:        slices.Clone(finished.Tags),
+		Recurrence:  finished.Recurrence,
+		SeriesID:    finished.SeriesID,
+		Occurrence:  finished.Occurrence + 1,
+		Reminders:   slices.Clone(finished.Reminders),
+		UserID:      s.userID,
+	}
+	scheduleReminders(next)
+	if err := s.db.CreateTask(ctx, next); err != nil {
+		return err
+	}
+	return s.notify(ctx, model.EventTaskCreated, next)
+}
+
+// series returns the occurrences of a series, or only the unfinished ones
+func (s *TaskService) series(ctx context.Context, seriesID string, open bool) ([]model.Task, error) {
+	q := db.TaskQuery{SeriesID: seriesID, Page: db.Page{Limit: db.MaxPageSize}}
+	if open {
+		q.ExcludeStatuses = s.workflow.Terminal()
+	}
+	var tasks []model.Task
+	for {
+		page, next, err := s.db.ListTasks(ctx, s.userID, q)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, page...)
+		if next == "" {
+			return tasks, nil
+		}
+		q.Cursor = next
+	}
+}
+
+// SkipOccurrence moves an unfinished occurrence of a recurring task on to
+// the date of the next one, without creating a new task
+func (s *TaskService) SkipOccurrence(ctx context.Context, taskID string) (*model.Task, error) {
+	return s.Modify(ctx, taskID, func(task *model.Task) error {
+		if task.Recurrence == "" {
+			return ErrNotRecurring
+		}
+		if s.workflow.IsTerminal(task.Status) {
+			return ErrOccurrenceFinished
+		}
+		due, ok, err := nextDue(task)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrSeriesEnded
+		}
+		task.DueDate = due
+		task.Occurrence++
+		return nil
+	})
+}
+
+// ModifySeries applies change to every unfinished occurrence of the series
+// the task belongs to, so that later occurrences follow it too. It returns
+// the changed occurrences.
+func (s *TaskService) ModifySeries(ctx context.Context, taskID string, change func(task *model.Task) error) ([]model.Task, error) {
+	changed := []model.Task{}
+	err := s.db.WithTx(ctx, func(tx db.DB) error {
+		ts := NewTaskService(tx, s.workflow, s.userID)
+		task, err := ts.get(ctx, taskID)
+		if err != nil {
+			return err
+		}
+		if task.SeriesID == "" {
+			return ErrNotRecurring
+		}
+		open, err := ts.series(ctx, task.SeriesID, true)
+		if err != nil {
+			return err
+		}
+		for _, occurrence := range open {
+			updated, err := ts.Modify(ctx, occurrence.ID, change)
+			if err != nil {
+				return err
+			}
+			changed = append(changed, *updated)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// StopSeries ends the series the task belongs to: its unfinished
+// occurrences stay, but no longer recur
+func (s *TaskService) StopSeries(ctx context.Context, taskID string) ([]model.Task, error) {
+	return s.ModifySeries(ctx, taskID, func(task *model.Task) error {
+		task.Recurrence = ""
+		return nil
+	})
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+)
+
+// TagService manages the tags users label their tasks with. Tags are also
+// created on the fly when a task is saved with a tag its owner does not have.
+type TagService struct {
+	db db.DB
+}
+
+func NewTagService(db db.DB) *TagService {
+	return &TagService{db: db}
+}
+
+func (s *TagService) Create(ctx context.Context, userID, name string) (*model.Tag, error) {
+	tag := &model.Tag{UserID: userID, Name: name}
+	if err := s.db.CreateTag(ctx, tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+func (s *TagService) List(ctx context.Context, userID string) ([]model.Tag, error) {
+	return s.db.ListTags(ctx, userID)
+}
+
+// Rename changes the name of a tag on every task that carries it
+func (s *TagService) Rename(ctx context.Context, userID, tagID, name string) (*model.Tag, error) {
+	tag := &model.Tag{ID: tagID, UserID: userID, Name: name}
+	if err := s.db.RenameTag(ctx, tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// Delete removes a tag from every task that carries it
+func (s *TagService) Delete(ctx context.Context, userID, tagID string) error {
+	return s.db.DeleteTag(ctx, tagID, userID)
+}
@@ -1,30 +1,157 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
 	"task-manager/internal/db"
 	"task-manager/internal/model"
+	"task-manager/internal/webhook"
+	"task-manager/internal/workflow"
+)
+
+var (
+	// ErrParentNotFound is returned for a parent_id that names none of the
+	// user's tasks
+	ErrParentNotFound = errors.New("parent task not found")
+	// ErrSubtaskCycle is returned when a task would become a subtask of
+	// itself or of one of its own subtasks
+	ErrSubtaskCycle = errors.New("a task cannot be a subtask of itself or of its own subtasks")
+	// ErrBlockerNotFound is returned when a task would depend on a task that
+	// is not one of the user's
+	ErrBlockerNotFound = errors.New("blocking task not found")
+	// ErrDependencyCycle is returned when a task would depend on itself or on
+	// a task that already depends on it
+	ErrDependencyCycle = errors.New("a task cannot depend on itself or on a task that depends on it")
 )
 
+// OpenSubtasksError is returned when a task would reach a terminal status
+// while some of its subtasks have not, unless the workflow allows it
+type OpenSubtasksError struct {
+	Open int
+}
+
+func (e *OpenSubtasksError) Error() string {
+	return fmt.Sprintf("%d subtask(s) must be finished first", e.Open)
+}
+
+// BlockedError is returned when a task would move to a status the workflow
+// keeps from tasks that still wait for others
+type BlockedError struct {
+	Status string
+	// Open is the number of unfinished tasks the task waits for
+	Open int
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("task is waiting for %d unfinished task(s) and cannot move to %s", e.Open, e.Status)
+}
+
 type TaskService struct {
-	db     db.DB
-	userID string
+	db       db.DB
+	workflow *workflow.Workflow
+	userID   string
 }
 
-func NewTaskService(db db.DB, userID string) *TaskService {
-	return &TaskService{db: db, userID: userID}
+// NewTaskService manages the tasks of one user; status changes must follow wf
+func NewTaskService(db db.DB, wf *workflow.Workflow, userID string) *TaskService {
+	return &TaskService{db: db, workflow: wf, userID: userID}
 }
 
-func (s *TaskService) Create(task *model.Task) error {
-	task.UserID = s.userID
-	return s.db.CreateTask(task)
+// Workflow returns the statuses and transitions tasks follow
+func (s *TaskService) Workflow() *workflow.Workflow {
+	return s.workflow
 }
 
-func (s *TaskService) List(status string) ([]model.Task, error) {
-	return s.db.ListTasks(s.userID, status)
+// Create stores a new task, which must only name one of the user's tasks as
+// its parent
+func (s *TaskService) Create(ctx context.Context, task *model.Task) error {
+	task.UserID, task.Progress, task.Blocked = s.userID, nil, false
+	task.SeriesID, task.Occurrence = "", 0
+	startSeries(task)
+	scheduleReminders(task)
+	return s.db.WithTx(ctx, func(tx db.DB) error {
+		ts := NewTaskService(tx, s.workflow, s.userID)
+		if err := ts.checkParent(ctx, task); err != nil {
+			return err
+		}
+		if err := tx.CreateTask(ctx, task); err != nil {
+			return err
+		}
+		if err := ts.notify(ctx, model.EventTaskCreated, task); err != nil {
+			return err
+		}
+		return ts.touch(ctx, task.ParentID)
+	})
 }
 
-func (s *TaskService) Get(taskID string) (*model.Task, error) {
-	task, err := s.db.GetTask(taskID)
+func (s *TaskService) List(ctx context.Context, q db.TaskQuery) ([]model.Task, string, error) {
+	tasks, next, err := s.db.ListTasks(ctx, s.userID, q)
+	if err != nil {
+		return nil, "", err
+	}
+	ptrs := make([]*model.Task, len(tasks))
+	for i := range tasks {
+		ptrs[i] = &tasks[i]
+	}
+	if err := s.withComputed(ctx, ptrs...); err != nil {
+		return nil, "", err
+	}
+	return tasks, next, nil
+}
+
+// Subtasks lists the subtasks of a task, narrowed down by q
+func (s *TaskService) Subtasks(ctx context.Context, taskID string, q db.TaskQuery) ([]model.Task, string, error) {
+	if _, err := s.get(ctx, taskID); err != nil {
+		return nil, "", err
+	}
+	q.ParentID = taskID
+	return s.List(ctx, q)
+}
+
+// Search returns the user's tasks matching a free-text query, best match first
+func (s *TaskService) Search(ctx context.Context, query string, limit int) ([]model.TaskSearchResult, error) {
+	results, err := s.db.SearchTasks(ctx, s.userID, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*model.Task, len(results))
+	for i := range results {
+		tasks[i] = &results[i].Task
+	}
+	if err := s.withComputed(ctx, tasks...); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// OnlyOverdue narrows q to tasks that are past their due date at now and not
+// in a terminal status of the workflow
+func (s *TaskService) OnlyOverdue(q db.TaskQuery, now time.Time) db.TaskQuery {
+	if before, err := time.Parse(time.RFC3339, q.DueBefore); err != nil || before.After(now) {
+		q.DueBefore = now.UTC().Format(time.RFC3339)
+	}
+	q.ExcludeStatuses = append(q.ExcludeStatuses, s.workflow.Terminal()...)
+	return q
+}
+
+func (s *TaskService) Get(ctx context.Context, taskID string) (*model.Task, error) {
+	task, err := s.get(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.withComputed(ctx, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// get loads one of the user's tasks without its progress
+func (s *TaskService) get(ctx context.Context, taskID string) (*model.Task, error) {
+	task, err := s.db.GetTask(ctx, taskID)
 	if err != nil {
 		return nil, err
 	}
@@ -34,11 +161,366 @@ func (s *TaskService) Get(taskID string) (*model.Task, error) {
 	return task, nil
 }
 
-func (s *TaskService) Update(task *model.Task) error {
-	task.UserID = s.userID
-	return s.db.UpdateTask(task)
+// withComputed fills in the fields that depend on other tasks: the progress
+// of tasks with subtasks and whether tasks are blocked
+func (s *TaskService) withComputed(ctx context.Context, tasks ...*model.Task) error {
+	ids := make([]string, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+	counts, err := s.db.CountSubtasks(ctx, ids, s.workflow.Terminal())
+	if err != nil {
+		return err
+	}
+	blockers, err := s.db.CountOpenBlockers(ctx, ids, s.workflow.Terminal())
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if p, ok := counts[t.ID]; ok {
+			t.Progress = &p
+		}
+		t.Blocked = blockers[t.ID] > 0
+	}
+	return nil
+}
+
+// checkParent makes sure the parent of task is one of the user's tasks and
+// not the task itself or one of its subtasks. A chain of parents that
+// already loops, without the task, is refused the same way rather than
+// followed forever.
+func (s *TaskService) checkParent(ctx context.Context, task *model.Task) error {
+	seen := make(map[string]bool)
+	for id := task.ParentID; id != ""; {
+		if id == task.ID || seen[id] {
+			return ErrSubtaskCycle
+		}
+		seen[id] = true
+		parent, err := s.get(ctx, id)
+		if errors.Is(err, db.ErrTaskNotFound) {
+			return ErrParentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		id = parent.ParentID
+	}
+	return nil
+}
+
+// checkSubtasksDone returns an *OpenSubtasksError unless every subtask of
+// the task is in a terminal status
+func (s *TaskService) checkSubtasksDone(ctx context.Context, taskID string) error {
+	counts, err := s.db.CountSubtasks(ctx, []string{taskID}, s.workflow.Terminal())
+	if err != nil {
+		return err
+	}
+	if p := counts[taskID]; p.Done < p.Total {
+		return &OpenSubtasksError{Open: p.Total - p.Done}
+	}
+	return nil
+}
+
+// checkUnblocked returns a *BlockedError if the task waits for unfinished
+// tasks and the workflow does not let such tasks move to status
+func (s *TaskService) checkUnblocked(ctx context.Context, taskID, status string) error {
+	if !s.workflow.RequiresUnblocked(status) {
+		return nil
+	}
+	counts, err := s.db.CountOpenBlockers(ctx, []string{taskID}, s.workflow.Terminal())
+	if err != nil {
+		return err
+	}
+	if n := counts[taskID]; n > 0 {
+		return &BlockedError{Status: status, Open: n}
+	}
+	return nil
+}
+
+// touch bumps the version of a task whose computed fields changed, such as
+// the parent of a changed subtask
+func (s *TaskService) touch(ctx context.Context, taskID string) error {
+	if taskID == "" {
+		return nil
+	}
+	task, err := s.get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	return s.db.UpdateTask(ctx, task)
+}
+
+// touchDependents bumps the version of the tasks waiting for a task
+func (s *TaskService) touchDependents(ctx context.Context, taskID string) error {
+	deps, err := s.db.ListDependencies(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	for _, d := range deps {
+		if d.BlockerID != taskID {
+			continue
+		}
+		if err := s.touch(ctx, d.TaskID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notify queues a task event for the user's webhooks
+func (s *TaskService) notify(ctx context.Context, eventType string, task *model.Task) error {
+	return webhook.Enqueue(ctx, s.db, s.userID, eventType, map[string]any{"task": task})
+}
+
+// scheduleReminders starts the reminders of a task whose due date or
+// reminders are new: the first is due the largest offset before the due
+// date, and the task is no longer flagged overdue
+func scheduleReminders(task *model.Task) {
+	task.NextReminderAt, task.OverdueAt = "", ""
+	due, err := time.Parse(time.RFC3339, task.DueDate)
+	if err != nil || len(task.Reminders) == 0 {
+		return
+	}
+	first := due.Add(-time.Duration(slices.Max(task.Reminders)) * time.Minute)
+	task.NextReminderAt = first.UTC().Format(time.RFC3339)
+}
+
+// Update replaces the editable fields of a task and fills task with the
+// result. A non-zero task.Version must match the stored task, and the status
+// change must be allowed by the workflow.
+func (s *TaskService) Update(ctx context.Context, task *model.Task) error {
+	updated, err := s.Modify(ctx, task.ID, func(current *model.Task) error {
+		if task.Version != 0 && task.Version != current.Version {
+			return db.ErrVersionConflict
+		}
+		current.Title, current.Description = task.Title, task.Description
+		current.DueDate, current.Status = task.DueDate, task.Status
+		current.Priority, current.Tags = task.Priority, task.Tags
+		current.ParentID, current.Recurrence = task.ParentID, task.Recurrence
+		current.Reminders = task.Reminders
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*task = *updated
+	return nil
+}
+
+// Modify loads a task, lets change edit it and stores the result, all in one
+// transaction. If change returns an error nothing is stored, and if the task
+// is updated concurrently Modify fails with db.ErrVersionConflict. A status
+// change the workflow forbids fails with a *workflow.TransitionError,
+// finishing a task with open subtasks with an *OpenSubtasksError, and
+// starting or finishing a task that waits for others with a *BlockedError.
+// Finishing an occurrence of a recurring task creates the next one. The
+// user's webhooks receive a task.updated event with the stored task.
+func (s *TaskService) Modify(ctx context.Context, taskID string, change func(task *model.Task) error) (*model.Task, error) {
+	var task *model.Task
+	err := s.db.WithTx(ctx, func(tx db.DB) error {
+		ts := NewTaskService(tx, s.workflow, s.userID)
+		var err error
+		task, err = ts.get(ctx, taskID)
+		if err != nil {
+			return err
+		}
+		from, fromParent := task.Status, task.ParentID
+		fromDue, fromReminders := task.DueDate, task.Reminders
+		if err := change(task); err != nil {
+			return err
+		}
+		if err := s.workflow.CheckTransition(from, task.Status); err != nil {
+			return err
+		}
+		task.ID, task.UserID = taskID, s.userID
+		startSeries(task)
+		if task.DueDate != fromDue || !slices.Equal(task.Reminders, fromReminders) {
+			scheduleReminders(task)
+		}
+		if task.ParentID != fromParent {
+			if err := ts.checkParent(ctx, task); err != nil {
+				return err
+			}
+		}
+		if task.Status != from && s.workflow.IsTerminal(task.Status) && !s.workflow.AllowsOpenSubtasks() {
+			if err := ts.checkSubtasksDone(ctx, taskID); err != nil {
+				return err
+			}
+		}
+		if task.Status != from {
+			if err := ts.checkUnblocked(ctx, taskID, task.Status); err != nil {
+				return err
+			}
+		}
+		if err := tx.UpdateTask(ctx, task); err != nil {
+			return err
+		}
+		if err := ts.withComputed(ctx, task); err != nil {
+			return err
+		}
+		if err := ts.notify(ctx, model.EventTaskUpdated, task); err != nil {
+			return err
+		}
+		if s.workflow.IsTerminal(task.Status) != s.workflow.IsTerminal(from) {
+			if err := ts.touchDependents(ctx, taskID); err != nil {
+				return err
+			}
+		}
+		if task.Recurrence != "" && s.workflow.IsTerminal(task.Status) && !s.workflow.IsTerminal(from) {
+			if err := ts.spawnNext(ctx, task); err != nil {
+				return err
+			}
+		}
+		if task.Status == from && task.ParentID == fromParent {
+			return nil
+		}
+		if err := ts.touch(ctx, fromParent); err != nil {
+			return err
+		}
+		if task.ParentID != fromParent {
+			return ts.touch(ctx, task.ParentID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// UpdateStatuses sets the status of several tasks at once; either every task
+// is updated or, if any of them is missing, none are
+func (s *TaskService) UpdateStatuses(ctx context.Context, taskIDs []string, status string) error {
+	return s.db.WithTx(ctx, func(tx db.DB) error {
+		for _, id := range taskIDs {
+			_, err := NewTaskService(tx, s.workflow, s.userID).Modify(ctx, id, func(task *model.Task) error {
+				task.Status = status
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes a task; its subtasks become top-level tasks
+func (s *TaskService) Delete(ctx context.Context, taskID string) error {
+	return s.db.WithTx(ctx, func(tx db.DB) error {
+		ts := NewTaskService(tx, s.workflow, s.userID)
+		task, err := ts.get(ctx, taskID)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteTask(ctx, taskID, s.userID); err != nil {
+			return err
+		}
+		if err := ts.notify(ctx, model.EventTaskDeleted, task); err != nil {
+			return err
+		}
+		return ts.touch(ctx, task.ParentID)
+	})
+}
+
+// Dependencies returns the tasks a task waits for and the tasks waiting for
+// it, oldest dependency first
+func (s *TaskService) Dependencies(ctx context.Context, taskID string) (blockedBy, blocks []model.Task, err error) {
+	if _, err := s.get(ctx, taskID); err != nil {
+		return nil, nil, err
+	}
+	deps, err := s.db.ListDependencies(ctx, taskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	blockedBy, blocks = []model.Task{}, []model.Task{}
+	for _, d := range deps {
+		if d.TaskID == taskID {
+			task, err := s.get(ctx, d.BlockerID)
+			if err != nil {
+				return nil, nil, err
+			}
+			blockedBy = append(blockedBy, *task)
+		} else {
+			task, err := s.get(ctx, d.TaskID)
+			if err != nil {
+				return nil, nil, err
+			}
+			blocks = append(blocks, *task)
+		}
+	}
+	tasks := make([]*model.Task, 0, len(deps))
+	for i := range blockedBy {
+		tasks = append(tasks, &blockedBy[i])
+	}
+	for i := range blocks {
+		tasks = append(tasks, &blocks[i])
+	}
+	if err := s.withComputed(ctx, tasks...); err != nil {
+		return nil, nil, err
+	}
+	return blockedBy, blocks, nil
+}
+
+// AddDependency makes a task wait for another of the user's tasks. It fails
+// with ErrDependencyCycle if the other task already waits for it.
+func (s *TaskService) AddDependency(ctx context.Context, taskID, blockerID string) (*model.Dependency, error) {
+	dep := &model.Dependency{TaskID: taskID, BlockerID: blockerID}
+	err := s.db.WithTx(ctx, func(tx db.DB) error {
+		ts := NewTaskService(tx, s.workflow, s.userID)
+		if _, err := ts.get(ctx, taskID); err != nil {
+			return err
+		}
+		_, err := ts.get(ctx, blockerID)
+		if errors.Is(err, db.ErrTaskNotFound) {
+			return ErrBlockerNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := ts.checkDependencyCycle(ctx, taskID, blockerID); err != nil {
+			return err
+		}
+		return tx.AddDependency(ctx, dep)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dep, nil
+}
+
+// checkDependencyCycle makes sure the blocker does not wait, directly or
+// through other tasks, for the task it is to block
+func (s *TaskService) checkDependencyCycle(ctx context.Context, taskID, blockerID string) error {
+	seen := make(map[string]bool)
+	pending := []string{blockerID}
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == taskID {
+			return ErrDependencyCycle
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		deps, err := s.db.ListDependencies(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, d := range deps {
+			if d.TaskID == id {
+				pending = append(pending, d.BlockerID)
+			}
+		}
+	}
+	return nil
 }
 
-func (s *TaskService) Delete(taskID string) error {
-	return s.db.DeleteTask(taskID, s.userID)
+// RemoveDependency stops a task from waiting for another
+func (s *TaskService) RemoveDependency(ctx context.Context, taskID, blockerID string) error {
+	if _, err := s.get(ctx, taskID); err != nil {
+		return err
+	}
+	return s.db.DeleteDependency(ctx, taskID, blockerID)
 }
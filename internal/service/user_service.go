@@ -1,10 +1,17 @@
 package service
 
 import (
+	"context"
+	"errors"
+
 	"task-manager/internal/db"
 	"task-manager/internal/model"
+	"task-manager/internal/webhook"
 )
 
+// ErrLastAdmin is returned when an action would leave no admin
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+
 type UserService struct {
 	db db.DB
 }
@@ -13,18 +20,84 @@ func NewUserService(db db.DB) *UserService {
 	return &UserService{db: db}
 }
 
-func (s *UserService) Create(user *model.User) error {
-	return s.db.CreateUser(user)
+// Register creates a user as a member together with their first API token,
+// named tokenName, and returns the token's secret. Either both are stored or
+// neither is. Admins are only made by other admins, or out of band with the
+// token command.
+func (s *UserService) Register(ctx context.Context, user *model.User, tokenName string) (string, error) {
+	var secret string
+	err := s.db.WithTx(ctx, func(tx db.DB) error {
+		user.Role = model.RoleMember
+		if err := tx.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		var err error
+		_, secret, err = createToken(ctx, tx, user.ID, tokenName)
+		return err
+	})
+	return secret, err
+}
+
+func (s *UserService) Get(ctx context.Context, id string) (*model.User, error) {
+	return s.db.GetUser(ctx, id)
+}
+
+func (s *UserService) List(ctx context.Context, p db.Page) ([]model.User, string, error) {
+	return s.db.ListUsers(ctx, p)
 }
 
-func (s *UserService) Get(id string) (*model.User, error) {
-	return s.db.GetUser(id)
+// Delete removes a user. Users who still own tasks are only deleted when
+// cascade is set, in which case their tasks go with them. The last admin
+// cannot be deleted. The user's webhooks receive a user.deleted event before
+// they are removed.
+func (s *UserService) Delete(ctx context.Context, id string, cascade bool) error {
+	return s.db.WithTx(ctx, func(tx db.DB) error {
+		if err := keepAnAdmin(ctx, tx, id); err != nil {
+			return err
+		}
+		user, err := tx.GetUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := webhook.Enqueue(ctx, tx, id, model.EventUserDeleted, map[string]any{"user": user}); err != nil {
+			return err
+		}
+		return tx.DeleteUser(ctx, id, cascade)
+	})
 }
 
-func (s *UserService) List() ([]model.User, error) {
-	return s.db.ListUsers()
+// SetRole changes a user's role, refusing to demote the last admin
+func (s *UserService) SetRole(ctx context.Context, id string, role string) (*model.User, error) {
+	var user *model.User
+	err := s.db.WithTx(ctx, func(tx db.DB) error {
+		if role != model.RoleAdmin {
+			if err := keepAnAdmin(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		if err := tx.UpdateUserRole(ctx, id, role); err != nil {
+			return err
+		}
+		var err error
+		user, err = tx.GetUser(ctx, id)
+		return err
+	})
+	return user, err
 }
 
-func (s *UserService) Delete(id string) error {
-	return s.db.DeleteUser(id)
+// keepAnAdmin returns ErrLastAdmin if id is the only admin, who must not be
+// removed or demoted
+func keepAnAdmin(ctx context.Context, tx db.DB, id string) error {
+	user, err := tx.GetUser(ctx, id)
+	if err != nil || user.Role != model.RoleAdmin {
+		return err
+	}
+	admins, err := tx.CountUsersWithRole(ctx, model.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins == 1 {
+		return ErrLastAdmin
+	}
+	return nil
 }
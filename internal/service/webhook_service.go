@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+	"task-manager/internal/webhook"
+)
+
+// webhookSecretPrefix marks the secrets made up for webhooks created
+// without one
+const webhookSecretPrefix = "whsec_"
+
+// WebhookService manages the webhooks users receive the events of their
+// account with. The events themselves are queued by the other services.
+type WebhookService struct {
+	db    db.DB
+	guard *webhook.Guard
+}
+
+// NewWebhookService returns a service whose webhooks must pass guard; a nil
+// guard only allows URLs that resolve to public addresses
+func NewWebhookService(db db.DB, guard *webhook.Guard) *WebhookService {
+	if guard == nil {
+		guard = &webhook.Guard{}
+	}
+	return &WebhookService{db: db, guard: guard}
+}
+
+// Create stores a webhook for the user. If hook.Secret is empty a random
+// one is made up; either way it is returned in hook, and never again.
+// URLs that the guard refuses fail with webhook.ErrPrivateAddress or
+// webhook.ErrUnknownHost.
+func (s *WebhookService) Create(ctx context.Context, userID string, hook *model.Webhook) error {
+	if err := s.guard.CheckURL(ctx, hook.URL); err != nil {
+		return err
+	}
+	hook.UserID = userID
+	if hook.Secret == "" {
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		hook.Secret = webhookSecretPrefix + hex.EncodeToString(b)
+	}
+	return s.db.CreateWebhook(ctx, hook)
+}
+
+func (s *WebhookService) List(ctx context.Context, userID string) ([]model.Webhook, error) {
+	return s.db.ListWebhooks(ctx, userID)
+}
+
+func (s *WebhookService) Get(ctx context.Context, userID, webhookID string) (*model.Webhook, error) {
+	return s.db.GetWebhook(ctx, webhookID, userID)
+}
+
+// Delete removes a webhook along with its delivery log; deliveries that
+// were still pending are dropped
+func (s *WebhookService) Delete(ctx context.Context, userID, webhookID string) error {
+	return s.db.DeleteWebhook(ctx, webhookID, userID)
+}
+
+// Deliveries returns one page of the delivery log of a webhook
+func (s *WebhookService) Deliveries(ctx context.Context, userID, webhookID string, p db.Page) ([]model.WebhookDelivery, string, error) {
+	if _, err := s.db.GetWebhook(ctx, webhookID, userID); err != nil {
+		return nil, "", err
+	}
+	return s.db.ListDeliveries(ctx, webhookID, p)
+}
@@ -0,0 +1,202 @@
+package validation
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"task-manager/internal/model"
+	"task-manager/internal/recurrence"
+)
+
+// Limits on user and task fields, in characters
+const (
+	MinNameLen        = 2
+	MaxNameLen        = 50
+	MaxDescriptionLen = 200
+	MaxTagLen         = 30
+)
+
+// MaxTaskTags is the most tags a task may carry
+const MaxTaskTags = 20
+
+// MaxTaskReminders is the most reminders a task may have, each at most
+// MaxReminderMinutes (one week) before its due date
+const (
+	MaxTaskReminders   = 5
+	MaxReminderMinutes = 7 * 24 * 60
+)
+
+// NormalizeTask trims the fields of task, collapses whitespace in its title
+// and tags, gives it the default priority if it has none, brings its
+// recurrence rule into the stored form and sorts its reminders
+func NormalizeTask(task *model.Task) {
+	task.Title = singleLine(task.Title)
+	task.Description = strings.TrimSpace(task.Description)
+	task.DueDate = strings.TrimSpace(task.DueDate)
+	task.Status = strings.TrimSpace(task.Status)
+	task.ParentID = strings.TrimSpace(task.ParentID)
+	task.Recurrence = recurrence.Normalize(task.Recurrence)
+	task.Priority = strings.TrimSpace(task.Priority)
+	if task.Priority == "" {
+		task.Priority = model.DefaultPriority
+	}
+	for i, name := range task.Tags {
+		task.Tags[i] = singleLine(name)
+	}
+	// Reminders are kept largest first, so that equal lists compare equal
+	slices.SortFunc(task.Reminders, func(a, b int) int { return cmp.Compare(b, a) })
+	task.Reminders = slices.Compact(task.Reminders)
+}
+
+// Task normalizes task and reports every field that is missing or invalid.
+// statuses lists the statuses of the workflow the task follows.
+func Task(task *model.Task, statuses []string) Errors {
+	NormalizeTask(task)
+	var errs Errors
+	errs.Check("title", task.Title, Length(MinNameLen, MaxNameLen))
+	errs.Check("description", task.Description, Length(0, MaxDescriptionLen))
+	errs.Check("due_date", task.DueDate, RFC3339)
+	errs.Check("status", task.Status, OneOf(statuses...))
+	errs.Check("priority", task.Priority, OneOf(model.Priorities...))
+	errs.Check("recurrence", task.Recurrence, recurrenceRule)
+	if message := tagList(task.Tags); message != "" {
+		errs = append(errs, FieldError{Field: "tags", Message: message})
+	}
+	if message := reminderList(task.Reminders); message != "" {
+		errs = append(errs, FieldError{Field: "reminders", Message: message})
+	}
+	return errs
+}
+
+// tagList describes the first problem with the tags of a task
+func tagList(tags []string) string {
+	if len(tags) > MaxTaskTags {
+		return fmt.Sprintf("a task can have at most %d tags", MaxTaskTags)
+	}
+	for _, name := range tags {
+		if message := tagName("tag", name); message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+// reminderList describes the first problem with the reminders of a task,
+// given in minutes before its due date
+func reminderList(minutes []int) string {
+	if len(minutes) > MaxTaskReminders {
+		return fmt.Sprintf("a task can have at most %d reminders", MaxTaskReminders)
+	}
+	for _, m := range minutes {
+		if m < 1 || m > MaxReminderMinutes {
+			return fmt.Sprintf("reminders must be from 1 to %d minutes before the due date", MaxReminderMinutes)
+		}
+	}
+	return ""
+}
+
+// recurrenceRule allows no rule or one that recurrence.Parse understands
+func recurrenceRule(field, value string) string {
+	if value == "" {
+		return ""
+	}
+	if _, err := recurrence.Parse(value); err != nil {
+		reason := strings.TrimPrefix(err.Error(), recurrence.ErrInvalidRule.Error()+": ")
+		return fmt.Sprintf("%s must be an RRULE such as FREQ=WEEKLY;BYDAY=MO: %s", field, reason)
+	}
+	return ""
+}
+
+// Tag collapses whitespace in the name of tag and reports if it is invalid
+func Tag(tag *model.Tag) Errors {
+	tag.Name = singleLine(tag.Name)
+	var errs Errors
+	errs.Check("name", tag.Name, tagName)
+	return errs
+}
+
+// tagName allows 1 to MaxTagLen characters without commas, which separate
+// tags in query parameters
+func tagName(field, value string) string {
+	if message := Length(1, MaxTagLen)(field, value); message != "" {
+		return message
+	}
+	if strings.Contains(value, ",") {
+		return field + " must not contain commas"
+	}
+	return ""
+}
+
+// Limits on webhooks: the length of their URL, and the length of their
+// secret in characters
+const (
+	MaxWebhookURLLen    = 2048
+	MinWebhookSecretLen = 16
+	MaxWebhookSecretLen = 128
+)
+
+// Webhook trims the URL of hook, sorts its events and reports every field
+// that is missing or invalid. An empty secret is allowed; the service makes
+// one up.
+func Webhook(hook *model.Webhook) Errors {
+	hook.URL = strings.TrimSpace(hook.URL)
+	slices.Sort(hook.Events)
+	hook.Events = slices.Compact(hook.Events)
+	var errs Errors
+	errs.Check("url", hook.URL, Required, Length(0, MaxWebhookURLLen), webhookURL)
+	if message := eventList(hook.Events); message != "" {
+		errs = append(errs, FieldError{Field: "events", Message: message})
+	}
+	if hook.Secret != "" {
+		errs.Check("secret", hook.Secret, Length(MinWebhookSecretLen, MaxWebhookSecretLen))
+	}
+	return errs
+}
+
+// webhookURL only accepts absolute http and https URLs; whether they point
+// to a public address is up to the webhook.Guard of the service
+func webhookURL(field, value string) string {
+	u, err := url.Parse(value)
+	if value != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		return field + " must be an absolute http or https URL"
+	}
+	return ""
+}
+
+// eventList describes the first problem with the events of a webhook
+func eventList(events []string) string {
+	if len(events) == 0 {
+		return "events must name at least one event"
+	}
+	for _, e := range events {
+		if message := OneOf(model.WebhookEvents...)("event", e); message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+// NormalizeUser trims the fields of user, collapses whitespace in their name
+// and lower-cases their email
+func NormalizeUser(user *model.User) {
+	user.Name = singleLine(user.Name)
+	user.Email = NormalizeEmail(user.Email)
+}
+
+// NormalizeEmail brings an email into the form it is stored in, so that
+// addresses differing only in case belong to one account
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// User normalizes user and reports every field that is missing or invalid
+func User(user *model.User) Errors {
+	NormalizeUser(user)
+	var errs Errors
+	errs.Check("name", user.Name, Length(MinNameLen, MaxNameLen))
+	errs.Check("email", user.Email, Required, Email)
+	return errs
+}
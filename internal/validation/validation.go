@@ -0,0 +1,119 @@
+// Package validation normalizes and checks users and tasks before they are
+// stored. Each field has a set of rules; every field is checked so that all
+// problems can be reported at once.
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldError explains why one field failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors holds the field errors found in a value, at most one per field
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Err returns e as an error, or nil if there are no field errors
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Check runs rules against the value of field in order and records the
+// first one that fails
+func (e *Errors) Check(field, value string, rules ...Rule) {
+	for _, rule := range rules {
+		if message := rule(field, value); message != "" {
+			*e = append(*e, FieldError{Field: field, Message: message})
+			return
+		}
+	}
+}
+
+// Rule checks the value of a field and describes the problem, or returns ""
+// if the value is acceptable
+type Rule func(field, value string) string
+
+// Required rejects empty values
+func Required(field, value string) string {
+	if value == "" {
+		return field + " is required"
+	}
+	return ""
+}
+
+// Length limits the number of characters of a value
+func Length(min, max int) Rule {
+	return func(field, value string) string {
+		n := utf8.RuneCountInString(value)
+		switch {
+		case min == 0 && n > max:
+			return fmt.Sprintf("%s must be at most %d characters", field, max)
+		case n < min || n > max:
+			return fmt.Sprintf("%s must be between %d and %d characters", field, min, max)
+		}
+		return ""
+	}
+}
+
+// Bytes limits the length of a value in bytes
+func Bytes(min, max int) Rule {
+	return func(field, value string) string {
+		if len(value) < min || len(value) > max {
+			return fmt.Sprintf("%s must be between %d and %d bytes", field, min, max)
+		}
+		return ""
+	}
+}
+
+// OneOf only accepts the given values
+func OneOf(values ...string) Rule {
+	return func(field, value string) string {
+		if !slices.Contains(values, value) {
+			return fmt.Sprintf("invalid %s: must be one of %s", field, strings.Join(values, ", "))
+		}
+		return ""
+	}
+}
+
+// RFC3339 only accepts ISO 8601 date-times in the RFC 3339 profile
+func RFC3339(field, value string) string {
+	if _, err := time.Parse(time.RFC3339, value); err != nil {
+		return field + " must be ISO 8601 format (RFC3339)"
+	}
+	return ""
+}
+
+// Email only accepts a bare address such as alice@example.com, without a
+// display name or angle brackets
+func Email(field, value string) string {
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value || !strings.Contains(value[strings.LastIndex(value, "@"):], ".") {
+		return field + " must be a valid email address"
+	}
+	return ""
+}
+
+// singleLine trims s and collapses every run of whitespace inside it, line
+// breaks included, to one space
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
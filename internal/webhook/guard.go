@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrPrivateAddress is returned for webhook URLs, and connections, to
+	// addresses that are not public
+	ErrPrivateAddress = errors.New("url must point to a public address")
+	// ErrUnknownHost is returned for webhook URLs whose host does not resolve
+	ErrUnknownHost = errors.New("the host of the url could not be resolved")
+)
+
+// reserved are the ranges netip does not already classify as private,
+// loopback or link-local but that are no place to send events to either:
+// "this network", shared address space (carrier-grade NAT), IETF protocol
+// assignments, benchmarking, the reserved class E, IPv4-compatible IPv6 and
+// the IPv6 prefixes that embed IPv4 addresses (NAT64 and 6to4)
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/96"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// IsPublic reports whether addr is a global unicast address outside of the
+// private and reserved ranges, which is where webhooks may be sent
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reserved {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolver looks up the addresses of a host; *net.Resolver is one
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// Guard keeps webhooks from reaching the server's own network, such as the
+// loopback interface, the cloud metadata service at 169.254.169.254 or the
+// private ranges. CheckURL refuses such URLs when a webhook is created, and
+// the Client re-checks every connection, since a host may resolve
+// differently by the time a delivery is sent. The zero value is ready to use.
+type Guard struct {
+	// Resolver looks up the hosts of webhook URLs; net.DefaultResolver is
+	// used when it is nil
+	Resolver Resolver
+	// AllowPrivate turns the checks off, for receivers on the local
+	// machine during development
+	AllowPrivate bool
+}
+
+func (g *Guard) resolver() Resolver {
+	if g.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return g.Resolver
+}
+
+// CheckURL resolves the host of a webhook URL and returns ErrPrivateAddress
+// if any of its addresses is not public, or ErrUnknownHost if it has none
+func (g *Guard) CheckURL(ctx context.Context, rawURL string) error {
+	if g.AllowPrivate {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !IsPublic(addr) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+	if host = strings.TrimSuffix(strings.ToLower(host), "."); host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	addrs, err := g.resolver().LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("%w: %v", ErrUnknownHost, err)
+	}
+	if len(addrs) == 0 {
+		return ErrUnknownHost
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// Client returns an HTTP client for sending deliveries that gives up after
+// timeout, only connects to public addresses and does not follow redirects,
+// which would otherwise lead it past CheckURL. Proxies are not used, as the
+// guard could only check the address of the proxy.
+func (g *Guard) Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !g.AllowPrivate {
+		dialer.Control = checkDial
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkDial refuses connections to addresses that are not public; it runs
+// once the host is resolved, right before connecting
+func checkDial(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublic(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+	}
+	return nil
+}
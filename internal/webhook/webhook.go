@@ -0,0 +1,355 @@
+// Package webhook sends the events of users' accounts to the URLs they
+// subscribed. Events are queued as deliveries in the same transaction as the
+// change they report, and a Dispatcher sends them in the background,
+// retrying failed attempts with exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"task-manager/internal/clock"
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Defaults of the Dispatcher options
+const (
+	DefaultInterval    = 5 * time.Second
+	DefaultTimeout     = 10 * time.Second
+	DefaultBackoff     = time.Minute
+	DefaultMaxAttempts = 8
+	DefaultConcurrency = 8
+	DefaultPassTimeout = time.Minute
+)
+
+// batchSize is how many deliveries are loaded at a time
+const batchSize = 100
+
+// Event is the JSON body of a delivery
+type Event struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	OccurredAt string `json:"occurred_at"`
+	UserID     string `json:"user_id"`
+	Data       any    `json:"data"`
+}
+
+// Sign returns the signature of a payload under a webhook's secret, as sent
+// in the X-Webhook-Signature header: "sha256=" followed by the hex-encoded
+// HMAC-SHA256 of the payload
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Enqueue queues an event of a user for each of their webhooks subscribed to
+// its type. Pass the transaction that makes the change the event reports, so
+// that the event is only sent if the change is stored.
+func Enqueue(ctx context.Context, tx db.DB, userID, eventType string, data any) error {
+	hooks, err := tx.ListWebhooks(ctx, userID)
+	if err != nil {
+		return err
+	}
+	event := Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC().Format(time.RFC3339),
+		UserID:     userID,
+		Data:       data,
+	}
+	var payload []byte
+	for _, hook := range hooks {
+		if !slices.Contains(hook.Events, eventType) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return err
+			}
+		}
+		// The delivery is signed now so that it can still be sent once the
+		// webhook is gone, as happens to the user.deleted event
+		err := tx.CreateDelivery(ctx, &model.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventID:       event.ID,
+			Event:         eventType,
+			URL:           hook.URL,
+			Payload:       payload,
+			Signature:     Sign(hook.Secret, payload),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: event.OccurredAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dispatcher sends the pending deliveries at regular intervals
+type Dispatcher struct {
+	db          db.DB
+	guard       *Guard
+	client      *http.Client
+	clock       clock.Clock
+	interval    time.Duration
+	backoff     time.Duration
+	maxAttempts int
+	concurrency int
+	passTimeout time.Duration
+}
+
+// Option customizes NewDispatcher
+type Option func(*Dispatcher)
+
+// WithClock sets the clock attempts are timed by; clock.System is used
+// otherwise
+func WithClock(c clock.Clock) Option {
+	return func(d *Dispatcher) {
+		d.clock = c
+	}
+}
+
+// WithInterval sets the time between looks at the queue
+func WithInterval(interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.interval = interval
+	}
+}
+
+// WithGuard sets the guard that decides which addresses deliveries may be
+// sent to; the zero Guard, which only allows public addresses, is used
+// otherwise
+func WithGuard(g *Guard) Option {
+	return func(d *Dispatcher) {
+		d.guard = g
+	}
+}
+
+// WithHTTPClient sets the client deliveries are sent with, as is; the
+// Client of the guard with DefaultTimeout is used otherwise
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithBackoff sets how long to wait before retrying a failed delivery the
+// first time; the wait doubles with every further attempt
+func WithBackoff(backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff = backoff
+	}
+}
+
+// WithMaxAttempts sets how many times a delivery is tried before it is
+// marked as failed
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = n
+	}
+}
+
+// WithConcurrency sets how many webhooks are sent to at once. The
+// deliveries of one webhook are sent one after another, so a slow receiver
+// holds up no more than its own.
+func WithConcurrency(n int) Option {
+	return func(d *Dispatcher) {
+		d.concurrency = n
+	}
+}
+
+// WithPassTimeout caps the time DeliverPending spends on one pass; zero
+// disables it. Requests still running then are cancelled, and deliveries
+// not yet sent wait for the next pass.
+func WithPassTimeout(timeout time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.passTimeout = timeout
+	}
+}
+
+// NewDispatcher returns a dispatcher for the deliveries queued in database
+func NewDispatcher(database db.DB, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		db:          database,
+		guard:       &Guard{},
+		clock:       clock.System,
+		interval:    DefaultInterval,
+		backoff:     DefaultBackoff,
+		maxAttempts: DefaultMaxAttempts,
+		concurrency: DefaultConcurrency,
+		passTimeout: DefaultPassTimeout,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.client == nil {
+		d.client = d.guard.Client(DefaultTimeout)
+	}
+	return d
+}
+
+// Run sends the pending deliveries right away and then once every interval
+// until ctx is done. Errors of the queue are logged and retried at the next
+// interval.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		if err := d.DeliverPending(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Sending webhook deliveries failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.clock.After(d.interval):
+		}
+	}
+}
+
+// DeliverPending makes one attempt at every delivery that is due and
+// records the outcome, sending to several webhooks at once. It returns once
+// the queue holds nothing more that is due, or when the pass timeout is up.
+func (d *Dispatcher) DeliverPending(ctx context.Context) error {
+	now := d.clock.Now().UTC().Truncate(time.Second)
+	// Outcomes are recorded under ctx, so that attempts cut short by the
+	// pass timeout still count
+	passCtx := ctx
+	if d.passTimeout > 0 {
+		var cancel context.CancelFunc
+		passCtx, cancel = context.WithTimeout(ctx, d.passTimeout)
+		defer cancel()
+	}
+	for passCtx.Err() == nil {
+		deliveries, err := d.db.ListPendingDeliveries(passCtx, now, batchSize)
+		if err != nil {
+			if passCtx.Err() != nil && ctx.Err() == nil {
+				return nil
+			}
+			return err
+		}
+		if err := d.deliverBatch(ctx, passCtx, deliveries, now); err != nil {
+			return err
+		}
+		if len(deliveries) < batchSize {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// deliverBatch sends a batch of deliveries with up to d.concurrency
+// workers, each taking the deliveries of one webhook in order
+func (d *Dispatcher) deliverBatch(ctx, passCtx context.Context, deliveries []model.WebhookDelivery, now time.Time) error {
+	var order []string
+	byHook := map[string][]*model.WebhookDelivery{}
+	for i := range deliveries {
+		id := deliveries[i].WebhookID
+		if _, ok := byHook[id]; !ok {
+			order = append(order, id)
+		}
+		byHook[id] = append(byHook[id], &deliveries[i])
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	workers := make(chan struct{}, max(d.concurrency, 1))
+	for _, id := range order {
+		select {
+		case workers <- struct{}{}:
+		case <-passCtx.Done():
+		}
+		if passCtx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(queue []*model.WebhookDelivery) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			for _, delivery := range queue {
+				if passCtx.Err() != nil {
+					return
+				}
+				d.attempt(passCtx, delivery, now)
+				if err := d.db.UpdateDelivery(ctx, delivery); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
+				}
+			}
+		}(byHook[id])
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// attempt sends a delivery and updates it with the outcome: succeeded on a
+// 2xx response, otherwise pending until the next attempt, or failed once
+// the attempts run out
+func (d *Dispatcher) attempt(ctx context.Context, delivery *model.WebhookDelivery, now time.Time) {
+	delivery.Attempts++
+	delivery.ResponseStatus, delivery.Error = 0, ""
+	status, err := d.send(ctx, delivery)
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status, delivery.NextAttemptAt = model.DeliverySucceeded, ""
+		return
+	}
+	delivery.Error = err.Error()
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.Status, delivery.NextAttemptAt = model.DeliveryFailed, ""
+		return
+	}
+	wait := d.backoff << (delivery.Attempts - 1)
+	delivery.NextAttemptAt = now.Add(wait).Format(time.RFC3339)
+}
+
+// send posts a delivery to its URL and returns the status of the response
+func (d *Dispatcher) send(ctx context.Context, delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderSignature, delivery.Signature)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
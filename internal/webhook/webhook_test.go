@@ -0,0 +1,492 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"task-manager/internal/db"
+	"task-manager/internal/model"
+	"task-manager/internal/service"
+	"task-manager/internal/webhook"
+	"task-manager/internal/workflow"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWebhook(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Webhook Suite")
+}
+
+// fakeClock only moves when told to
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, waiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock on and wakes whoever waited for that long
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var waiting []waiter
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = waiting
+}
+
+func (c *fakeClock) Waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// staticResolver resolves the hosts it knows without asking DNS
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var parsed []netip.Addr
+	for _, addr := range addrs {
+		parsed = append(parsed, netip.MustParseAddr(addr))
+	}
+	return parsed, nil
+}
+
+// request is what the receiver got
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+var _ = Describe("Webhooks", func() {
+	var (
+		ctx        context.Context
+		database   db.DB
+		user       *model.User
+		tasks      *service.TaskService
+		hooks      *service.WebhookService
+		clock      *fakeClock
+		dispatcher *webhook.Dispatcher
+		receiver   *httptest.Server
+		mu         sync.Mutex
+		requests   []request
+		statuses   []int
+	)
+
+	received := func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request{}, requests...)
+	}
+
+	subscribe := func(events ...string) *model.Webhook {
+		hook := &model.Webhook{URL: receiver.URL, Events: events}
+		Expect(hooks.Create(ctx, user.ID, hook)).To(Succeed())
+		return hook
+	}
+
+	deliveries := func(hook *model.Webhook) []model.WebhookDelivery {
+		list, _, err := hooks.Deliveries(ctx, user.ID, hook.ID, db.Page{})
+		Expect(err).To(BeNil())
+		return list
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		database = db.NewMemoryDB()
+		user = &model.User{Name: "Test User", Email: "test@example.com"}
+		Expect(database.CreateUser(ctx, user)).To(Succeed())
+		tasks = service.NewTaskService(database, workflow.Default, user.ID)
+		// The receiver listens on the loopback interface
+		local := &webhook.Guard{AllowPrivate: true}
+		hooks = service.NewWebhookService(database, local)
+
+		requests, statuses = nil, nil
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			requests = append(requests, request{header: r.Header.Clone(), body: body})
+			status := http.StatusNoContent
+			if len(statuses) > 0 {
+				status, statuses = statuses[0], statuses[1:]
+			}
+			w.WriteHeader(status)
+		}))
+		DeferCleanup(receiver.Close)
+
+		// Events are stamped with the time of the machine, so the clock
+		// starts out a little ahead of it
+		clock = &fakeClock{now: time.Now().Add(time.Minute)}
+		dispatcher = webhook.NewDispatcher(database,
+			webhook.WithClock(clock),
+			webhook.WithInterval(time.Second),
+			webhook.WithBackoff(time.Minute),
+			webhook.WithMaxAttempts(3),
+			webhook.WithGuard(local),
+		)
+	})
+
+	It("should send signed events to the webhooks subscribed to them", func() {
+		hook := subscribe(model.EventTaskCreated, model.EventTaskDeleted)
+		Expect(hook.Secret).To(HavePrefix("whsec_"))
+		subscribe(model.EventUserDeleted)
+		task := &model.Task{Title: "Write report", Status: model.StatusPending}
+		Expect(tasks.Create(ctx, task)).To(Succeed())
+
+		Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+		req := received()[0]
+		Expect(req.header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.header.Get(webhook.HeaderEvent)).To(Equal(model.EventTaskCreated))
+		Expect(req.header.Get(webhook.HeaderSignature)).To(Equal(webhook.Sign(hook.Secret, req.body)))
+
+		var event struct {
+			ID     string `json:"id"`
+			Type   string `json:"type"`
+			UserID string `json:"user_id"`
+			Data   struct {
+				Task model.Task `json:"task"`
+			} `json:"data"`
+		}
+		Expect(json.Unmarshal(req.body, &event)).To(Succeed())
+		Expect(event.Type).To(Equal(model.EventTaskCreated))
+		Expect(event.UserID).To(Equal(user.ID))
+		Expect(event.Data.Task.ID).To(Equal(task.ID))
+
+		log := deliveries(hook)
+		Expect(log).To(HaveLen(1))
+		Expect(log[0].ID).To(Equal(req.header.Get(webhook.HeaderDelivery)))
+		Expect(log[0].EventID).To(Equal(event.ID))
+		Expect(log[0].Status).To(Equal(model.DeliverySucceeded))
+		Expect(log[0].Attempts).To(Equal(1))
+		Expect(log[0].ResponseStatus).To(Equal(http.StatusNoContent))
+
+		// Updates are not subscribed to
+		_, err := tasks.Modify(ctx, task.ID, func(task *model.Task) error {
+			task.Status = model.StatusInProgress
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(tasks.Delete(ctx, task.ID)).To(Succeed())
+		Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(2))
+		Expect(received()[1].header.Get(webhook.HeaderEvent)).To(Equal(model.EventTaskDeleted))
+	})
+
+	It("should not queue the events of changes that are rolled back", func() {
+		hook := subscribe(model.EventTaskUpdated)
+		task := &model.Task{Title: "Write report", Status: model.StatusPending}
+		Expect(tasks.Create(ctx, task)).To(Succeed())
+		err := tasks.UpdateStatuses(ctx, []string{task.ID, "missing"}, model.StatusInProgress)
+		Expect(err).To(MatchError(db.ErrTaskNotFound))
+		Expect(deliveries(hook)).To(BeEmpty())
+
+		Expect(tasks.UpdateStatuses(ctx, []string{task.ID}, model.StatusInProgress)).To(Succeed())
+		Expect(deliveries(hook)).To(HaveLen(1))
+	})
+
+	It("should retry failed deliveries with exponential backoff", func() {
+		hook := subscribe(model.EventTaskCreated)
+		statuses = []int{http.StatusInternalServerError, http.StatusBadGateway}
+		Expect(tasks.Create(ctx, &model.Task{Title: "Write report", Status: model.StatusPending})).To(Succeed())
+
+		Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+		log := deliveries(hook)
+		Expect(log[0].Status).To(Equal(model.DeliveryPending))
+		Expect(log[0].Attempts).To(Equal(1))
+		Expect(log[0].ResponseStatus).To(Equal(http.StatusInternalServerError))
+		Expect(log[0].Error).To(ContainSubstring("500"))
+		Expect(log[0].NextAttemptAt).To(Equal(clock.Now().UTC().Add(time.Minute).Format(time.RFC3339)))
+
+		// Not due yet
+		clock.Advance(59 * time.Second)
+		Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+
+		clock.Advance(time.Second)
+		Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(2))
+		log = deliveries(hook)
+		Expect(log[0].Attempts).To(Equal(2))
+		Expect(log[0].NextAttemptAt).To(Equal(clock.Now().UTC().Add(2 * time.Minute).Format(time.RFC3339)))
+
+		clock.Advance(2 * time.Minute)
+		Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+		log = deliveries(hook)
+		Expect(log[0].Status).To(Equal(model.DeliverySucceeded))
+		Expect(log[0].Attempts).To(Equal(3))
+		Expect(log[0].Error).To(BeEmpty())
+		Expect(log[0].NextAttemptAt).To(BeEmpty())
+
+		// The same signed payload is sent every time
+		Expect(received()[0].body).To(Equal(received()[2].body))
+		Expect(received()[0].header.Get(webhook.HeaderSignature)).To(Equal(received()[2].header.Get(webhook.HeaderSignature)))
+	})
+
+	It("should give up after the last attempt", func() {
+		hook := subscribe(model.EventTaskCreated)
+		receiver.Close()
+		Expect(tasks.Create(ctx, &model.Task{Title: "Write report", Status: model.StatusPending})).To(Succeed())
+
+		for range 3 {
+			Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+			clock.Advance(time.Hour)
+		}
+		log := deliveries(hook)
+		Expect(log[0].Status).To(Equal(model.DeliveryFailed))
+		Expect(log[0].Attempts).To(Equal(3))
+		Expect(log[0].ResponseStatus).To(Equal(0))
+		Expect(log[0].Error).NotTo(BeEmpty())
+		Expect(log[0].NextAttemptAt).To(BeEmpty())
+	})
+
+	It("should send to several webhooks at once, each in order", func() {
+		arrived := make(chan string, 4)
+		release := make(chan struct{})
+		unblock := sync.OnceFunc(func() { close(release) })
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			arrived <- r.URL.Path + " " + r.Header.Get(webhook.HeaderEvent)
+			<-release
+		}))
+		DeferCleanup(slow.Close)
+		DeferCleanup(unblock)
+		for _, path := range []string{"/a", "/b"} {
+			hook := &model.Webhook{URL: slow.URL + path, Events: []string{model.EventTaskCreated, model.EventTaskDeleted}}
+			Expect(hooks.Create(ctx, user.ID, hook)).To(Succeed())
+		}
+		task := &model.Task{Title: "Write report", Status: model.StatusPending}
+		Expect(tasks.Create(ctx, task)).To(Succeed())
+		Expect(tasks.Delete(ctx, task.ID)).To(Succeed())
+
+		done := make(chan error, 1)
+		go func() { done <- dispatcher.DeliverPending(ctx) }()
+		// Both webhooks are waited on at the same time, but the second
+		// delivery of each only once the first is answered
+		var first []string
+		for range 2 {
+			var req string
+			Eventually(arrived).Should(Receive(&req))
+			first = append(first, req)
+		}
+		Expect(first).To(ConsistOf("/a "+model.EventTaskCreated, "/b "+model.EventTaskCreated))
+		Consistently(arrived, 100*time.Millisecond).ShouldNot(Receive())
+
+		unblock()
+		Eventually(done).Should(Receive(BeNil()))
+		var second []string
+		for range 2 {
+			var req string
+			Expect(arrived).To(Receive(&req))
+			second = append(second, req)
+		}
+		Expect(second).To(ConsistOf("/a "+model.EventTaskDeleted, "/b "+model.EventTaskDeleted))
+	})
+
+	It("should stop a pass at the timeout", func() {
+		hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The server only notices the client going away once the
+			// body is read
+			io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+		}))
+		DeferCleanup(hang.Close)
+		hook := &model.Webhook{URL: hang.URL, Events: []string{model.EventTaskCreated, model.EventTaskDeleted}}
+		Expect(hooks.Create(ctx, user.ID, hook)).To(Succeed())
+		task := &model.Task{Title: "Write report", Status: model.StatusPending}
+		Expect(tasks.Create(ctx, task)).To(Succeed())
+		Expect(tasks.Delete(ctx, task.ID)).To(Succeed())
+
+		dispatcher = webhook.NewDispatcher(database,
+			webhook.WithClock(clock),
+			webhook.WithGuard(&webhook.Guard{AllowPrivate: true}),
+			webhook.WithPassTimeout(100*time.Millisecond),
+		)
+		start := time.Now()
+		Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+
+		// The request that was cut short counts as an attempt; the other
+		// delivery waits for the next pass
+		log := deliveries(hook)
+		Expect(log).To(HaveLen(2))
+		Expect([]int{log[0].Attempts, log[1].Attempts}).To(ConsistOf(0, 1))
+		for _, delivery := range log {
+			Expect(delivery.Status).To(Equal(model.DeliveryPending))
+			if delivery.Attempts == 1 {
+				Expect(delivery.Error).To(ContainSubstring(context.DeadlineExceeded.Error()))
+			}
+		}
+	})
+
+	It("should not follow redirects", func() {
+		redirect := httptest.NewServer(http.RedirectHandler(receiver.URL, http.StatusFound))
+		DeferCleanup(redirect.Close)
+		hook := &model.Webhook{URL: redirect.URL, Events: []string{model.EventTaskCreated}}
+		Expect(hooks.Create(ctx, user.ID, hook)).To(Succeed())
+		Expect(tasks.Create(ctx, &model.Task{Title: "Write report", Status: model.StatusPending})).To(Succeed())
+
+		Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+		Expect(received()).To(BeEmpty())
+		log := deliveries(hook)
+		Expect(log[0].Status).To(Equal(model.DeliveryPending))
+		Expect(log[0].ResponseStatus).To(Equal(http.StatusFound))
+	})
+
+	It("should refuse to connect to private addresses", func() {
+		// As when the host of a webhook resolves to the loopback interface
+		// only after it was created
+		hook := subscribe(model.EventTaskCreated)
+		Expect(tasks.Create(ctx, &model.Task{Title: "Write report", Status: model.StatusPending})).To(Succeed())
+
+		guarded := webhook.NewDispatcher(database, webhook.WithClock(clock))
+		Expect(guarded.DeliverPending(ctx)).To(Succeed())
+		Expect(received()).To(BeEmpty())
+		log := deliveries(hook)
+		Expect(log[0].Status).To(Equal(model.DeliveryPending))
+		Expect(log[0].ResponseStatus).To(Equal(0))
+		Expect(log[0].Error).To(ContainSubstring(webhook.ErrPrivateAddress.Error()))
+	})
+
+	It("should refuse webhooks to private addresses", func() {
+		guarded := service.NewWebhookService(database, nil)
+		hook := &model.Webhook{URL: receiver.URL, Events: []string{model.EventTaskCreated}}
+		Expect(guarded.Create(ctx, user.ID, hook)).To(MatchError(webhook.ErrPrivateAddress))
+		Expect(database.ListWebhooks(ctx, user.ID)).To(BeEmpty())
+	})
+
+	It("should tell the webhooks of a deleted user", func() {
+		subscribe(model.EventUserDeleted)
+		Expect(tasks.Create(ctx, &model.Task{Title: "Write report", Status: model.StatusPending})).To(Succeed())
+		Expect(service.NewUserService(database).Delete(ctx, user.ID, true)).To(Succeed())
+
+		Expect(dispatcher.DeliverPending(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+		Expect(received()[0].header.Get(webhook.HeaderEvent)).To(Equal(model.EventUserDeleted))
+		Expect(string(received()[0].body)).To(ContainSubstring(user.Email))
+		remaining, err := database.ListWebhooks(ctx, user.ID)
+		Expect(err).To(BeNil())
+		Expect(remaining).To(BeEmpty())
+	})
+
+	It("should send deliveries at every interval until stopped", func() {
+		subscribe(model.EventTaskCreated)
+		runCtx, stop := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		go func() {
+			dispatcher.Run(runCtx)
+			close(stopped)
+		}()
+
+		Eventually(clock.Waiting).Should(Equal(1))
+		Expect(tasks.Create(ctx, &model.Task{Title: "Write report", Status: model.StatusPending})).To(Succeed())
+		Expect(received()).To(BeEmpty())
+		clock.Advance(time.Second)
+		Eventually(received).Should(HaveLen(1))
+
+		Eventually(clock.Waiting).Should(Equal(1))
+		stop()
+		Eventually(stopped).Should(BeClosed())
+	})
+})
+
+var _ = Describe("Guard", func() {
+	DescribeTable("IsPublic",
+		func(addr string, public bool) {
+			Expect(webhook.IsPublic(netip.MustParseAddr(addr))).To(Equal(public))
+		},
+		Entry("a public IPv4 address", "93.184.215.14", true),
+		Entry("a public IPv6 address", "2606:2800:21f:cb07:6820:80da:af6b:8b2c", true),
+		Entry("the unspecified address", "0.0.0.0", false),
+		Entry("this network", "0.1.2.3", false),
+		Entry("loopback", "127.0.0.1", false),
+		Entry("IPv6 loopback", "::1", false),
+		Entry("cloud metadata", "169.254.169.254", false),
+		Entry("IPv6 link-local", "fe80::1", false),
+		Entry("10/8", "10.1.2.3", false),
+		Entry("172.16/12", "172.31.0.1", false),
+		Entry("192.168/16", "192.168.1.1", false),
+		Entry("IPv6 unique local", "fd00::1", false),
+		Entry("carrier-grade NAT", "100.64.0.1", false),
+		Entry("benchmarking", "198.18.0.1", false),
+		Entry("class E", "250.0.0.1", false),
+		Entry("broadcast", "255.255.255.255", false),
+		Entry("multicast", "224.0.0.1", false),
+		Entry("IPv4-mapped loopback", "::ffff:127.0.0.1", false),
+		Entry("IPv4-compatible loopback", "::127.0.0.1", false),
+		Entry("NAT64 of a private address", "64:ff9b::a00:1", false),
+		Entry("6to4 of a private address", "2002:a00:1::1", false),
+	)
+
+	DescribeTable("CheckURL",
+		func(rawURL string, expected error) {
+			guard := &webhook.Guard{Resolver: staticResolver{
+				"hooks.example.com":    {"93.184.215.14"},
+				"internal.example.com": {"10.0.0.5"},
+				"mixed.example.com":    {"93.184.215.14", "127.0.0.1"},
+				"empty.example.com":    {},
+			}}
+			err := guard.CheckURL(context.Background(), rawURL)
+			if expected == nil {
+				Expect(err).To(BeNil())
+			} else {
+				Expect(err).To(MatchError(expected))
+			}
+		},
+		Entry("a host with public addresses", "https://hooks.example.com/tasks", nil),
+		Entry("a public address", "https://93.184.215.14:8443/tasks", nil),
+		Entry("a host with a private address", "https://internal.example.com/tasks", webhook.ErrPrivateAddress),
+		Entry("a host with a private address among public ones", "https://mixed.example.com/tasks", webhook.ErrPrivateAddress),
+		Entry("a loopback address", "http://127.0.0.1:8080/tasks", webhook.ErrPrivateAddress),
+		Entry("an IPv6 loopback address", "http://[::1]:8080/tasks", webhook.ErrPrivateAddress),
+		Entry("the cloud metadata service", "http://169.254.169.254/latest/meta-data/", webhook.ErrPrivateAddress),
+		Entry("localhost", "http://localhost:8080/tasks", webhook.ErrPrivateAddress),
+		Entry("a subdomain of localhost", "http://api.localhost./tasks", webhook.ErrPrivateAddress),
+		Entry("an unknown host", "https://missing.example.com/tasks", webhook.ErrUnknownHost),
+		Entry("a host without addresses", "https://empty.example.com/tasks", webhook.ErrUnknownHost),
+	)
+
+	It("should allow anything when told to", func() {
+		guard := &webhook.Guard{Resolver: staticResolver{}, AllowPrivate: true}
+		Expect(guard.CheckURL(context.Background(), "http://127.0.0.1:8080/tasks")).To(Succeed())
+		Expect(guard.CheckURL(context.Background(), "https://missing.example.com/tasks")).To(Succeed())
+	})
+})
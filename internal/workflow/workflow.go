@@ -0,0 +1,229 @@
+// Package workflow describes the statuses a task can be in and which status
+// changes are allowed. Each deployment may configure its own workflow.
+package workflow
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"task-manager/internal/model"
+)
+
+// Status is one state of a workflow and the statuses a task in it may move to.
+// Terminal statuses mark a task as finished, so it is never overdue.
+type Status struct {
+	Name     string   `json:"name"`
+	Next     []string `json:"next"`
+	Terminal bool     `json:"terminal"`
+}
+
+// Config is the JSON form of a workflow
+type Config struct {
+	Statuses []Status `json:"statuses"`
+	// Initial is the status of new tasks that name none and of the next
+	// occurrence of a recurring task. It must not be terminal; if it is
+	// empty the first status is used.
+	Initial string `json:"initial"`
+	// AllowOpenSubtasks lets a task reach a terminal status while some of
+	// its subtasks have not
+	AllowOpenSubtasks bool `json:"allow_open_subtasks"`
+	// RequireUnblocked lists the statuses a task cannot move to while it
+	// waits for another task. If it is nil, in_progress and done are used as
+	// far as the workflow defines them.
+	RequireUnblocked []string `json:"require_unblocked"`
+}
+
+// Workflow is a validated set of statuses and the transitions between them
+type Workflow struct {
+	statuses          []Status
+	initial           string
+	allowOpenSubtasks bool
+	requireUnblocked  []string
+}
+
+// Default is the built-in workflow: pending, in_progress and done, any of
+// which may follow any other
+var Default = mustNew(Config{Statuses: []Status{
+	{Name: model.StatusPending, Next: []string{model.StatusInProgress, model.StatusDone}},
+	{Name: model.StatusInProgress, Next: []string{model.StatusPending, model.StatusDone}},
+	{Name: model.StatusDone, Next: []string{model.StatusPending, model.StatusInProgress}, Terminal: true},
+}})
+
+var ErrInvalidWorkflow = errors.New("invalid workflow")
+
+// New checks that cfg names each status once, only refers to statuses it
+// defines and starts tasks in one that is not terminal
+func New(cfg Config) (*Workflow, error) {
+	if len(cfg.Statuses) == 0 {
+		return nil, fmt.Errorf("%w: no statuses", ErrInvalidWorkflow)
+	}
+	names := make([]string, 0, len(cfg.Statuses))
+	for _, s := range cfg.Statuses {
+		if s.Name == "" || strings.ContainsAny(s.Name, ", ") {
+			return nil, fmt.Errorf("%w: status %q must be a non-empty name without commas or spaces", ErrInvalidWorkflow, s.Name)
+		}
+		if slices.Contains(names, s.Name) {
+			return nil, fmt.Errorf("%w: status %q is defined twice", ErrInvalidWorkflow, s.Name)
+		}
+		names = append(names, s.Name)
+	}
+	for _, s := range cfg.Statuses {
+		for _, next := range s.Next {
+			if !slices.Contains(names, next) {
+				return nil, fmt.Errorf("%w: %q leads to undefined status %q", ErrInvalidWorkflow, s.Name, next)
+			}
+		}
+	}
+	initial := cmp.Or(cfg.Initial, names[0])
+	i := slices.Index(names, initial)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: initial status %q is undefined", ErrInvalidWorkflow, initial)
+	}
+	if cfg.Statuses[i].Terminal {
+		return nil, fmt.Errorf("%w: initial status %q is terminal", ErrInvalidWorkflow, initial)
+	}
+	requireUnblocked := slices.Clone(cfg.RequireUnblocked)
+	if requireUnblocked == nil {
+		requireUnblocked = []string{}
+		for _, name := range []string{model.StatusInProgress, model.StatusDone} {
+			if slices.Contains(names, name) {
+				requireUnblocked = append(requireUnblocked, name)
+			}
+		}
+	}
+	for _, name := range requireUnblocked {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("%w: require_unblocked names undefined status %q", ErrInvalidWorkflow, name)
+		}
+	}
+	return &Workflow{
+		statuses:          slices.Clone(cfg.Statuses),
+		initial:           initial,
+		allowOpenSubtasks: cfg.AllowOpenSubtasks,
+		requireUnblocked:  requireUnblocked,
+	}, nil
+}
+
+func mustNew(cfg Config) *Workflow {
+	w, err := New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// Load reads a workflow from a JSON file in the form of Config
+func Load(path string) (*Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkflow, err)
+	}
+	return New(cfg)
+}
+
+func (w *Workflow) status(name string) (Status, bool) {
+	i := slices.IndexFunc(w.statuses, func(s Status) bool { return s.Name == name })
+	if i < 0 {
+		return Status{}, false
+	}
+	return w.statuses[i], true
+}
+
+// Config returns the definition of the workflow
+func (w *Workflow) Config() Config {
+	statuses := make([]Status, len(w.statuses))
+	for i, s := range w.statuses {
+		s.Next = slices.Clone(s.Next)
+		if s.Next == nil {
+			s.Next = []string{}
+		}
+		statuses[i] = s
+	}
+	return Config{Statuses: statuses, Initial: w.initial, AllowOpenSubtasks: w.allowOpenSubtasks, RequireUnblocked: slices.Clone(w.requireUnblocked)}
+}
+
+// AllowsOpenSubtasks reports whether a task may be finished before all of
+// its subtasks are
+func (w *Workflow) AllowsOpenSubtasks() bool {
+	return w.allowOpenSubtasks
+}
+
+// RequiresUnblocked reports whether a task must not be waiting for another
+// task to move to status
+func (w *Workflow) RequiresUnblocked(status string) bool {
+	return slices.Contains(w.requireUnblocked, status)
+}
+
+// Statuses lists every status in the order they were defined
+func (w *Workflow) Statuses() []string {
+	names := make([]string, len(w.statuses))
+	for i, s := range w.statuses {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// Initial is the status tasks start in unless they name another
+func (w *Workflow) Initial() string {
+	return w.initial
+}
+
+// Terminal lists the statuses of finished tasks
+func (w *Workflow) Terminal() []string {
+	var names []string
+	for _, s := range w.statuses {
+		if s.Terminal {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// IsTerminal reports whether status marks a task as finished
+func (w *Workflow) IsTerminal(status string) bool {
+	s, ok := w.status(status)
+	return ok && s.Terminal
+}
+
+// Next lists the statuses a task may move to from status
+func (w *Workflow) Next(status string) []string {
+	s, _ := w.status(status)
+	return slices.Clone(s.Next)
+}
+
+// CheckTransition returns a *TransitionError unless a task may move from one
+// status to another. Keeping the same status is always allowed, and so is
+// leaving a status the workflow no longer defines.
+func (w *Workflow) CheckTransition(from, to string) error {
+	if from == to {
+		return nil
+	}
+	s, known := w.status(from)
+	if !known || slices.Contains(s.Next, to) {
+		return nil
+	}
+	return &TransitionError{From: from, To: to, Allowed: w.Next(from)}
+}
+
+// TransitionError is returned for a status change the workflow forbids
+type TransitionError struct {
+	From, To string
+	// Allowed lists the legal next statuses
+	Allowed []string
+}
+
+func (e *TransitionError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("cannot move a task from %s to %s: %s is final", e.From, e.To, e.From)
+	}
+	return fmt.Sprintf("cannot move a task from %s to %s; allowed next statuses: %s", e.From, e.To, strings.Join(e.Allowed, ", "))
+}